@@ -0,0 +1,141 @@
+package check
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+)
+
+const (
+	// AdaptiveSmoothing is the weight the latest probe result gets in the
+	// exponentially weighted success rate and latency averages.
+	AdaptiveSmoothing = 0.2
+	// AdaptiveLatencyWeight is the score penalty for a probe whose average
+	// latency equals its full timeout. A probe that always fails loses 1.
+	AdaptiveLatencyWeight = 0.25
+	// DefaultExploreRate is the share of iterations in which a random
+	// lower-ranked check is moved to the front so its score keeps being
+	// refreshed.
+	DefaultExploreRate = 0.1
+)
+
+// probeKey identifies a probe across check list rebuilds and reports.
+type probeKey struct {
+	scheme string
+	target string
+}
+
+func keyOf(p Probe) probeKey {
+	return probeKey{scheme: p.Scheme(), target: p.Target()}
+}
+
+// probeScore holds exponentially weighted averages of a probe's results.
+type probeScore struct {
+	success float64 // 1 when every recent probe succeeded, 0 when all failed
+	latency time.Duration
+}
+
+// AdaptiveOrder ranks checks by recent success rate and latency, so that the
+// checks most likely to answer quickly are tried first. Checks that have
+// never been observed rank as perfect, so new entries are tried early.
+// Thread-safe.
+type AdaptiveOrder struct {
+	mu      sync.Mutex
+	scores  map[probeKey]*probeScore
+	explore float64
+}
+
+// NewAdaptiveOrder creates an adaptive ranking that moves a random
+// lower-ranked check to the front in the given share of iterations.
+func NewAdaptiveOrder(explore float64) *AdaptiveOrder {
+	return &AdaptiveOrder{
+		scores:  make(map[probeKey]*probeScore),
+		explore: explore,
+	}
+}
+
+// Observe folds a probe report into the score of the probe that produced it.
+func (a *AdaptiveOrder) Observe(r *Report) {
+	success := 1.0
+	if r.error != nil {
+		success = 0
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := probeKey{scheme: r.protocol, target: r.target}
+
+	score, ok := a.scores[key]
+	if !ok {
+		a.scores[key] = &probeScore{
+			success: 1 + AdaptiveSmoothing*(success-1),
+			latency: r.elapsed,
+		}
+
+		return
+	}
+
+	score.success += AdaptiveSmoothing * (success - score.success)
+	score.latency += time.Duration(AdaptiveSmoothing * float64(r.elapsed-score.latency))
+}
+
+// Order returns the checks sorted from best to worst score. Ties are broken
+// randomly, so checks that have not been observed yet keep a shuffled order.
+// The input slice is not modified.
+func (a *AdaptiveOrder) Order(checks Checks) Checks {
+	ordered := make(Checks, len(checks))
+	for i, p := range rand.Perm(len(checks)) {
+		ordered[i] = checks[p]
+	}
+
+	a.mu.Lock()
+
+	ranks := make(map[*Check]float64, len(ordered))
+	for _, c := range ordered {
+		ranks[c] = a.rank(c)
+	}
+
+	a.mu.Unlock()
+
+	slices.SortStableFunc(ordered, func(x, y *Check) int {
+		return cmp.Compare(ranks[y], ranks[x])
+	})
+
+	if len(ordered) > 1 && rand.Float64() < a.explore {
+		pick := 1 + rand.IntN(len(ordered)-1)
+		explored := ordered[pick]
+		copy(ordered[1:pick+1], ordered[:pick])
+		ordered[0] = explored
+
+		logger.Check().Debug("exploring", "target", explored.Probe.Target())
+	}
+
+	targets := make([]string, len(ordered))
+	for i, c := range ordered {
+		targets[i] = c.Probe.Target()
+	}
+
+	logger.Check().Debug("adaptive order", "order", targets)
+
+	return ordered
+}
+
+// rank returns the score of a check. Must be called with the lock held.
+func (a *AdaptiveOrder) rank(c *Check) float64 {
+	score, ok := a.scores[keyOf(c.Probe)]
+	if !ok {
+		return 1
+	}
+
+	var slowness float64
+	if c.Timeout > 0 {
+		slowness = min(float64(score.latency)/float64(c.Timeout), 1)
+	}
+
+	return score.success - AdaptiveLatencyWeight*slowness
+}
@@ -0,0 +1,125 @@
+package check
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type namedProbe struct {
+	fakeProbe
+
+	name string
+}
+
+func (p *namedProbe) Target() string { return p.name }
+
+func namedCheck(name string) *Check {
+	return &Check{Probe: &namedProbe{name: name}, Timeout: time.Second}
+}
+
+func observe(a *AdaptiveOrder, c *Check, elapsed time.Duration, err error) {
+	a.Observe(&Report{
+		protocol: c.Probe.Scheme(),
+		target:   c.Probe.Target(),
+		elapsed:  elapsed,
+		error:    err,
+	})
+}
+
+func TestAdaptiveOrder_FailingLast(t *testing.T) {
+	good, bad := namedCheck("good"), namedCheck("bad")
+	adaptive := NewAdaptiveOrder(0)
+
+	for range 5 {
+		observe(adaptive, good, 10*time.Millisecond, nil)
+		observe(adaptive, bad, time.Second, errors.New("timeout"))
+	}
+
+	for range 10 {
+		assert.Equal(t, Checks{good, bad}, adaptive.Order(Checks{bad, good}))
+	}
+}
+
+func TestAdaptiveOrder_FasterFirst(t *testing.T) {
+	fast, slow := namedCheck("fast"), namedCheck("slow")
+	adaptive := NewAdaptiveOrder(0)
+
+	for range 5 {
+		observe(adaptive, fast, 10*time.Millisecond, nil)
+		observe(adaptive, slow, 900*time.Millisecond, nil)
+	}
+
+	assert.Equal(t, Checks{fast, slow}, adaptive.Order(Checks{slow, fast}))
+}
+
+func TestAdaptiveOrder_UnobservedFirst(t *testing.T) {
+	seen, fresh := namedCheck("seen"), namedCheck("fresh")
+	adaptive := NewAdaptiveOrder(0)
+
+	observe(adaptive, seen, 500*time.Millisecond, nil)
+
+	assert.Equal(t, Checks{fresh, seen}, adaptive.Order(Checks{seen, fresh}))
+}
+
+func TestAdaptiveOrder_Recovers(t *testing.T) {
+	flaky, steady := namedCheck("flaky"), namedCheck("steady")
+	adaptive := NewAdaptiveOrder(0)
+
+	observe(adaptive, flaky, time.Second, errors.New("down"))
+	observe(adaptive, steady, 100*time.Millisecond, nil)
+	assert.Equal(t, Checks{steady, flaky}, adaptive.Order(Checks{flaky, steady}))
+
+	for range 20 {
+		observe(adaptive, flaky, 10*time.Millisecond, nil)
+	}
+
+	assert.Equal(t, Checks{flaky, steady}, adaptive.Order(Checks{flaky, steady}))
+}
+
+func TestAdaptiveOrder_AlwaysExplore(t *testing.T) {
+	good, bad := namedCheck("good"), namedCheck("bad")
+	adaptive := NewAdaptiveOrder(1)
+
+	observe(adaptive, good, 10*time.Millisecond, nil)
+	observe(adaptive, bad, time.Second, errors.New("timeout"))
+
+	assert.Equal(t, Checks{bad, good}, adaptive.Order(Checks{good, bad}))
+}
+
+func TestAdaptiveOrder_KeepsElements(t *testing.T) {
+	checks := Checks{namedCheck("a"), namedCheck("b"), namedCheck("c"), namedCheck("d")}
+	orig := slices.Clone(checks)
+	adaptive := NewAdaptiveOrder(1)
+
+	got := adaptive.Order(checks)
+
+	assert.True(t, sameElements(got, checks), "adaptive order lost elements")
+	assert.Equal(t, orig, checks, "Order() should not reorder the input slice")
+}
+
+func TestListAll_Adaptive(t *testing.T) {
+	ordered := namedCheck("ordered")
+	good, bad := namedCheck("good"), namedCheck("bad")
+	cl := &List{
+		Ordered:  Checks{ordered},
+		Shuffled: Checks{bad, good},
+		Adaptive: NewAdaptiveOrder(0),
+	}
+
+	cl.Observe(&Report{protocol: "fake", target: "bad", error: errors.New("fail")})
+
+	assert.Equal(t, []*Check{ordered, good, bad}, slices.Collect(cl.All()))
+}
+
+func TestListObserve_NotAdaptive(t *testing.T) {
+	var nilList *List
+
+	assert.NotPanics(t, func() {
+		nilList.Observe(&Report{})
+		(&List{}).Observe(&Report{})
+	})
+}
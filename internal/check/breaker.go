@@ -0,0 +1,235 @@
+package check
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+)
+
+const (
+	// DefaultBreakerCooldown is how long a probe is skipped after its
+	// circuit first opens.
+	DefaultBreakerCooldown = 5 * time.Minute
+	// DefaultBreakerMaxCooldown caps the exponentially growing cooldown of a
+	// probe whose re-trials keep failing.
+	DefaultBreakerMaxCooldown = time.Hour
+)
+
+// BreakerState is the circuit breaker state of a probe.
+type BreakerState int
+
+const (
+	// BreakerClosed means the probe runs normally.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen means the probe is skipped until its cooldown expires.
+	BreakerOpen
+	// BreakerHalfOpen means the cooldown expired and the next run is a trial.
+	BreakerHalfOpen
+)
+
+// String returns the lowercase state name.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerConfig holds the circuit breaker settings. Zero durations mean
+// defaults.
+type BreakerConfig struct {
+	// Threshold is the number of consecutive failed iterations after which a
+	// probe is skipped. Failures only count in iterations where another
+	// probe succeeded, so an outage never opens circuits.
+	Threshold int
+	// Cooldown is the initial time a probe is skipped for.
+	Cooldown time.Duration
+	// MaxCooldown caps the cooldown, which doubles on every failed trial.
+	MaxCooldown time.Duration
+}
+
+// BreakerStatus is a snapshot of the circuit breaker of one probe.
+type BreakerStatus struct {
+	Scheme   string
+	Target   string
+	State    BreakerState
+	Failures int
+	RetryAt  time.Time
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	cooldown time.Duration
+	retryAt  time.Time
+}
+
+// Breakers tracks one circuit breaker per probe, so endpoints that are dead
+// while others answer stop adding timeout latency to every iteration.
+// Thread-safe.
+type Breakers struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	breakers map[probeKey]*breaker
+	// pending holds probes that failed in the current iteration. They only
+	// count as failures once another probe succeeds, before or after them.
+	pending   []probeKey
+	succeeded bool
+	now       func() time.Time
+}
+
+// NewBreakers creates the circuit breakers for the given configuration.
+func NewBreakers(cfg BreakerConfig) *Breakers {
+	cfg.Cooldown = cmp.Or(cfg.Cooldown, DefaultBreakerCooldown)
+	cfg.MaxCooldown = max(cmp.Or(cfg.MaxCooldown, DefaultBreakerMaxCooldown), cfg.Cooldown)
+
+	return &Breakers{
+		cfg:      cfg,
+		breakers: make(map[probeKey]*breaker),
+		now:      time.Now,
+	}
+}
+
+// Observe records a probe report. A success closes the probe's circuit and
+// confirms the failures of the same iteration, whatever their order.
+func (b *Breakers) Observe(r *Report) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := probeKey{scheme: r.protocol, target: r.target}
+
+	if r.error != nil {
+		if b.succeeded {
+			b.strike(key)
+		} else {
+			b.pending = append(b.pending, key)
+		}
+
+		return
+	}
+
+	for _, failed := range b.pending {
+		b.strike(failed)
+	}
+
+	b.pending = nil
+	b.succeeded = true
+
+	br, ok := b.breakers[key]
+	if !ok {
+		return
+	}
+
+	if br.state != BreakerClosed {
+		logger.Check().Info("circuit closed",
+			"protocol", key.scheme, "target", key.target)
+	}
+
+	delete(b.breakers, key)
+}
+
+// Snapshot returns the state of every probe with an open circuit or recent
+// failures, sorted by scheme and target.
+func (b *Breakers) Snapshot() []BreakerStatus {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	result := make([]BreakerStatus, 0, len(b.breakers))
+	for key, br := range b.breakers {
+		result = append(result, BreakerStatus{
+			Scheme:   key.scheme,
+			Target:   key.target,
+			State:    br.state,
+			Failures: br.failures,
+			RetryAt:  br.retryAt,
+		})
+	}
+
+	slices.SortFunc(result, func(x, y BreakerStatus) int {
+		return cmp.Or(cmp.Compare(x.Scheme, y.Scheme), cmp.Compare(x.Target, y.Target))
+	})
+
+	return result
+}
+
+// begin starts a new iteration: failures of the previous one, which had no
+// success, are dropped.
+func (b *Breakers) begin() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending = nil
+	b.succeeded = false
+}
+
+// allow reports whether the check should run now, moving an open circuit
+// whose cooldown expired to half-open.
+func (b *Breakers) allow(c *Check) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := keyOf(c.Probe)
+
+	br, ok := b.breakers[key]
+	if !ok || br.state != BreakerOpen {
+		return true
+	}
+
+	if b.now().Before(br.retryAt) {
+		return false
+	}
+
+	br.state = BreakerHalfOpen
+	logger.Check().Info("circuit half-open: retrying",
+		"protocol", key.scheme, "target", key.target)
+
+	return true
+}
+
+// strike counts a confirmed failure. Must be called with the lock held.
+func (b *Breakers) strike(key probeKey) {
+	br, ok := b.breakers[key]
+	if !ok {
+		br = &breaker{}
+		b.breakers[key] = br
+	}
+
+	br.failures++
+
+	switch {
+	case br.state == BreakerHalfOpen:
+		br.cooldown = min(2*br.cooldown, b.cfg.MaxCooldown)
+	case br.state == BreakerClosed && br.failures >= b.cfg.Threshold:
+		br.cooldown = b.cfg.Cooldown
+	default:
+		return
+	}
+
+	br.state = BreakerOpen
+	br.retryAt = b.now().Add(br.cooldown)
+
+	logger.Check().Warn("circuit open: skipping probe",
+		"protocol", key.scheme,
+		"target", key.target,
+		"failures", br.failures,
+		"retryIn", br.cooldown)
+}
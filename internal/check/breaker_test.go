@@ -0,0 +1,227 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errProbeDown = errors.New("down")
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestBreakers(threshold int) (*Breakers, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	b := NewBreakers(BreakerConfig{
+		Threshold:   threshold,
+		Cooldown:    time.Minute,
+		MaxCooldown: 3 * time.Minute,
+	})
+	b.now = clock.Now
+
+	return b, clock
+}
+
+// iterate simulates one loop iteration where dead fails and alive succeeds.
+func iterate(b *Breakers, dead, alive *Check) {
+	b.begin()
+
+	if b.allow(dead) {
+		b.Observe(&Report{protocol: "fake", target: dead.Probe.Target(), error: errProbeDown})
+	}
+
+	b.Observe(&Report{protocol: "fake", target: alive.Probe.Target()})
+}
+
+// breakerProbe reports on its name, with err.
+type breakerProbe struct {
+	fakeProbe
+
+	name string
+	err  error
+}
+
+func (p *breakerProbe) Target() string { return p.name }
+
+func (p *breakerProbe) Execute(context.Context, time.Duration) *Report {
+	return &Report{protocol: "fake", target: p.name, error: p.err}
+}
+
+// observingChecker feeds reports to list, as the loop does, and records the
+// targets of the checks run.
+type observingChecker struct {
+	list *List
+	run  []string
+}
+
+func (c *observingChecker) CheckRun(chk Check)       { c.run = append(c.run, chk.Probe.Target()) }
+func (c *observingChecker) ProbeSuccess(rep *Report) { c.list.Observe(rep) }
+func (c *observingChecker) ProbeFailure(rep *Report) { c.list.Observe(rep) }
+
+func stateOf(b *Breakers, target string) BreakerState {
+	for _, st := range b.Snapshot() {
+		if st.Target == target {
+			return st.State
+		}
+	}
+
+	return BreakerClosed
+}
+
+func TestBreakerState_String(t *testing.T) {
+	assert.Equal(t, "closed", BreakerClosed.String())
+	assert.Equal(t, "open", BreakerOpen.String())
+	assert.Equal(t, "half-open", BreakerHalfOpen.String())
+}
+
+func TestNewBreakers_Defaults(t *testing.T) {
+	b := NewBreakers(BreakerConfig{Threshold: 1})
+	assert.Equal(t, DefaultBreakerCooldown, b.cfg.Cooldown)
+	assert.Equal(t, DefaultBreakerMaxCooldown, b.cfg.MaxCooldown)
+}
+
+func TestBreakers_OpensAfterThreshold(t *testing.T) {
+	b, _ := newTestBreakers(3)
+	dead, alive := namedCheck("dead"), namedCheck("alive")
+
+	iterate(b, dead, alive)
+	iterate(b, dead, alive)
+	assert.Equal(t, BreakerClosed, stateOf(b, "dead"))
+	assert.True(t, b.allow(dead))
+
+	iterate(b, dead, alive)
+	assert.Equal(t, BreakerOpen, stateOf(b, "dead"))
+	assert.False(t, b.allow(dead))
+}
+
+func TestBreakers_OutageDoesNotCount(t *testing.T) {
+	b, _ := newTestBreakers(1)
+	dead := namedCheck("dead")
+
+	for range 5 {
+		b.begin()
+		b.Observe(&Report{protocol: "fake", target: "dead", error: errProbeDown})
+	}
+
+	b.begin()
+	assert.Empty(t, b.Snapshot(), "failures without a success elsewhere must not count")
+	assert.True(t, b.allow(dead))
+}
+
+func TestBreakers_FailureAfterSuccessCounts(t *testing.T) {
+	b, _ := newTestBreakers(1)
+
+	b.begin()
+	b.Observe(&Report{protocol: "fake", target: "alive"})
+	b.Observe(&Report{protocol: "fake", target: "dead", error: errProbeDown})
+
+	b.begin()
+	assert.Equal(t, BreakerOpen, stateOf(b, "dead"), "a success earlier in the iteration confirms the failure")
+}
+
+func TestBreakers_HalfOpenBackoff(t *testing.T) {
+	b, clock := newTestBreakers(1)
+	dead, alive := namedCheck("dead"), namedCheck("alive")
+
+	iterate(b, dead, alive)
+	require.Equal(t, BreakerOpen, stateOf(b, "dead"))
+
+	for _, cooldown := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		retryAt := b.Snapshot()[0].RetryAt
+		assert.Equal(t, clock.now.Add(cooldown), retryAt)
+
+		clock.now = retryAt.Add(-time.Second)
+		assert.False(t, b.allow(dead))
+
+		clock.now = retryAt
+		assert.True(t, b.allow(dead))
+		assert.Equal(t, BreakerHalfOpen, stateOf(b, "dead"))
+
+		b.Observe(&Report{protocol: "fake", target: "dead", error: errProbeDown})
+		b.Observe(&Report{protocol: "fake", target: "alive"})
+		assert.Equal(t, BreakerOpen, stateOf(b, "dead"))
+	}
+}
+
+func TestBreakers_ClosesOnSuccess(t *testing.T) {
+	b, clock := newTestBreakers(1)
+	dead, alive := namedCheck("dead"), namedCheck("alive")
+
+	iterate(b, dead, alive)
+	require.Equal(t, BreakerOpen, stateOf(b, "dead"))
+
+	clock.now = clock.now.Add(time.Hour)
+	b.begin()
+	require.True(t, b.allow(dead))
+	b.Observe(&Report{protocol: "fake", target: "dead"})
+
+	assert.Empty(t, b.Snapshot())
+	assert.True(t, b.allow(dead))
+}
+
+func TestBreakers_NilSafe(t *testing.T) {
+	var b *Breakers
+
+	assert.NotPanics(t, func() {
+		b.begin()
+		assert.True(t, b.allow(namedCheck("x")))
+		assert.Nil(t, b.Snapshot())
+	})
+}
+
+func TestListAll_BreakerSkippedLast(t *testing.T) {
+	dead, alive, other := namedCheck("dead"), namedCheck("alive"), namedCheck("other")
+	b, _ := newTestBreakers(1)
+	iterate(b, dead, alive)
+
+	cl := &List{Ordered: Checks{dead, alive, other}, Breakers: b}
+
+	assert.Equal(t, []*Check{alive, other, dead}, slices.Collect(cl.All()))
+
+	var first *Check
+	for c := range cl.All() {
+		first = c
+
+		break
+	}
+
+	assert.Same(t, alive, first, "open circuit should not run ahead of healthy probes")
+}
+
+func TestListRunExhaustive_SkipsOpenCircuits(t *testing.T) {
+	alive := &Check{Probe: &breakerProbe{name: "alive"}}
+	dead := &Check{Probe: &breakerProbe{name: "dead", err: errProbeDown}}
+	b, _ := newTestBreakers(1)
+	cl := &List{Ordered: Checks{alive, dead}, Breakers: b, Exhaustive: true}
+	checker := &observingChecker{list: cl}
+
+	require.True(t, cl.RunExhaustive(t.Context(), checker))
+	require.Equal(t, BreakerOpen, stateOf(b, "dead"), "the failure after the success counts")
+
+	checker.run = nil
+	require.True(t, cl.RunExhaustive(t.Context(), checker))
+	assert.Equal(t, []string{"alive"}, checker.run, "the open circuit is skipped")
+	assert.Equal(t, BreakerOpen, stateOf(b, "dead"))
+}
+
+func TestListRunExhaustive_SkippedRunWhenAllFail(t *testing.T) {
+	dead := &Check{Probe: &breakerProbe{name: "dead", err: errProbeDown}}
+	other := &Check{Probe: &breakerProbe{name: "other", err: errProbeDown}}
+	b, _ := newTestBreakers(1)
+	iterate(b, dead, namedCheck("alive"))
+
+	cl := &List{Ordered: Checks{dead, other}, Breakers: b, Exhaustive: true}
+	checker := &observingChecker{list: cl}
+
+	assert.False(t, cl.RunExhaustive(t.Context(), checker))
+	assert.Equal(t, []string{"other", "dead"}, checker.run)
+}
@@ -4,6 +4,8 @@ package check
 import (
 	"context"
 	"iter"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -18,6 +20,7 @@ import (
 type Check struct {
 	Probe   Probe         // The probe to execute for this check
 	Timeout time.Duration // Maximum duration to wait for the probe to complete
+	Name    string        // Optional name identifying the check in reports
 }
 
 // Checker handles lifecycle events for a check execution.
@@ -62,7 +65,16 @@ type Checker interface {
 func (c *Check) RunProbe(ctx context.Context, checker Checker) *Report {
 	checker.CheckRun(*c)
 
-	return c.Probe.Execute(ctx, c.Timeout)
+	return c.execute(ctx)
+}
+
+// execute runs the probe and returns a copy of its report carrying the check
+// name: probes may return the same report to concurrent runs.
+func (c *Check) execute(ctx context.Context) *Report {
+	report := *c.Probe.Execute(ctx, c.Timeout)
+	report.name = c.Name
+
+	return &report
 }
 
 // CheckerRun executes a series of checks using the provided Checker interface.
@@ -102,3 +114,48 @@ func CheckerRun(
 
 	return false // All checks failed
 }
+
+// CheckerRunAll executes every check in parallel, even after one succeeds,
+// so that each probe result reaches the Checker.
+//
+// Returns true if at least one check is successful, the same verdict as
+// CheckerRun. CheckRun is called for each check before the probes start;
+// ProbeSuccess and ProbeFailure are called from the calling goroutine once
+// all probes have completed, in the order the checks were yielded, so the
+// Checker does not need to be thread-safe.
+func CheckerRunAll(
+	ctx context.Context,
+	checker Checker,
+	checks iter.Seq[*Check],
+) bool {
+	all := slices.Collect(checks)
+	reports := make([]*Report, len(all))
+
+	var wg sync.WaitGroup
+
+	for idx, check := range all {
+		checker.CheckRun(*check)
+
+		wg.Go(func() {
+			reports[idx] = check.execute(ctx)
+		})
+	}
+
+	wg.Wait()
+
+	up := false
+
+	for _, report := range reports {
+		if report.error != nil {
+			checker.ProbeFailure(report)
+
+			continue
+		}
+
+		checker.ProbeSuccess(report)
+
+		up = true
+	}
+
+	return up
+}
@@ -14,8 +14,11 @@ type fakeProbe struct {
 	ret *Report
 }
 
+// Execute returns a copy of ret, as real probes build a report per run.
 func (f *fakeProbe) Execute(_ context.Context, _ time.Duration) *Report {
-	return f.ret
+	report := *f.ret
+
+	return &report
 }
 func (*fakeProbe) Scheme() string { return "fake" }
 func (*fakeProbe) Target() string { return "fake" }
@@ -76,3 +79,54 @@ func TestCheckerRun_WithList(t *testing.T) {
 	assert.Len(t, checker.succ, 1)
 	assert.Empty(t, checker.fail)
 }
+
+func TestCheckerRunAll_RunsEveryCheck(t *testing.T) {
+	fail := &Check{Probe: &fakeProbe{ret: &Report{error: errors.New("fail")}}}
+	succ := &Check{Probe: &fakeProbe{ret: &Report{}}}
+	checker := &recordChecker{}
+	ok := CheckerRunAll(t.Context(), checker, slices.Values([]*Check{succ, fail, succ}))
+	assert.True(t, ok)
+	assert.Len(t, checker.run, 3)
+	assert.Len(t, checker.succ, 2)
+	assert.Len(t, checker.fail, 1)
+}
+
+func TestCheckerRunAll_AllFail(t *testing.T) {
+	fail := &Check{Probe: &fakeProbe{ret: &Report{error: errors.New("fail")}}}
+	checker := &recordChecker{}
+	ok := CheckerRunAll(t.Context(), checker, slices.Values([]*Check{fail, fail}))
+	assert.False(t, ok)
+	assert.Len(t, checker.fail, 2)
+	assert.Empty(t, checker.succ)
+}
+
+func TestCheckerRunAll_Empty(t *testing.T) {
+	checker := &recordChecker{}
+	ok := CheckerRunAll(t.Context(), checker, slices.Values([]*Check{}))
+	assert.False(t, ok)
+	assert.Empty(t, checker.run)
+}
+
+type slowProbe struct {
+	fakeProbe
+
+	delay time.Duration
+}
+
+func (p *slowProbe) Execute(_ context.Context, _ time.Duration) *Report {
+	time.Sleep(p.delay)
+
+	return &Report{}
+}
+
+func TestCheckerRunAll_Parallel(t *testing.T) {
+	slow := &Check{Probe: &slowProbe{delay: 100 * time.Millisecond}}
+	checker := &recordChecker{}
+
+	start := time.Now()
+	ok := CheckerRunAll(t.Context(), checker, slices.Values([]*Check{slow, slow, slow, slow}))
+
+	assert.True(t, ok)
+	assert.Len(t, checker.succ, 4)
+	assert.Less(t, time.Since(start), 300*time.Millisecond, "probes should run in parallel")
+}
@@ -1,34 +1,119 @@
 package check
 
 import (
+	"context"
 	"iter"
 	"math/rand/v2"
+	"slices"
 )
 
 // Checks is a collection of check definitions.
 type Checks []*Check
 
 // List contains ordered and shuffled check collections.
+//
+// When Adaptive is set, the shuffled checks are ranked by their recent
+// results instead of being uniformly randomized. When Breakers is set,
+// checks with an open circuit are skipped unless every other check failed.
+// When Exhaustive is set, every other check runs on each iteration (see
+// RunExhaustive) instead of stopping at the first success.
 type List struct {
-	Ordered  Checks
-	Shuffled Checks
+	Ordered    Checks
+	Shuffled   Checks
+	Adaptive   *AdaptiveOrder
+	Breakers   *Breakers
+	Exhaustive bool
 }
 
 // All returns an iterator over all checks: the ordered ones first, then the
-// shuffled ones in a fresh random order. The permutation is only computed if
-// iteration reaches the shuffled section.
+// shuffled ones in a fresh random (or adaptive) order, then the ones skipped
+// by an open circuit breaker. The permutation is only computed if iteration
+// reaches the shuffled section.
 func (cl *List) All() iter.Seq[*Check] {
 	return func(yield func(*Check) bool) {
+		cl.Breakers.begin()
+
+		var skipped Checks
+
+		try := func(c *Check) bool {
+			if !cl.Breakers.allow(c) {
+				skipped = append(skipped, c)
+
+				return true
+			}
+
+			return yield(c)
+		}
+
 		for _, c := range cl.Ordered {
-			if !yield(c) {
+			if !try(c) {
+				return
+			}
+		}
+
+		for _, c := range cl.shuffled() {
+			if !try(c) {
 				return
 			}
 		}
 
-		for _, i := range rand.Perm(len(cl.Shuffled)) {
-			if !yield(cl.Shuffled[i]) {
+		for _, c := range skipped {
+			if !yield(c) {
 				return
 			}
 		}
 	}
 }
+
+// RunExhaustive runs the checks whose circuit is not open with
+// CheckerRunAll. The checks skipped by an open circuit breaker only run, as
+// with CheckerRun, when all of those failed.
+func (cl *List) RunExhaustive(ctx context.Context, checker Checker) bool {
+	cl.Breakers.begin()
+
+	var run, skipped Checks
+
+	for _, c := range slices.Concat(cl.Ordered, cl.shuffled()) {
+		if cl.Breakers.allow(c) {
+			run = append(run, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+
+	if CheckerRunAll(ctx, checker, slices.Values(run)) {
+		return true
+	}
+
+	return CheckerRun(ctx, checker, slices.Values(skipped))
+}
+
+// Observe feeds a probe report to the adaptive ranking and circuit
+// breakers, if any.
+func (cl *List) Observe(r *Report) {
+	if cl == nil {
+		return
+	}
+
+	if cl.Adaptive != nil {
+		cl.Adaptive.Observe(r)
+	}
+
+	if cl.Breakers != nil {
+		cl.Breakers.Observe(r)
+	}
+}
+
+// shuffled returns the shuffled checks in the order they should be tried.
+func (cl *List) shuffled() Checks {
+	if cl.Adaptive != nil {
+		return cl.Adaptive.Order(cl.Shuffled)
+	}
+
+	ordered := make(Checks, len(cl.Shuffled))
+	for i, p := range rand.Perm(len(cl.Shuffled)) {
+		ordered[i] = cl.Shuffled[p]
+	}
+
+	return ordered
+}
@@ -0,0 +1,119 @@
+package check
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// FailureClass classifies why a probe failed.
+type FailureClass int
+
+const (
+	// FailureNone means the probe succeeded.
+	FailureNone FailureClass = iota
+	// FailureDNS means a name could not be resolved (e.g. NXDOMAIN).
+	FailureDNS
+	// FailureTimeout means the probe did not complete in time.
+	FailureTimeout
+	// FailureRefused means the target actively refused the connection.
+	FailureRefused
+	// FailureNoRoute means the host or network is unreachable.
+	FailureNoRoute
+	// FailureTLS means the TLS handshake or certificate validation failed.
+	FailureTLS
+	// FailureHTTPStatus means the server answered with a 5xx status,
+	// typically from a proxy that cannot reach the upstream. It is recorded
+	// on successful probes: any answer means the connection is up.
+	FailureHTTPStatus
+	// FailureOther is any failure that does not fit another class.
+	FailureOther
+
+	// FailureClassCount is the number of failure classes.
+	FailureClassCount = int(FailureOther) + 1
+)
+
+// String returns the failure class name used in logs, stats and the down
+// action environment.
+func (c FailureClass) String() string {
+	switch c {
+	case FailureNone:
+		return "none"
+	case FailureDNS:
+		return "dns"
+	case FailureTimeout:
+		return "timeout"
+	case FailureRefused:
+		return "refused"
+	case FailureNoRoute:
+		return "noRoute"
+	case FailureTLS:
+		return "tls"
+	case FailureHTTPStatus:
+		return "httpStatus"
+	default:
+		return "other"
+	}
+}
+
+// Classify returns the failure class of a probe error.
+func Classify(err error) FailureClass {
+	if err == nil {
+		return FailureNone
+	}
+
+	// Checked first: timeouts also surface wrapped in DNS and TLS errors.
+	if isTimeout(err) {
+		return FailureTimeout
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return FailureRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return FailureNoRoute
+	case isTLS(err):
+		return FailureTLS
+	case errors.Is(err, ErrDNSNoAddresses):
+		return FailureDNS
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return FailureDNS
+	}
+
+	return FailureOther
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isTLS(err error) bool {
+	var (
+		verifyErr    *tls.CertificateVerificationError
+		headerErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		authorityErr x509.UnknownAuthorityError
+		hostErr      x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+
+	return errors.As(err, &verifyErr) ||
+		errors.As(err, &headerErr) ||
+		errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &hostErr) ||
+		errors.As(err, &invalidErr)
+}
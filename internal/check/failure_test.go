@@ -0,0 +1,75 @@
+package check
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want FailureClass
+	}{
+		{"nil", nil, FailureNone},
+		{"deadline", fmt.Errorf("wrapped: %w", context.DeadlineExceeded), FailureTimeout},
+		{"os deadline", os.ErrDeadlineExceeded, FailureTimeout},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, FailureTimeout},
+		{"nxdomain", &net.DNSError{Err: "no such host", IsNotFound: true}, FailureDNS},
+		{"no addresses", fmt.Errorf("resolving: %w", ErrDNSNoAddresses), FailureDNS},
+		{
+			"refused",
+			&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			FailureRefused,
+		},
+		{"host unreachable", os.NewSyscallError("connect", syscall.EHOSTUNREACH), FailureNoRoute},
+		{"net unreachable", os.NewSyscallError("connect", syscall.ENETUNREACH), FailureNoRoute},
+		{"unknown authority", x509.UnknownAuthorityError{}, FailureTLS},
+		{"hostname", fmt.Errorf("get: %w", x509.HostnameError{}), FailureTLS},
+		{"alert", tls.AlertError(40), FailureTLS},
+		{"other", errors.New("boom"), FailureOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Classify(tt.err))
+		})
+	}
+}
+
+func TestFailureClass_String(t *testing.T) {
+	names := make(map[string]bool)
+
+	for class := range FailureClassCount {
+		name := FailureClass(class).String()
+		assert.False(t, names[name], "duplicate name %q", name)
+		names[name] = true
+	}
+
+	assert.Equal(t, "none", FailureNone.String())
+	assert.Equal(t, "noRoute", FailureNoRoute.String())
+	assert.Equal(t, "other", FailureClass(99).String())
+}
+
+func TestTCPProbe_RefusedClass(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	report := NewTCPProbe(addr).Execute(t.Context(), testTimeout)
+
+	assert.Equal(t, FailureRefused, report.Failure())
+}
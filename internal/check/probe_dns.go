@@ -89,13 +89,13 @@ func (p DNSProbe) Execute(ctx context.Context, timeout time.Duration) *Report {
 
 	report := BuildReport(p, start)
 	if err != nil {
-		report.error = fmt.Errorf("error resolving %s: %w", p.Domain, err)
+		report.fail(fmt.Errorf("error resolving %s: %w", p.Domain, err))
 
 		return report
 	}
 
 	if len(addr) == 0 {
-		report.error = fmt.Errorf("error resolving %s: %w", p.Domain, ErrDNSNoAddresses)
+		report.fail(fmt.Errorf("error resolving %s: %w", p.Domain, ErrDNSNoAddresses))
 
 		return report
 	}
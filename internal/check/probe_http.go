@@ -64,7 +64,7 @@ func (p *HTTPProbe) Execute(ctx context.Context, timeout time.Duration) *Report
 	if bErr != nil {
 		start := time.Now()
 		report := BuildReport(p, start)
-		report.error = fmt.Errorf("error building request to %s: %w", p.URL, bErr)
+		report.fail(fmt.Errorf("error building request to %s: %w", p.URL, bErr))
 
 		return report
 	}
@@ -76,14 +76,14 @@ func (p *HTTPProbe) Execute(ctx context.Context, timeout time.Duration) *Report
 
 	report := BuildReport(p, start)
 	if err != nil {
-		report.error = fmt.Errorf("error making request to %s: %w", p.URL, err)
+		report.fail(fmt.Errorf("error making request to %s: %w", p.URL, err))
 
 		return report
 	}
 
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil && report.error == nil {
-			report.error = fmt.Errorf("error closing response body: %w", closeErr)
+			report.fail(fmt.Errorf("error closing response body: %w", closeErr))
 		}
 	}()
 
@@ -92,5 +92,10 @@ func (p *HTTPProbe) Execute(ctx context.Context, timeout time.Duration) *Report
 
 	report.response = resp.Status
 
+	// Still a success, but recorded: the upstream may be what is down.
+	if resp.StatusCode >= http.StatusInternalServerError {
+		report.failure = FailureHTTPStatus
+	}
+
 	return report
 }
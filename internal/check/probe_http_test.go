@@ -144,3 +144,42 @@ func TestHTTPProbe_SchemeHTTPS(t *testing.T) {
 	probe := NewHTTPProbe("https://example.com")
 	assert.Equal(t, "https", probe.Scheme())
 }
+
+func TestHttpProbe_ServerErrorStatusSucceeds(t *testing.T) {
+	probe := &HTTPProbe{
+		URL: testURL,
+		client: &http.Client{
+			Transport: &fakeRoundTripper{
+				resp: &http.Response{
+					StatusCode: http.StatusBadGateway,
+					Status:     "502 Bad Gateway",
+					Body:       io.NopCloser(strings.NewReader("")),
+				},
+			},
+		},
+	}
+
+	report := probe.Execute(t.Context(), testTimeout)
+	require.NoError(t, report.error, "any answer means the connection is up")
+	assert.Equal(t, "502 Bad Gateway", report.response)
+	assert.Equal(t, FailureHTTPStatus, report.Failure(), "the status is still recorded")
+}
+
+func TestHttpProbe_ClientErrorStatusSucceeds(t *testing.T) {
+	probe := &HTTPProbe{
+		URL: testURL,
+		client: &http.Client{
+			Transport: &fakeRoundTripper{
+				resp: &http.Response{
+					StatusCode: http.StatusNotFound,
+					Status:     "404 Not Found",
+					Body:       io.NopCloser(strings.NewReader("")),
+				},
+			},
+		},
+	}
+
+	report := probe.Execute(t.Context(), testTimeout)
+	require.NoError(t, report.error)
+	assert.Equal(t, FailureNone, report.Failure())
+}
@@ -53,14 +53,14 @@ func (p TCPProbe) Execute(ctx context.Context, timeout time.Duration) *Report {
 
 	report := BuildReport(p, start)
 	if err != nil {
-		report.error = fmt.Errorf("error making request to %s: %w", p.HostPort, err)
+		report.fail(fmt.Errorf("error making request to %s: %w", p.HostPort, err))
 
 		return report
 	}
 
 	err = conn.Close()
 	if err != nil {
-		report.error = fmt.Errorf("error closing connection: %w", err)
+		report.fail(fmt.Errorf("error closing connection: %w", err))
 
 		return report
 	}
@@ -15,9 +15,11 @@ import (
 type Report struct {
 	protocol string
 	target   string
+	name     string
 	response string
 	elapsed  time.Duration
 	error    error
+	failure  FailureClass
 }
 
 // BuildReport creates a new report for the given probe.
@@ -36,11 +38,49 @@ func (r *Report) LogAttrs() slog.Attr {
 		slog.String("target", r.target),
 		slog.Duration("elapsed", r.elapsed),
 	}
+	if r.name != "" {
+		attrs = append(attrs, slog.String("name", r.name))
+	}
+
 	if r.response != "" {
 		attrs = append(attrs, slog.String("response", r.response))
+
+		if r.failure != FailureNone {
+			attrs = append(attrs, slog.String("failure", r.failure.String()))
+		}
 	} else if r.error != nil {
-		attrs = append(attrs, slog.Any("error", r.error))
+		attrs = append(attrs,
+			slog.Any("error", r.error),
+			slog.String("failure", r.failure.String()))
 	}
 
 	return slog.Group("report", attrs...)
 }
+
+// Protocol returns the scheme of the probe that produced the report.
+func (r *Report) Protocol() string { return r.protocol }
+
+// Target returns the target of the probe that produced the report.
+func (r *Report) Target() string { return r.target }
+
+// Name returns the name of the check that produced the report, if any.
+func (r *Report) Name() string { return r.name }
+
+// Response returns the probe response; empty if the probe failed.
+func (r *Report) Response() string { return r.response }
+
+// Elapsed returns how long the probe took.
+func (r *Report) Elapsed() time.Duration { return r.elapsed }
+
+// Error returns the probe error; nil if the probe succeeded.
+func (r *Report) Error() error { return r.error }
+
+// Failure returns the class of the probe error. A successful probe has
+// FailureNone, or FailureHTTPStatus for a server error answer.
+func (r *Report) Failure() FailureClass { return r.failure }
+
+// fail marks the report as failed with the given error and its class.
+func (r *Report) fail(err error) {
+	r.error = err
+	r.failure = Classify(err)
+}
@@ -42,8 +42,9 @@ func TestLogAttrs(t *testing.T) {
 				target:   "127.0.0.1:80",
 				elapsed:  456 * time.Millisecond,
 				error:    netErr,
+				failure:  FailureOther,
 			},
-			wantLen:  4,
+			wantLen:  5,
 			extraKey: "error",
 			checkFn: func(t *testing.T, v slog.Value) {
 				t.Helper()
@@ -75,6 +76,11 @@ func TestLogAttrs(t *testing.T) {
 			assert.Equal(t, "elapsed", group[2].Key)
 			assert.Equal(t, tt.report.elapsed, group[2].Value.Duration())
 
+			if tt.report.error != nil {
+				assert.Equal(t, "failure", group[4].Key)
+				assert.Equal(t, tt.report.failure.String(), group[4].Value.String())
+			}
+
 			if tt.checkFn != nil {
 				assert.Equal(t, tt.extraKey, group[3].Key)
 				tt.checkFn(t, group[3].Value)
@@ -103,3 +109,30 @@ func TestBuildReport_Target(t *testing.T) {
 	report := BuildReport(probe, time.Now())
 	assert.Equal(t, "example.com:443", report.target)
 }
+
+func TestReportAccessors(t *testing.T) {
+	err := errors.New("refused")
+	report := &Report{
+		protocol: TCP,
+		target:   "1.1.1.1:53",
+		name:     "cloudflare",
+		response: "ok",
+		elapsed:  time.Second,
+		error:    err,
+	}
+
+	assert.Equal(t, TCP, report.Protocol())
+	assert.Equal(t, "1.1.1.1:53", report.Target())
+	assert.Equal(t, "cloudflare", report.Name())
+	assert.Equal(t, "ok", report.Response())
+	assert.Equal(t, time.Second, report.Elapsed())
+	assert.Equal(t, err, report.Error())
+}
+
+func TestRunProbe_SetsName(t *testing.T) {
+	c := &Check{Probe: &fakeProbe{ret: &Report{}}, Name: "named"}
+
+	report := c.RunProbe(t.Context(), &recordChecker{})
+
+	assert.Equal(t, "named", report.Name())
+}
@@ -11,11 +11,15 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
+	"slices"
 	"syscall"
+	"time"
 
 	"github.com/hugoh/upd/internal/config"
 	"github.com/hugoh/upd/internal/logger"
 	"github.com/hugoh/upd/internal/logic"
+	"github.com/hugoh/upd/internal/notify"
 	"github.com/hugoh/upd/internal/version"
 )
 
@@ -24,8 +28,6 @@ const (
 	AppName = "upd"
 	// AppShort is the application short description.
 	AppShort = "Tool to monitor if the network connection is up."
-	// ErrChanSize is the buffer size for error channels.
-	ErrChanSize = 1
 	// SighupChanSize is the buffer size for SIGHUP channels.
 	SighupChanSize = 1
 )
@@ -35,12 +37,18 @@ const (
 	ConfigConfig string = "config"
 	// ConfigDebug is the debug flag name.
 	ConfigDebug string = "debug"
+	// ConfigDryRun is the dry run flag name.
+	ConfigDryRun string = "dry-run"
+	// ConfigSimulateOutage is the simulated outage flag name.
+	ConfigSimulateOutage string = "simulate-outage"
 )
 
 // Flags holds the parsed command-line flags.
 type Flags struct {
-	ConfigPath string
-	Debug      bool
+	ConfigPath     string
+	Debug          bool
+	DryRun         bool
+	SimulateOutage time.Duration
 }
 
 // SetupLoop initializes the loop with configuration from the given file.
@@ -55,6 +63,21 @@ func SetupLoop(loop *logic.Loop, configPath string) (*config.Configuration, erro
 		return nil, fmt.Errorf("invalid checks in configuration: %w", checkErr)
 	}
 
+	windows, err := newConf.GetMaintenance()
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance windows in configuration: %w", err)
+	}
+
+	routes, err := newConf.GetNotifications()
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications in configuration: %w", err)
+	}
+
+	digest, err := newConf.GetDigest()
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications in configuration: %w", err)
+	}
+
 	statCfg := newConf.GetStatServerConfig()
 
 	loop.Configure(checklist,
@@ -62,6 +85,15 @@ func SetupLoop(loop *logic.Loop, configPath string) (*config.Configuration, erro
 		newConf.GetDownAction(),
 		statCfg.Buckets,
 		statCfg.Reports...)
+	loop.SetMaintenance(windows)
+	loop.SetDiagnoser(newConf.GetDiagnoser())
+	loop.SetName(newConf.GetName())
+	loop.SetMQTT(newConf.GetMQTT())
+	loop.SetDigest(digest)
+
+	if err := loop.SetNotifications(newConf.GetNotifyQueue(), routes); err != nil {
+		return nil, fmt.Errorf("invalid notifications in configuration: %w", err)
+	}
 
 	return newConf, nil
 }
@@ -79,91 +111,154 @@ func Run(appCtx context.Context, flags Flags) error {
 	defer signal.Stop(sighupCh)
 
 	loop := logic.NewLoop()
+	loop.SetDryRun(flags.DryRun)
 
-	for {
-		if rootCtx.Err() != nil {
-			logger.App().Info("shutting down")
-
-			return nil
-		}
-
-		currentWorkerCtx, cancelCurrentWorker := context.WithCancel(rootCtx)
-
-		errCh := make(chan error, ErrChanSize)
-		done := make(chan struct{})
-
-		go func(ctx context.Context) {
-			defer close(done)
-
-			newConf, err := SetupLoop(loop, flags.ConfigPath)
-			if err != nil {
-				errCh <- fmt.Errorf("cannot configure app: %w", err)
-
-				return
-			}
+	conf, err := SetupLoop(loop, flags.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("cannot configure app: %w", err)
+	}
 
-			errCh <- nil
+	workerCtx, cancelWorker := context.WithCancel(rootCtx)
+	done := make(chan struct{})
 
-			loop.Run(ctx, newConf.GetStatServerConfig())
-			loop.Stop(ctx)
-		}(currentWorkerCtx)
+	go func() {
+		defer close(done)
 
-		err := waitForWorker(rootCtx, sighupCh, errCh, done, cancelCurrentWorker)
-		if err != nil {
-			return err
-		}
-	}
-}
+		loop.Run(workerCtx, conf.GetStatServerConfig())
+		loop.Stop(workerCtx)
+	}()
 
-// waitForWorker blocks until the current worker needs to be replaced or the
-// application should terminate. It keeps handling shutdown and reload signals
-// while the worker is running. A non-nil return value terminates the
-// application.
-func waitForWorker(
-	rootCtx context.Context,
-	sighupCh <-chan os.Signal,
-	errCh <-chan error,
-	done <-chan struct{},
-	cancelWorker context.CancelFunc,
-) error {
 	stopWorker := func() {
 		cancelWorker()
 		<-done
 	}
 
+	if flags.SimulateOutage > 0 {
+		// Applied once the first check has told whether the connection is up.
+		if err := loop.SimulateOutage(workerCtx, flags.SimulateOutage); err != nil {
+			stopWorker()
+
+			return fmt.Errorf("cannot simulate outage: %w", err)
+		}
+	}
+
 	for {
 		select {
 		case <-rootCtx.Done():
+			logger.App().Info("shutting down")
 			stopWorker()
 
 			return nil
-		case err := <-errCh:
+		case <-sighupCh:
+			logger.App().Info("SIGHUP received: reloading configuration")
+
+			newConf, err := ReloadLoop(workerCtx, loop, conf, flags.ConfigPath)
 			if err != nil {
 				stopWorker()
 
-				return err
+				return fmt.Errorf("cannot reload configuration: %w", err)
 			}
-			// Configuration loaded; keep waiting for signals.
-		case <-sighupCh:
-			logger.App().Info("SIGHUP received: reloading configuration")
-			stopWorker()
 
-			return nil
+			conf = newConf
 		case <-done:
-			// Worker exited on its own; surface a pending error if any.
-			select {
-			case err := <-errCh:
-				if err != nil {
-					return err
-				}
-			default:
-			}
+			// Worker exited on its own.
+			cancelWorker()
 
 			return nil
 		}
 	}
 }
 
+// ReloadLoop reads the configuration again and applies what changed to the
+// running loop: the checks, the statistics server and an in-flight down
+// action are kept unless their own settings changed.
+func ReloadLoop(
+	ctx context.Context,
+	loop *logic.Loop,
+	oldConf *config.Configuration,
+	configPath string,
+) (*config.Configuration, error) {
+	newConf, err := config.ReadConf(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading configuration: %w", err)
+	}
+
+	checklist, err := newConf.GetChecks()
+	if err != nil {
+		return nil, fmt.Errorf("invalid checks in configuration: %w", err)
+	}
+
+	windows, err := newConf.GetMaintenance()
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance windows in configuration: %w", err)
+	}
+
+	routes, err := newConf.GetNotifications()
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications in configuration: %w", err)
+	}
+
+	digest, err := newConf.GetDigest()
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications in configuration: %w", err)
+	}
+
+	oldStat := oldConf.GetStatServerConfig()
+	newStat := newConf.GetStatServerConfig()
+	// Keeping the checks keeps their adaptive order and open breakers.
+	checksChanged := !reflect.DeepEqual(oldConf.Checks, newConf.Checks)
+	reportsChanged := !slices.Equal(oldStat.Reports, newStat.Reports) || oldStat.Buckets != newStat.Buckets
+	downActionChanged := !reflect.DeepEqual(oldConf.DownAction, newConf.DownAction)
+	// Restarting notifications retries their pending messages at once.
+	notifyChanged := !reflect.DeepEqual(oldConf.Notify, newConf.Notify) ||
+		oldConf.NotifyQueue != newConf.NotifyQueue
+
+	var notifyErr error
+
+	err = loop.Reload(ctx, func() {
+		if checksChanged {
+			loop.SetChecks(checklist, newConf.GetDelays())
+		}
+
+		if reportsChanged {
+			loop.SetReports(newStat.Buckets, newStat.Reports...)
+		}
+
+		if downActionChanged {
+			loop.SetDownAction(ctx, newConf.GetDownAction())
+		}
+
+		loop.SetMaintenance(windows)
+
+		if notifyChanged {
+			notifyErr = loop.SetNotifications(newConf.GetNotifyQueue(), routes)
+		}
+
+		loop.SetDiagnoser(newConf.GetDiagnoser())
+		loop.SetName(newConf.GetName())
+		loop.SetMQTT(newConf.GetMQTT())
+		loop.SetDigest(digest)
+		loop.SetStatServerConfig(ctx, newStat)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("applying configuration: %w", err)
+	}
+
+	// The rest of the configuration applies: only notifications are off.
+	if notifyErr != nil {
+		logger.App().Error("cannot start notifications", "error", notifyErr)
+	}
+
+	loop.Notify(notify.Event{Type: notify.EventConfigReloaded})
+
+	logger.App().Info("configuration reloaded",
+		"checksChanged", checksChanged, "reportsChanged", reportsChanged,
+		"downActionChanged", downActionChanged,
+		"notifyChanged", notifyChanged)
+
+	return newConf, nil
+}
+
 // ParseFlags parses the given command-line arguments (excluding the program
 // name) into Flags. It returns flag.ErrHelp when --help or --version was
 // requested and already handled, in which case the caller should exit
@@ -198,6 +293,10 @@ func ParseFlags(args []string) (Flags, error) {
 	flagSet.StringVar(&flags.ConfigPath, "c", config.DefaultConfig, "shorthand for --"+ConfigConfig)
 	flagSet.BoolVar(&flags.Debug, ConfigDebug, false, "display debugging output in the console")
 	flagSet.BoolVar(&flags.Debug, "d", false, "shorthand for --"+ConfigDebug)
+	flagSet.BoolVar(&flags.DryRun, ConfigDryRun, false,
+		"log and report down actions instead of running them")
+	flagSet.DurationVar(&flags.SimulateOutage, ConfigSimulateOutage, 0,
+		"with dry runs, run the down action as if the connection went down for this long once started")
 	flagSet.BoolVar(&showVersion, "version", false, "print the version and exit")
 
 	if err := flagSet.Parse(args); err != nil {
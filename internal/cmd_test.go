@@ -5,6 +5,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -140,3 +141,137 @@ func TestSetupLoop_reload(t *testing.T) {
 	assert.Equal(t, 10*time.Second, conf.GetDelays().Up)
 	assert.Equal(t, 2*time.Second, conf.GetDelays().Down)
 }
+
+func TestReloadLoop_keepsUnchangedDownAction(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "upd.toml")
+	runs := filepath.Join(dir, "runs")
+
+	writeConf := func(down, mark string) {
+		t.Helper()
+
+		conf := `[checks]
+timeout = "100ms"
+
+[checks.every]
+normal = "1s"
+down = "` + down + `"
+
+[checks.list]
+ordered = ["tcp://127.0.0.1:1"]
+
+[downAction]
+exec = "sh -c 'echo ` + mark + ` >> ` + runs + `'"
+
+[downAction.every]
+after = "1ms"
+repeat = "1h"
+`
+		require.NoError(t, os.WriteFile(cfgPath, []byte(conf), 0o600)) // #nosec G703 -- path under t.TempDir()
+	}
+
+	readRuns := func() []string {
+		data, _ := os.ReadFile(runs) // #nosec G304 -- path under t.TempDir()
+
+		return strings.Fields(string(data))
+	}
+
+	writeConf("50ms", "first")
+
+	loop := logic.NewLoop()
+	conf, err := SetupLoop(loop, cfgPath)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		loop.Run(ctx, conf.GetStatServerConfig())
+		loop.Stop(ctx)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.Eventually(t, func() bool { return len(readRuns()) == 1 },
+		2*time.Second, 10*time.Millisecond, "down action should run once")
+
+	// Only the check delays change: the down action keeps its schedule.
+	writeConf("60ms", "first")
+	conf, err = ReloadLoop(ctx, loop, conf, cfgPath)
+	require.NoError(t, err)
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, []string{"first"}, readRuns())
+
+	// The down action changes: it restarts with the new settings.
+	writeConf("60ms", "second")
+	_, err = ReloadLoop(ctx, loop, conf, cfgPath)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(readRuns()) == 2 },
+		2*time.Second, 10*time.Millisecond, "changed down action should restart")
+	assert.Equal(t, []string{"first", "second"}, readRuns())
+}
+
+func TestParseFlags_DryRun(t *testing.T) {
+	flags, err := ParseFlags([]string{"--dry-run", "--simulate-outage", "90s"})
+	require.NoError(t, err)
+	assert.True(t, flags.DryRun)
+	assert.Equal(t, 90*time.Second, flags.SimulateOutage)
+
+	flags, err = ParseFlags(nil)
+	require.NoError(t, err)
+	assert.False(t, flags.DryRun)
+	assert.Zero(t, flags.SimulateOutage)
+}
+
+func TestReloadLoop_notifiesReload(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "upd.toml")
+	out := filepath.Join(dir, "notifications")
+
+	conf := `name = "lab"
+
+[checks]
+timeout = "100ms"
+
+[checks.every]
+normal = "1h"
+down = "1h"
+
+[checks.list]
+ordered = ["tcp://127.0.0.1:1"]
+
+[[notify]]
+events = ["configReloaded"]
+exec = "sh -c 'cat >> ` + out + `; echo >> ` + out + `'"
+`
+	require.NoError(t, os.WriteFile(cfgPath, []byte(conf), 0o600)) // #nosec G703 -- path under t.TempDir()
+
+	loop := logic.NewLoop()
+	oldConf, err := SetupLoop(loop, cfgPath)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		loop.Run(ctx, oldConf.GetStatServerConfig())
+	}()
+
+	_, err = ReloadLoop(ctx, loop, oldConf, cfgPath)
+	require.NoError(t, err)
+
+	cancel()
+	<-done
+	loop.Stop(t.Context())
+
+	data, err := os.ReadFile(out) // #nosec G304 -- path under t.TempDir()
+	require.NoError(t, err)
+	assert.Equal(t, "lab: configuration reloaded\n", string(data))
+}
@@ -8,6 +8,9 @@
 // - Network connectivity checks (HTTP, TCP, DNS)
 // - Check intervals (normal and down states)
 // - Down actions to execute when connection fails
+// - Maintenance windows suppressing down actions
+// - Notification sinks for connection and down action events
+// - MQTT publishing of the state, with Home Assistant discovery
 // - Statistics server configuration
 // - Logging configuration
 //
@@ -33,6 +36,28 @@
 //	after = "60s"
 //	repeat = "300s"
 //
+//	[[maintenance]]
+//	days = ["tue"]
+//	start = "02:00"
+//	end = "05:00"
+//
+//	[[notify]]
+//	events = ["down", "up"]
+//	exec = "logger -t upd"
+//
+//	[notifyQueue]
+//	dir = "/var/lib/upd/notify"
+//
+//	[notifyDigest]
+//	every = "daily"
+//
+//	[diagnosis]
+//	enabled = true
+//
+//	[mqtt]
+//	broker = "mqtt://localhost:1883"
+//	discovery = true
+//
 //	[stats]
 //	port = 8080
 //
@@ -49,20 +74,28 @@
 package config
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hugoh/upd/internal/check"
+	"github.com/hugoh/upd/internal/diagnosis"
 	"github.com/hugoh/upd/internal/logger"
 	"github.com/hugoh/upd/internal/logic"
+	"github.com/hugoh/upd/internal/mqtt"
+	"github.com/hugoh/upd/internal/notify"
+	"github.com/hugoh/upd/internal/schedule"
 	"github.com/hugoh/upd/internal/status"
 	"github.com/pelletier/go-toml/v2"
 )
@@ -78,17 +111,36 @@ type ChecksEveryConfig struct {
 	Down   Duration `toml:"down"`
 }
 
+// Shuffled check ordering modes.
+const (
+	// ShuffledOrderRandom tries shuffled checks in a uniformly random order.
+	ShuffledOrderRandom = "random"
+	// ShuffledOrderAdaptive tries shuffled checks with the best recent
+	// success rate and latency first.
+	ShuffledOrderAdaptive = "adaptive"
+)
+
 // ChecksListConfig holds the ordered and shuffled check URI lists.
 type ChecksListConfig struct {
-	Ordered  []string `toml:"ordered"`
-	Shuffled []string `toml:"shuffled"`
+	Ordered       []string `toml:"ordered"`
+	Shuffled      []string `toml:"shuffled"`
+	ShuffledOrder string   `toml:"shuffledOrder"`
+}
+
+// ChecksBreakerConfig holds the per-probe circuit breaker settings.
+type ChecksBreakerConfig struct {
+	Threshold   int      `toml:"threshold"`
+	Cooldown    Duration `toml:"cooldown"`
+	MaxCooldown Duration `toml:"maxCooldown"`
 }
 
 // ChecksConfig holds the connectivity check settings.
 type ChecksConfig struct {
-	Every   ChecksEveryConfig `toml:"every"`
-	List    ChecksListConfig  `toml:"list"`
-	TimeOut Duration          `toml:"timeout"`
+	Every      ChecksEveryConfig   `toml:"every"`
+	List       ChecksListConfig    `toml:"list"`
+	Breaker    ChecksBreakerConfig `toml:"breaker"`
+	TimeOut    Duration            `toml:"timeout"`
+	Exhaustive bool                `toml:"exhaustive"`
 }
 
 // DownActionEveryConfig holds the down action scheduling settings.
@@ -98,11 +150,237 @@ type DownActionEveryConfig struct {
 	BackoffLimit Duration `toml:"expBackoffLimit"`
 }
 
+// WebhookConfig holds an HTTP request sent as a down or up action.
+type WebhookConfig struct {
+	Method       string            `toml:"method"`
+	URL          string            `toml:"url"`
+	Headers      map[string]string `toml:"headers"`
+	Body         string            `toml:"body"`
+	Timeout      Duration          `toml:"timeout"`
+	SuccessCodes []int             `toml:"successCodes"`
+}
+
+// PowerCycleConfig holds a smart plug power cycle action. Retries defaults to
+// logic.DefaultPowerCycleRetries when unset; 0 disables retries.
+type PowerCycleConfig struct {
+	Firmware   string   `toml:"firmware"`
+	Host       string   `toml:"host"`
+	Relay      int      `toml:"relay"`
+	OffFor     Duration `toml:"offFor"`
+	Retries    *int     `toml:"retries"`
+	RetryDelay Duration `toml:"retryDelay"`
+	Timeout    Duration `toml:"timeout"`
+	User       string   `toml:"user"`
+	Password   string   `toml:"password"`
+}
+
+// powerCycle converts the configuration, returning nil when it is not set.
+func (p *PowerCycleConfig) powerCycle() *logic.PowerCycle {
+	if p == nil {
+		return nil
+	}
+
+	// An explicit 0 disables retries; logic takes 0 as the default.
+	var retries int
+	if p.Retries != nil {
+		retries = *p.Retries
+		if retries == 0 {
+			retries = logic.NoPowerCycleRetries
+		}
+	}
+
+	return &logic.PowerCycle{
+		Firmware:   p.Firmware,
+		Host:       p.Host,
+		Relay:      p.Relay,
+		OffFor:     p.OffFor.StdDuration(),
+		Retries:    retries,
+		RetryDelay: p.RetryDelay.StdDuration(),
+		Timeout:    p.Timeout.StdDuration(),
+		User:       p.User,
+		Password:   p.Password,
+	}
+}
+
+// Backoff strategies.
+const (
+	// BackoffExponential multiplies the delay by factor at each repetition.
+	BackoffExponential = "exponential"
+	// BackoffFixed repeats at a constant interval.
+	BackoffFixed = "fixed"
+	// BackoffLinear adds step to the delay at each repetition.
+	BackoffLinear = "linear"
+	// BackoffSchedule waits each delay of schedule in turn.
+	BackoffSchedule = "schedule"
+)
+
+// BackoffConfig selects how a down action repeats, exponential by default.
+// Except for the schedule strategy, the first delay is every.repeat and
+// delays are capped by every.expBackoffLimit.
+type BackoffConfig struct {
+	Strategy string     `toml:"strategy"`
+	Factor   float64    `toml:"factor"`
+	Step     Duration   `toml:"step"`
+	Schedule []Duration `toml:"schedule"`
+	Jitter   float64    `toml:"jitter"`
+}
+
+// backoff returns the strategy, nil for the default exponential backoff.
+//
+//nolint:ireturn // strategies are pluggable
+func (b BackoffConfig) backoff(every, limit Duration) logic.Backoff {
+	switch b.Strategy {
+	case BackoffFixed:
+		return logic.FixedBackoff{Every: every.StdDuration()}
+	case BackoffLinear:
+		step := b.Step
+		if step == 0 {
+			step = every
+		}
+
+		return logic.LinearBackoff{
+			Every: every.StdDuration(),
+			Step:  step.StdDuration(),
+			Limit: limit.StdDuration(),
+		}
+	case BackoffSchedule:
+		delays := make(logic.ScheduleBackoff, len(b.Schedule))
+		for i, d := range b.Schedule {
+			delays[i] = d.StdDuration()
+		}
+
+		return delays
+	default:
+		if b.Factor == 0 {
+			return nil
+		}
+
+		return logic.ExponentialBackoff{
+			Every:  every.StdDuration(),
+			Factor: b.Factor,
+			Limit:  limit.StdDuration(),
+		}
+	}
+}
+
+// DownActionStageConfig holds one stage of a down action escalation ladder.
+type DownActionStageConfig struct {
+	Name         string            `toml:"name"`
+	After        Duration          `toml:"after"`
+	Exec         string            `toml:"exec"`
+	Webhook      *WebhookConfig    `toml:"webhook"`
+	PowerCycle   *PowerCycleConfig `toml:"powerCycle"`
+	Repeat       Duration          `toml:"repeat"`
+	BackoffLimit Duration          `toml:"expBackoffLimit"`
+	Backoff      BackoffConfig     `toml:"backoff"`
+}
+
+// ExitCodesConfig gives meaning to down command exit codes. 0 disables a code.
+type ExitCodesConfig struct {
+	Recheck int `toml:"recheck"`
+	GiveUp  int `toml:"giveUp"`
+}
+
+// LimitsConfig caps how often down actions run, across outages.
+type LimitsConfig struct {
+	MaxPerDay   int      `toml:"maxPerDay"`
+	MinInterval Duration `toml:"minInterval"`
+}
+
+// CommandConfig sets up the process of down action commands. Umask is in
+// octal, such as "027". When envAllow is set, only the listed variables of
+// the environment of upd are passed on.
+type CommandConfig struct {
+	User     string            `toml:"user"`
+	Group    string            `toml:"group"`
+	Dir      string            `toml:"dir"`
+	EnvAllow []string          `toml:"envAllow"`
+	Env      map[string]string `toml:"env"`
+	Umask    string            `toml:"umask"`
+	Timeout  Duration          `toml:"timeout"`
+}
+
+func (c CommandConfig) configured() bool {
+	return c.User != "" || c.Group != "" || c.Dir != "" || c.EnvAllow != nil ||
+		len(c.Env) > 0 || c.Umask != "" || c.Timeout != 0
+}
+
+// options returns the runtime command options, failing on an invalid umask.
+func (c CommandConfig) options() (logic.CommandOptions, error) {
+	opts := logic.CommandOptions{
+		User:     c.User,
+		Group:    c.Group,
+		Dir:      c.Dir,
+		EnvAllow: c.EnvAllow,
+		Timeout:  c.Timeout.StdDuration(),
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Env)) {
+		opts.Env = append(opts.Env, name+"="+c.Env[name])
+	}
+
+	if c.Umask != "" {
+		mask, err := strconv.ParseUint(c.Umask, 8, 32)
+		if err != nil || mask > uint64(os.ModePerm) {
+			return opts, errInvalidUmask
+		}
+
+		umask := os.FileMode(mask)
+		opts.Umask = &umask
+	}
+
+	return opts, nil
+}
+
 // DownActionConfig holds the down action settings.
 type DownActionConfig struct {
-	Exec     string                `toml:"exec"`
-	Every    DownActionEveryConfig `toml:"every"`
-	StopExec string                `toml:"stopExec"`
+	Exec        string                  `toml:"exec"`
+	Webhook     *WebhookConfig          `toml:"webhook"`
+	PowerCycle  *PowerCycleConfig       `toml:"powerCycle"`
+	Every       DownActionEveryConfig   `toml:"every"`
+	Backoff     BackoffConfig           `toml:"backoff"`
+	StopExec    string                  `toml:"stopExec"`
+	StopWebhook *WebhookConfig          `toml:"stopWebhook"`
+	Stages      []DownActionStageConfig `toml:"stages"`
+	StdinJSON   bool                    `toml:"stdinJSON"`
+	ExitCodes   ExitCodesConfig         `toml:"exitCodes"`
+	Limits      LimitsConfig            `toml:"limits"`
+	Command     CommandConfig           `toml:"command"`
+	// StateFile persists the down action schedule across restarts.
+	StateFile string `toml:"stateFile"`
+	// FailureBudget is how many commands may fail during an outage before
+	// the down action gives up. 0 means unlimited.
+	FailureBudget int `toml:"failureBudget"`
+	// KillGrace is how long terminated commands may take to exit.
+	KillGrace Duration `toml:"killGrace"`
+	// DryRun logs and reports the actions instead of running them.
+	DryRun bool `toml:"dryRun"`
+}
+
+// configured reports whether any down action setting is present.
+func (d DownActionConfig) configured() bool {
+	return d.Exec != "" || d.Webhook != nil || d.PowerCycle != nil ||
+		d.Every != (DownActionEveryConfig{}) || d.Backoff.Strategy != "" ||
+		d.StopExec != "" || d.StopWebhook != nil || len(d.Stages) > 0 || d.StdinJSON ||
+		d.ExitCodes != (ExitCodesConfig{}) || d.FailureBudget != 0 ||
+		d.Limits != (LimitsConfig{}) || d.StateFile != "" || d.KillGrace != 0 ||
+		d.DryRun || d.Command.configured()
+}
+
+// webhook converts the configuration, returning nil when it is not set.
+func (w *WebhookConfig) webhook() *logic.Webhook {
+	if w == nil {
+		return nil
+	}
+
+	return &logic.Webhook{
+		Method:       w.Method,
+		URL:          w.URL,
+		Headers:      w.Headers,
+		Body:         w.Body,
+		Timeout:      w.Timeout.StdDuration(),
+		SuccessCodes: w.SuccessCodes,
+	}
 }
 
 // StatsBucketsConfig tunes probe-stat bucket granularity for report periods.
@@ -121,12 +399,110 @@ type StatsConfig struct {
 	IdleTimeout  Duration           `toml:"idleTimeout"`
 }
 
+// DiagnosisConfig holds the outage diagnosis settings.
+type DiagnosisConfig struct {
+	Enabled     bool     `toml:"enabled"`
+	Gateway     string   `toml:"gateway"`
+	ISPHop      string   `toml:"ispHop"`
+	PublicIPs   []string `toml:"publicIPs"`
+	PublicNames []string `toml:"publicNames"`
+	Port        int      `toml:"port"`
+	Timeout     Duration `toml:"timeout"`
+}
+
+// MaintenanceConfig holds a recurring maintenance window, such as an ISP's
+// published one. Start and End are times of day in 15:04 form, in Timezone
+// (an IANA name, UTC if empty). An End not after Start ends on the next day.
+type MaintenanceConfig struct {
+	Name                    string   `toml:"name"`
+	Days                    []string `toml:"days"`
+	Start                   string   `toml:"start"`
+	End                     string   `toml:"end"`
+	Timezone                string   `toml:"timezone"`
+	ExcludeFromAvailability bool     `toml:"excludeFromAvailability"`
+}
+
+// NotifyConfig holds a notification sink, one of Webhook, Exec or Email, and
+// the events sent to it: all when Events is empty, or only up for emails.
+// Template and Subject are text/templates rendered with the event.
+type NotifyConfig struct {
+	Name     string               `toml:"name"`
+	Events   []string             `toml:"events"`
+	Template string               `toml:"template"`
+	Subject  string               `toml:"subject"`
+	Timeout  Duration             `toml:"timeout"`
+	Webhook  *NotifyWebhookConfig `toml:"webhook"`
+	Exec     string               `toml:"exec"`
+	Email    *NotifyEmailConfig   `toml:"email"`
+}
+
+// NotifyWebhookConfig holds a webhook notification sink.
+type NotifyWebhookConfig struct {
+	Method  string            `toml:"method"`
+	URL     string            `toml:"url"`
+	Headers map[string]string `toml:"headers"`
+}
+
+// NotifyEmailConfig holds an email notification sink. Server is the host:port
+// of the SMTP server; Security is one of starttls (the default), tls and
+// none.
+type NotifyEmailConfig struct {
+	Server   string   `toml:"server"`
+	Security string   `toml:"security"`
+	Username string   `toml:"username"`
+	Password string   `toml:"password"`
+	From     string   `toml:"from"`
+	To       []string `toml:"to"`
+}
+
+// NotifyDigestConfig schedules the digest event, sent Every day or week At a
+// time of day in 15:04 form, on Day for weekly digests, in Timezone (an IANA
+// name, UTC if empty).
+type NotifyDigestConfig struct {
+	Every    string `toml:"every"`
+	At       string `toml:"at"`
+	Day      string `toml:"day"`
+	Timezone string `toml:"timezone"`
+}
+
+// NotifyQueueConfig holds where and how long the notifications that could not
+// be delivered are kept for retries.
+type NotifyQueueConfig struct {
+	Dir        string   `toml:"dir"`
+	MaxAge     Duration `toml:"maxAge"`
+	RetryMin   Duration `toml:"retryMin"`
+	RetryMax   Duration `toml:"retryMax"`
+	MaxPending int      `toml:"maxPending"`
+}
+
+// MQTTConfig holds the MQTT broker the state is published on, with Home
+// Assistant discovery when Discovery is set. Messages on CommandTopic
+// trigger a check.
+type MQTTConfig struct {
+	Broker          string   `toml:"broker"`
+	ClientID        string   `toml:"clientID"`
+	Username        string   `toml:"username"`
+	Password        string   `toml:"password"`
+	KeepAlive       Duration `toml:"keepAlive"`
+	Topic           string   `toml:"topic"`
+	Discovery       bool     `toml:"discovery"`
+	DiscoveryPrefix string   `toml:"discoveryPrefix"`
+	CommandTopic    string   `toml:"commandTopic"`
+}
+
 // Configuration holds all application settings.
 type Configuration struct {
-	Checks     ChecksConfig     `toml:"checks"`
-	DownAction DownActionConfig `toml:"downAction"`
-	Stats      StatsConfig      `toml:"stats"`
-	LogLevel   string           `toml:"logLevel"`
+	Checks       ChecksConfig        `toml:"checks"`
+	DownAction   DownActionConfig    `toml:"downAction"`
+	Maintenance  []MaintenanceConfig `toml:"maintenance"`
+	Notify       []NotifyConfig      `toml:"notify"`
+	NotifyQueue  NotifyQueueConfig   `toml:"notifyQueue"`
+	NotifyDigest NotifyDigestConfig  `toml:"notifyDigest"`
+	Diagnosis    DiagnosisConfig     `toml:"diagnosis"`
+	MQTT         MQTTConfig          `toml:"mqtt"`
+	Stats        StatsConfig         `toml:"stats"`
+	LogLevel     string              `toml:"logLevel"`
+	Name         string              `toml:"name"`
 }
 
 func configError(msg string, path string, err error) (*Configuration, error) {
@@ -218,7 +594,24 @@ func (c Configuration) GetChecks() (*check.List, error) {
 		return nil, ErrNoChecks
 	}
 
-	return &check.List{Ordered: ordered, Shuffled: shuffled}, nil
+	list := &check.List{
+		Ordered:    ordered,
+		Shuffled:   shuffled,
+		Exhaustive: c.Checks.Exhaustive,
+	}
+	if c.Checks.List.ShuffledOrder == ShuffledOrderAdaptive {
+		list.Adaptive = check.NewAdaptiveOrder(check.DefaultExploreRate)
+	}
+
+	if c.Checks.Breaker.Threshold > 0 {
+		list.Breakers = check.NewBreakers(check.BreakerConfig{
+			Threshold:   c.Checks.Breaker.Threshold,
+			Cooldown:    c.Checks.Breaker.Cooldown.StdDuration(),
+			MaxCooldown: c.Checks.Breaker.MaxCooldown.StdDuration(),
+		})
+	}
+
+	return list, nil
 }
 
 //nolint:ireturn // intentionally returns interface to abstract probe creation
@@ -253,6 +646,10 @@ func (c Configuration) GetChecksCat(category []string) ([]*check.Check, error) {
 			return nil, fmt.Errorf("could not parse check %q: %w", checkStr, err)
 		}
 
+		// The URI fragment, if any, names the check in reports.
+		name := parsedURL.Fragment
+		parsedURL.Fragment = ""
+
 		probe, err := probeFromURL(parsedURL)
 		if err != nil {
 			return nil, fmt.Errorf("check %q: %w", checkStr, err)
@@ -261,6 +658,7 @@ func (c Configuration) GetChecksCat(category []string) ([]*check.Check, error) {
 		checks = append(checks, &check.Check{
 			Probe:   probe,
 			Timeout: c.Checks.TimeOut.StdDuration(),
+			Name:    name,
 		})
 	}
 
@@ -269,19 +667,353 @@ func (c Configuration) GetChecksCat(category []string) ([]*check.Check, error) {
 
 // GetDownAction creates a DownAction from the configuration.
 func (c Configuration) GetDownAction() *logic.DownAction {
-	if c.DownAction == (DownActionConfig{}) {
+	if !c.DownAction.configured() {
 		return nil
 	}
 
+	var stages []logic.DownActionStage
+
+	for _, stage := range c.DownAction.Stages {
+		stages = append(stages, logic.DownActionStage{
+			Name:         stage.Name,
+			After:        stage.After.StdDuration(),
+			Every:        stage.Repeat.StdDuration(),
+			BackoffLimit: stage.BackoffLimit.StdDuration(),
+			Backoff:      stage.Backoff.backoff(stage.Repeat, stage.BackoffLimit),
+			Jitter:       stage.Backoff.Jitter,
+			Exec:         stage.Exec,
+			Webhook:      stage.Webhook.webhook(),
+			PowerCycle:   stage.PowerCycle.powerCycle(),
+		})
+	}
+
+	every := c.DownAction.Every
+	// The umask was validated when reading the configuration.
+	command, _ := c.DownAction.Command.options()
+
 	return &logic.DownAction{
 		After:        c.DownAction.Every.After.StdDuration(),
 		Every:        c.DownAction.Every.Repeat.StdDuration(),
 		BackoffLimit: c.DownAction.Every.BackoffLimit.StdDuration(),
+		Backoff:      c.DownAction.Backoff.backoff(every.Repeat, every.BackoffLimit),
+		Jitter:       c.DownAction.Backoff.Jitter,
 		Exec:         c.DownAction.Exec,
+		Webhook:      c.DownAction.Webhook.webhook(),
+		PowerCycle:   c.DownAction.PowerCycle.powerCycle(),
 		StopExec:     c.DownAction.StopExec,
+		StopWebhook:  c.DownAction.StopWebhook.webhook(),
+		Stages:       stages,
+		StdinJSON:    c.DownAction.StdinJSON,
+
+		RecheckExitCode: c.DownAction.ExitCodes.Recheck,
+		GiveUpExitCode:  c.DownAction.ExitCodes.GiveUp,
+		FailureBudget:   c.DownAction.FailureBudget,
+		MaxPerDay:       c.DownAction.Limits.MaxPerDay,
+		MinInterval:     c.DownAction.Limits.MinInterval.StdDuration(),
+		KillGrace:       c.DownAction.KillGrace.StdDuration(),
+		Command:         command,
+		State:           c.DownAction.stateFile(),
+		DryRun:          c.DownAction.DryRun,
 	}
 }
 
+// stateFile returns the down action state file, nil when not configured.
+func (d DownActionConfig) stateFile() *logic.StateFile {
+	if d.StateFile == "" {
+		return nil
+	}
+
+	return logic.NewStateFile(d.StateFile)
+}
+
+// GetDiagnoser creates the outage diagnoser, or returns nil when diagnosis
+// is disabled.
+//
+//nolint:ireturn // nil interface disables diagnosis on the loop
+func (c Configuration) GetDiagnoser() logic.Diagnoser {
+	if !c.Diagnosis.Enabled {
+		return nil
+	}
+
+	return diagnosis.New(diagnosis.Config{
+		Gateway:     c.Diagnosis.Gateway,
+		ISPHop:      c.Diagnosis.ISPHop,
+		PublicIPs:   c.Diagnosis.PublicIPs,
+		PublicNames: c.Diagnosis.PublicNames,
+		Port:        c.Diagnosis.Port,
+		Timeout:     c.Diagnosis.Timeout.StdDuration(),
+	})
+}
+
+// GetMQTT returns the MQTT publisher configuration, nil when no broker is
+// configured. Availability is published for the report periods.
+func (c Configuration) GetMQTT() *mqtt.Config {
+	if c.MQTT.Broker == "" {
+		return nil
+	}
+
+	return &mqtt.Config{
+		Options:         c.MQTT.options(),
+		Topic:           c.MQTT.Topic,
+		Discovery:       c.MQTT.Discovery,
+		DiscoveryPrefix: c.MQTT.DiscoveryPrefix,
+		CommandTopic:    c.MQTT.CommandTopic,
+		Name:            c.GetName(),
+		Reports:         c.GetStatServerConfig().Reports,
+	}
+}
+
+func (m MQTTConfig) options() mqtt.Options {
+	return mqtt.Options{
+		Broker:    m.Broker,
+		ClientID:  m.ClientID,
+		Username:  m.Username,
+		Password:  m.Password,
+		KeepAlive: m.KeepAlive.StdDuration(),
+	}
+}
+
+// GetMaintenance returns the maintenance windows.
+func (c Configuration) GetMaintenance() (schedule.Schedule, error) {
+	windows := make(schedule.Schedule, 0, len(c.Maintenance))
+
+	for idx, m := range c.Maintenance {
+		w, err := m.window()
+		if err != nil {
+			return nil, fmt.Errorf("maintenance[%d]: %w", idx, err)
+		}
+
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
+
+// GetNotifications returns the notification routes.
+func (c Configuration) GetNotifications() ([]notify.Route, error) {
+	routes := make([]notify.Route, 0, len(c.Notify))
+
+	// Notification commands run like down action commands.
+	opts, _ := c.DownAction.Command.options()
+
+	for idx, n := range c.Notify {
+		r, err := n.route(idx, &opts)
+		if err != nil {
+			return nil, fmt.Errorf("notify[%d]: %w", idx, err)
+		}
+
+		routes = append(routes, r)
+	}
+
+	return routes, nil
+}
+
+// GetNotifyQueue returns the queue of undelivered notifications.
+func (c Configuration) GetNotifyQueue() notify.Queue {
+	return notify.Queue{
+		Dir:        c.NotifyQueue.Dir,
+		MaxAge:     c.NotifyQueue.MaxAge.StdDuration(),
+		RetryMin:   c.NotifyQueue.RetryMin.StdDuration(),
+		RetryMax:   c.NotifyQueue.RetryMax.StdDuration(),
+		MaxPending: c.NotifyQueue.MaxPending,
+	}
+}
+
+// Digest periods.
+const (
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+	// defaultDigestAt is when digests are sent when unset.
+	defaultDigestAt = "08:00"
+)
+
+// GetDigest returns the digest schedule, nil when digests are disabled.
+func (c Configuration) GetDigest() (*logic.Digest, error) {
+	if c.NotifyDigest.Every == "" {
+		return nil, nil //nolint:nilnil // no digest is not an error
+	}
+
+	digest, err := c.NotifyDigest.digest()
+	if err != nil {
+		return nil, fmt.Errorf("notifyDigest: %w", err)
+	}
+
+	return digest, nil
+}
+
+func (d NotifyDigestConfig) digest() (*logic.Digest, error) {
+	var errs []error
+
+	digest := &logic.Digest{Period: 24 * time.Hour}
+
+	switch d.Every {
+	case digestDaily:
+		if d.Day != "" {
+			errs = appendErr(errs, "day", errDigestDayUnused)
+		}
+	case digestWeekly:
+		digest.Period = 7 * 24 * time.Hour
+
+		wd, err := schedule.ParseWeekday(cmp.Or(d.Day, "mon"))
+		errs = appendErr(errs, "day", err)
+		digest.At.Days = []time.Weekday{wd}
+	default:
+		errs = appendErr(errs, "every", errInvalidDigestEvery)
+	}
+
+	at, err := schedule.ParseClock(cmp.Or(d.At, defaultDigestAt))
+	errs = appendErr(errs, "at", err)
+	digest.At.Start, digest.At.End = at, at
+
+	loc, err := time.LoadLocation(d.Timezone)
+	errs = appendErr(errs, "timezone", err)
+	digest.At.Location = loc
+
+	return digest, errors.Join(errs...)
+}
+
+// route converts the configuration; sinks without a name are named after
+// their index.
+func (n NotifyConfig) route(idx int, opts *logic.CommandOptions) (notify.Route, error) {
+	var errs []error
+
+	events := make([]notify.EventType, 0, len(n.Events))
+
+	// Emails are sent once per outage, on recovery, unless told otherwise.
+	if len(n.Events) == 0 && n.Email != nil {
+		events = append(events, notify.EventUp)
+	}
+
+	for i, name := range n.Events {
+		event, err := notify.ParseEventType(name)
+		errs = appendErr(errs, fmt.Sprintf("events[%d]", i), err)
+		events = append(events, event)
+	}
+
+	_, err := notify.ParseTemplate("template", n.Template)
+	errs = appendErr(errs, "template", err)
+	_, err = notify.ParseTemplate("subject", n.Subject)
+	errs = appendErr(errs, "subject", err)
+	errs = appendErr(errs, "timeout", checkNonNegative(n.Timeout.StdDuration()))
+
+	sink, err := n.sink(opts)
+	errs = appendErr(errs, "sink", err)
+
+	if err := errors.Join(errs...); err != nil {
+		return notify.Route{}, err
+	}
+
+	return notify.Route{
+		Name:     cmp.Or(n.Name, fmt.Sprintf("notify[%d]", idx)),
+		Sink:     sink,
+		Events:   events,
+		Template: n.Template,
+		Subject:  n.Subject,
+		Timeout:  n.Timeout.StdDuration(),
+	}, nil
+}
+
+//nolint:ireturn // sinks are pluggable
+func (n NotifyConfig) sink(opts *logic.CommandOptions) (notify.Sink, error) {
+	var sinks []notify.Sink
+
+	if n.Webhook != nil {
+		webhook := &notify.WebhookSink{
+			Method:  n.Webhook.Method,
+			URL:     n.Webhook.URL,
+			Headers: n.Webhook.Headers,
+		}
+		if err := webhook.Validate(); err != nil {
+			return nil, fmt.Errorf("webhook: %w", err)
+		}
+
+		sinks = append(sinks, webhook)
+	}
+
+	if n.Exec != "" {
+		command := &notify.ExecSink{Command: n.Exec, Start: opts.Start}
+		if err := command.Validate(); err != nil {
+			return nil, fmt.Errorf("exec: %w", err)
+		}
+
+		sinks = append(sinks, command)
+	}
+
+	if n.Email != nil {
+		email := &notify.EmailSink{
+			Server:   n.Email.Server,
+			Security: n.Email.Security,
+			Username: n.Email.Username,
+			Password: n.Email.Password,
+			From:     n.Email.From,
+			To:       n.Email.To,
+		}
+		if err := email.Validate(); err != nil {
+			return nil, fmt.Errorf("email: %w", err)
+		}
+
+		sinks = append(sinks, email)
+	}
+
+	switch len(sinks) {
+	case 0:
+		return nil, errMissingSink
+	case 1:
+		return sinks[0], nil
+	default:
+		return nil, errMultipleSinks
+	}
+}
+
+func (m MaintenanceConfig) window() (schedule.Window, error) {
+	var errs []error
+
+	days := make([]time.Weekday, 0, len(m.Days))
+
+	for _, d := range m.Days {
+		wd, err := schedule.ParseWeekday(d)
+		errs = appendErr(errs, "days", err)
+		days = append(days, wd)
+	}
+
+	start, err := schedule.ParseClock(m.Start)
+	errs = appendErr(errs, "start", err)
+
+	end, err := schedule.ParseClock(m.End)
+	errs = appendErr(errs, "end", err)
+
+	if err == nil && start == end {
+		errs = appendErr(errs, "end", errEmptyWindow)
+	}
+
+	loc, err := time.LoadLocation(m.Timezone)
+	errs = appendErr(errs, "timezone", err)
+
+	return schedule.Window{
+		Name:                    m.Name,
+		Days:                    days,
+		Start:                   start,
+		End:                     end,
+		Location:                loc,
+		ExcludeFromAvailability: m.ExcludeFromAvailability,
+	}, errors.Join(errs...)
+}
+
+// GetName returns the configured group or host name, defaulting to the
+// host name of the machine.
+func (c Configuration) GetName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Config().Warn("could not get host name", "error", err)
+	}
+
+	return hostname
+}
+
 // GetDelays returns the check intervals for up and down states.
 func (c Configuration) GetDelays() logic.Delays {
 	return logic.Delays{
@@ -3,9 +3,14 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/hugoh/upd/internal/logic"
 	"github.com/hugoh/upd/internal/status"
 )
 
@@ -16,8 +21,34 @@ var (
 	errPortOutOfRange         = errors.New("must be between 1 and 65535")
 	errInvalidLogLevel        = errors.New("must be one of: debug, info, warn")
 	errUnsupportedScheme      = errors.New("unsupported scheme")
-	errTooManyBuckets         = errors.New("report period needs too many buckets")
+	errTooManyBuckets         = errors.New("report periods need too many buckets")
 	errMissingExec            = errors.New("required when downAction is configured")
+	errInvalidShuffledOrder   = errors.New("must be one of: random, adaptive")
+	errExecWithStages         = errors.New("cannot be combined with stages")
+	errStagesNotIncreasing    = errors.New("must be later than the previous stage")
+	errMultipleActions        = errors.New("only one of exec, webhook and powerCycle can be set")
+	errNotIPAddress           = errors.New("must be an IP address, optionally with a port")
+	errExitCodeOutOfRange     = errors.New("must be between 1 and 255, or 0 to disable")
+	errDuplicateExitCode      = errors.New("must differ from recheck")
+	errNotADirectory          = errors.New("must be in an existing directory")
+	errEmptyWindow            = errors.New("must differ from start")
+	errInvalidBackoff         = errors.New("must be one of: exponential, fixed, linear, schedule")
+	errBackoffNeedsRepeat     = errors.New("requires repeat")
+	errFactorTooSmall         = errors.New("must be at least 1, or 0 for the default")
+	errJitterOutOfRange       = errors.New("must be between 0 and 1")
+	errScheduleEmpty          = errors.New("required with the schedule strategy")
+	errScheduleUnused         = errors.New("only used with the schedule strategy")
+	errNoSuchDirectory        = errors.New("must be an existing directory")
+	errInvalidUmask           = errors.New("must be an octal mode such as 027")
+	errInvalidEnvName         = errors.New("must not be empty or contain =")
+	errMissingSink            = errors.New("one of webhook, exec and email is required")
+	errMultipleSinks          = errors.New("only one of webhook, exec and email can be set")
+	errRetryMaxTooSmall       = errors.New("must not be less than retryMin")
+	errMissingBroker          = errors.New("required when mqtt is configured")
+	errTopicWildcard          = errors.New("must not contain the + and # wildcards")
+	errInvalidDigestEvery     = errors.New("must be one of: daily, weekly")
+	errDigestDayUnused        = errors.New("only used with weekly digests")
+	errMissingDigestEvery     = errors.New("required when notifyDigest is configured")
 )
 
 func appendErr(errs []error, key string, err error) []error {
@@ -34,6 +65,12 @@ func (c Configuration) Validate() error {
 
 	errs = appendErr(errs, "checks", c.validateChecks())
 	errs = appendErr(errs, "downAction", c.validateDownAction())
+	errs = appendErr(errs, "diagnosis", c.validateDiagnosis())
+	errs = appendErr(errs, "maintenance", c.validateMaintenance())
+	errs = appendErr(errs, "notify", c.validateNotify())
+	errs = appendErr(errs, "notifyQueue", c.NotifyQueue.validate())
+	errs = appendErr(errs, "notifyDigest", c.NotifyDigest.validate())
+	errs = appendErr(errs, "mqtt", c.MQTT.validate())
 	errs = appendErr(errs, "stats", c.validateStats())
 
 	if c.LogLevel != "" {
@@ -51,6 +88,18 @@ func (c Configuration) validateChecks() error {
 	errs = appendErr(errs, "timeout", validatePositiveDuration(c.Checks.TimeOut))
 	errs = appendErr(errs, "list.ordered", validateURIs(c.Checks.List.Ordered))
 	errs = appendErr(errs, "list.shuffled", validateURIs(c.Checks.List.Shuffled))
+	errs = appendErr(errs, "list.shuffledOrder", validateShuffledOrder(c.Checks.List.ShuffledOrder))
+	errs = appendErr(errs, "breaker.threshold", checkNonNegativeInt(c.Checks.Breaker.Threshold))
+	errs = appendErr(
+		errs,
+		"breaker.cooldown",
+		checkNonNegative(c.Checks.Breaker.Cooldown.StdDuration()),
+	)
+	errs = appendErr(
+		errs,
+		"breaker.maxCooldown",
+		checkNonNegative(c.Checks.Breaker.MaxCooldown.StdDuration()),
+	)
 
 	return errors.Join(errs...)
 }
@@ -58,10 +107,30 @@ func (c Configuration) validateChecks() error {
 func (c Configuration) validateDownAction() error {
 	var errs []error
 
-	if c.DownAction != (DownActionConfig{}) && c.DownAction.Exec == "" {
-		errs = appendErr(errs, "exec", errMissingExec)
+	switch {
+	case len(c.DownAction.Stages) > 0:
+		if c.DownAction.Exec != "" {
+			errs = appendErr(errs, "exec", errExecWithStages)
+		}
+
+		if c.DownAction.Webhook != nil {
+			errs = appendErr(errs, "webhook", errExecWithStages)
+		}
+
+		if c.DownAction.PowerCycle != nil {
+			errs = appendErr(errs, "powerCycle", errExecWithStages)
+		}
+
+		errs = appendErr(errs, "stages", c.DownAction.validateStages())
+	case c.DownAction.configured():
+		errs = appendErr(errs, "exec", validateAction(
+			c.DownAction.Exec, c.DownAction.Webhook, c.DownAction.PowerCycle))
 	}
 
+	errs = appendErr(errs, "webhook", c.DownAction.Webhook.validate())
+	errs = appendErr(errs, "powerCycle", c.DownAction.PowerCycle.validate())
+	errs = appendErr(errs, "stopWebhook", c.DownAction.StopWebhook.validate())
+
 	errs = appendErr(errs, "every.after", checkNonNegative(time.Duration(c.DownAction.Every.After)))
 	errs = appendErr(
 		errs,
@@ -73,6 +142,286 @@ func (c Configuration) validateDownAction() error {
 		"every.expBackoffLimit",
 		checkNonNegative(time.Duration(c.DownAction.Every.BackoffLimit)),
 	)
+	errs = appendErr(errs, "backoff", c.DownAction.Backoff.validate(c.DownAction.Every.Repeat))
+	errs = appendErr(errs, "exitCodes", c.DownAction.ExitCodes.validate())
+	errs = appendErr(errs, "failureBudget", checkNonNegativeInt(c.DownAction.FailureBudget))
+	errs = appendErr(errs, "killGrace", checkNonNegative(c.DownAction.KillGrace.StdDuration()))
+	errs = appendErr(errs, "command", c.DownAction.Command.validate())
+	errs = appendErr(errs, "limits.maxPerDay", checkNonNegativeInt(c.DownAction.Limits.MaxPerDay))
+	errs = appendErr(
+		errs,
+		"limits.minInterval",
+		checkNonNegative(c.DownAction.Limits.MinInterval.StdDuration()),
+	)
+
+	if c.DownAction.StateFile != "" {
+		errs = appendErr(errs, "stateFile", validateFileDir(c.DownAction.StateFile))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c CommandConfig) validate() error {
+	opts, err := c.options()
+	errs := appendErr(nil, "umask", err)
+
+	if c.User != "" || c.Group != "" {
+		errs = appendErr(errs, "user", opts.Validate())
+	}
+
+	if c.Dir != "" {
+		errs = appendErr(errs, "dir", validateDir(c.Dir))
+	}
+
+	for name := range c.Env {
+		if name == "" || strings.Contains(name, "=") {
+			errs = appendErr(errs, fmt.Sprintf("env[%q]", name), errInvalidEnvName)
+		}
+	}
+
+	errs = appendErr(errs, "timeout", checkNonNegative(c.Timeout.StdDuration()))
+
+	return errors.Join(errs...)
+}
+
+func (e ExitCodesConfig) validate() error {
+	var errs []error
+
+	errs = appendErr(errs, "recheck", validateExitCode(e.Recheck))
+	errs = appendErr(errs, "giveUp", validateExitCode(e.GiveUp))
+
+	if e.GiveUp != 0 && e.GiveUp == e.Recheck {
+		errs = appendErr(errs, "giveUp", errDuplicateExitCode)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks the strategy settings; repeat is the first delay of the
+// strategies other than schedule.
+func (b BackoffConfig) validate(repeat Duration) error {
+	var errs []error
+
+	switch b.Strategy {
+	case "", BackoffExponential, BackoffFixed, BackoffLinear:
+		switch {
+		case repeat > 0:
+		case b.Strategy != "":
+			errs = appendErr(errs, "strategy", errBackoffNeedsRepeat)
+		case b.Factor != 0:
+			errs = appendErr(errs, "factor", errBackoffNeedsRepeat)
+		}
+
+		if len(b.Schedule) > 0 {
+			errs = appendErr(errs, "schedule", errScheduleUnused)
+		}
+	case BackoffSchedule:
+		if len(b.Schedule) == 0 {
+			errs = appendErr(errs, "schedule", errScheduleEmpty)
+		}
+
+		for idx, d := range b.Schedule {
+			errs = appendErr(errs, fmt.Sprintf("schedule[%d]", idx), validatePositiveDuration(d))
+		}
+	default:
+		errs = appendErr(errs, "strategy", errInvalidBackoff)
+	}
+
+	if b.Factor != 0 && b.Factor < 1 {
+		errs = appendErr(errs, "factor", errFactorTooSmall)
+	}
+
+	errs = appendErr(errs, "step", checkNonNegative(b.Step.StdDuration()))
+
+	if b.Jitter < 0 || b.Jitter > 1 {
+		errs = appendErr(errs, "jitter", errJitterOutOfRange)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateExitCode accepts 0 (disabled) and the codes a command can exit with
+// other than success.
+func validateExitCode(code int) error {
+	const maxExitCode = 255
+
+	if code < 0 || code > maxExitCode {
+		return errExitCodeOutOfRange
+	}
+
+	return nil
+}
+
+func (c Configuration) validateDiagnosis() error {
+	var errs []error
+
+	for idx, addr := range c.Diagnosis.PublicIPs {
+		errs = appendErr(errs, fmt.Sprintf("publicIPs[%d]", idx), validateIPAddress(addr))
+	}
+
+	errs = appendErr(errs, "port", validatePort(c.Diagnosis.Port))
+	errs = appendErr(errs, "timeout", checkNonNegative(c.Diagnosis.Timeout.StdDuration()))
+
+	return errors.Join(errs...)
+}
+
+func (c Configuration) validateMaintenance() error {
+	var errs []error
+
+	for idx, m := range c.Maintenance {
+		_, err := m.window()
+		errs = appendErr(errs, fmt.Sprintf("[%d]", idx), err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c Configuration) validateNotify() error {
+	var errs []error
+
+	for idx, n := range c.Notify {
+		_, err := n.route(idx, &logic.CommandOptions{})
+		errs = appendErr(errs, fmt.Sprintf("[%d]", idx), err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m MQTTConfig) validate() error {
+	if m.Broker == "" {
+		if m != (MQTTConfig{}) {
+			return fmt.Errorf("broker: %w", errMissingBroker)
+		}
+
+		return nil
+	}
+
+	// The broker options are checked with their key.
+	errs := []error{m.options().Validate()}
+	errs = appendErr(errs, "keepAlive", checkNonNegative(m.KeepAlive.StdDuration()))
+
+	if strings.ContainsAny(m.Topic, "+#") {
+		errs = appendErr(errs, "topic", errTopicWildcard)
+	}
+
+	if strings.ContainsAny(m.DiscoveryPrefix, "+#") {
+		errs = appendErr(errs, "discoveryPrefix", errTopicWildcard)
+	}
+
+	if strings.ContainsAny(m.CommandTopic, "+#") {
+		errs = appendErr(errs, "commandTopic", errTopicWildcard)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d NotifyDigestConfig) validate() error {
+	if d == (NotifyDigestConfig{}) {
+		return nil
+	}
+
+	if d.Every == "" {
+		return fmt.Errorf("every: %w", errMissingDigestEvery)
+	}
+
+	_, err := d.digest()
+
+	return err
+}
+
+func (q NotifyQueueConfig) validate() error {
+	var errs []error
+
+	if q.Dir != "" {
+		errs = appendErr(errs, "dir", validateFileDir(q.Dir))
+	}
+
+	errs = appendErr(errs, "maxAge", checkNonNegative(q.MaxAge.StdDuration()))
+	errs = appendErr(errs, "retryMin", checkNonNegative(q.RetryMin.StdDuration()))
+	errs = appendErr(errs, "retryMax", checkNonNegative(q.RetryMax.StdDuration()))
+
+	if q.RetryMin > 0 && q.RetryMax > 0 && q.RetryMax < q.RetryMin {
+		errs = appendErr(errs, "retryMax", errRetryMaxTooSmall)
+	}
+
+	if q.MaxPending < 0 {
+		errs = appendErr(errs, "maxPending", errMustNotBeNegative)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d DownActionConfig) validateStages() error {
+	var errs []error
+
+	for idx, stage := range d.Stages {
+		key := fmt.Sprintf("[%d]", idx)
+
+		errs = appendErr(errs, key+".exec", validateAction(stage.Exec, stage.Webhook, stage.PowerCycle))
+		errs = appendErr(errs, key+".webhook", stage.Webhook.validate())
+		errs = appendErr(errs, key+".powerCycle", stage.PowerCycle.validate())
+
+		errs = appendErr(errs, key+".after", checkNonNegative(stage.After.StdDuration()))
+		errs = appendErr(errs, key+".repeat", checkNonNegative(stage.Repeat.StdDuration()))
+		errs = appendErr(
+			errs,
+			key+".expBackoffLimit",
+			checkNonNegative(stage.BackoffLimit.StdDuration()),
+		)
+		errs = appendErr(errs, key+".backoff", stage.Backoff.validate(stage.Repeat))
+
+		if idx > 0 && stage.After <= d.Stages[idx-1].After {
+			errs = appendErr(errs, key+".after", errStagesNotIncreasing)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateAction checks that exactly one action is set.
+func validateAction(exec string, webhook *WebhookConfig, powerCycle *PowerCycleConfig) error {
+	var count int
+
+	for _, set := range []bool{exec != "", webhook != nil, powerCycle != nil} {
+		if set {
+			count++
+		}
+	}
+
+	switch count {
+	case 0:
+		return errMissingExec
+	case 1:
+		return nil
+	default:
+		return errMultipleActions
+	}
+}
+
+func (p *PowerCycleConfig) validate() error {
+	if p == nil {
+		return nil
+	}
+
+	errs := []error{p.powerCycle().Validate()}
+	errs = appendErr(errs, "relay", checkNonNegativeInt(p.Relay))
+	errs = appendErr(errs, "offFor", checkNonNegative(p.OffFor.StdDuration()))
+	if p.Retries != nil {
+		errs = appendErr(errs, "retries", checkNonNegativeInt(*p.Retries))
+	}
+	errs = appendErr(errs, "retryDelay", checkNonNegative(p.RetryDelay.StdDuration()))
+	errs = appendErr(errs, "timeout", checkNonNegative(p.Timeout.StdDuration()))
+
+	return errors.Join(errs...)
+}
+
+func (w *WebhookConfig) validate() error {
+	if w == nil {
+		return nil
+	}
+
+	errs := []error{w.webhook().Validate()}
+	errs = appendErr(errs, "timeout", checkNonNegative(w.Timeout.StdDuration()))
 
 	return errors.Join(errs...)
 }
@@ -87,7 +436,8 @@ func (c Configuration) validateStats() error {
 		"buckets.maxSpan",
 		checkNonNegative(c.Stats.Buckets.MaxSpan.StdDuration()),
 	)
-	errs = appendErr(errs, "reports", c.Stats.validateReports())
+	targets := len(c.Checks.List.Ordered) + len(c.Checks.List.Shuffled)
+	errs = appendErr(errs, "reports", c.Stats.validateReports(targets))
 	errs = appendErr(errs, "readTimeout", checkNonNegative(c.Stats.ReadTimeout.StdDuration()))
 	errs = appendErr(errs, "writeTimeout", checkNonNegative(c.Stats.WriteTimeout.StdDuration()))
 	errs = appendErr(errs, "idleTimeout", checkNonNegative(c.Stats.IdleTimeout.StdDuration()))
@@ -95,10 +445,14 @@ func (c Configuration) validateStats() error {
 	return errors.Join(errs...)
 }
 
-func (s StatsConfig) validateReports() error {
-	bucketCfg := s.GetBucketConfig()
-
-	var errs []error
+// validateReports checks the report periods, and that their buckets, in
+// aggregate and for each of the probe targets, stay within
+// status.MaxBuckets.
+func (s StatsConfig) validateReports(targets int) error {
+	var (
+		errs    []error
+		periods []time.Duration
+	)
 
 	for idx, report := range s.Reports {
 		period := report.StdDuration()
@@ -108,11 +462,13 @@ func (s StatsConfig) validateReports() error {
 			continue
 		}
 
-		if n := bucketCfg.BucketCount(period); n > status.MaxBucketsPerPeriod {
-			errs = append(errs, fmt.Errorf(
-				"[%d]: %w (%d > %d): increase buckets.maxSpan",
-				idx, errTooManyBuckets, n, status.MaxBucketsPerPeriod))
-		}
+		periods = append(periods, period)
+	}
+
+	if n := s.GetBucketConfig().TotalBuckets(periods, targets); n > status.MaxBuckets {
+		errs = append(errs, fmt.Errorf(
+			"%w (%d > %d): increase buckets.maxSpan",
+			errTooManyBuckets, n, status.MaxBuckets))
 	}
 
 	return errors.Join(errs...)
@@ -159,6 +515,47 @@ func validateLogLevel(level string) error {
 	}
 }
 
+func validateShuffledOrder(order string) error {
+	switch order {
+	case "", ShuffledOrderRandom, ShuffledOrderAdaptive:
+		return nil
+	default:
+		return errInvalidShuffledOrder
+	}
+}
+
+// validateFileDir checks that the directory of path exists, so the file can
+// be created.
+func validateFileDir(path string) error {
+	if validateDir(filepath.Dir(path)) != nil {
+		return errNotADirectory
+	}
+
+	return nil
+}
+
+func validateDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return errNoSuchDirectory
+	}
+
+	return nil
+}
+
+func validateIPAddress(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	if net.ParseIP(host) == nil {
+		return errNotIPAddress
+	}
+
+	return nil
+}
+
 func validateURIs(uris []string) error {
 	var errs []error
 
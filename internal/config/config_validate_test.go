@@ -5,7 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/hugoh/upd/internal/logic"
+	"github.com/hugoh/upd/internal/mqtt"
+	"github.com/hugoh/upd/internal/notify"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -346,6 +350,22 @@ maxSpan = "1s"`
 	assert.Contains(t, err.Error(), "too many buckets")
 }
 
+func TestValidate_reportsTooManyBucketsInTotal(t *testing.T) {
+	config := validConfigBase() + `
+
+[stats]
+reports = ["1h", "24h", "25h"]
+
+[stats.buckets]
+maxSpan = "1s"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err, "each period fits, but not all of them")
+	assert.Contains(t, err.Error(), "reports: report periods need too many buckets")
+}
+
 func TestValidate_reportNotPositive(t *testing.T) {
 	config := validConfigBase() + `
 
@@ -358,3 +378,1049 @@ reports = ["1m", "0s"]`
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "reports")
 }
+
+func TestValidate_shuffledOrder(t *testing.T) {
+	path := writeTestConfig(t, checksConfig("2000ms", `shuffled = ["http://example.com/"]
+shuffledOrder = "adaptive"`))
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	checklist, err := conf.GetChecks()
+	require.NoError(t, err)
+	assert.NotNil(t, checklist.Adaptive)
+}
+
+func TestValidate_shuffledOrderInvalid(t *testing.T) {
+	path := writeTestConfig(t, checksConfig("2000ms", `shuffled = ["http://example.com/"]
+shuffledOrder = "fastest"`))
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "list.shuffledOrder")
+	assert.Contains(t, err.Error(), "must be one of: random, adaptive")
+}
+
+func TestValidate_breaker(t *testing.T) {
+	config := validConfigBase() + `
+
+[checks.breaker]
+threshold = 5
+cooldown = "2m"
+maxCooldown = "2h"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	checklist, err := conf.GetChecks()
+	require.NoError(t, err)
+	assert.NotNil(t, checklist.Breakers)
+}
+
+func TestValidate_breakerNegative(t *testing.T) {
+	config := validConfigBase() + `
+
+[checks.breaker]
+threshold = -1
+cooldown = "-2m"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checks: breaker.threshold: must not be negative")
+	assert.Contains(t, err.Error(), "breaker.cooldown: must not be negative")
+}
+
+func TestGetChecks_exhaustive(t *testing.T) {
+	path := writeTestConfig(t, `[checks]
+timeout = "2000ms"
+exhaustive = true
+
+[checks.every]
+normal = "120s"
+down = "20s"
+
+[checks.list]
+ordered = ["http://example.com/"]`)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	checklist, err := conf.GetChecks()
+	require.NoError(t, err)
+	assert.True(t, checklist.Exhaustive)
+}
+
+func TestGetChecks_name(t *testing.T) {
+	path := writeTestConfig(t, checksConfig("2000ms",
+		`ordered = ["http://example.com/path#example", "tcp://1.1.1.1:53/"]`))
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	checklist, err := conf.GetChecks()
+	require.NoError(t, err)
+	require.Len(t, checklist.Ordered, 2)
+	assert.Equal(t, "example", checklist.Ordered[0].Name)
+	assert.Equal(t, "http://example.com/path", checklist.Ordered[0].Probe.Target())
+	assert.Empty(t, checklist.Ordered[1].Name)
+}
+
+func TestGetDiagnoser(t *testing.T) {
+	config := validConfigBase() + `
+
+[diagnosis]
+enabled = true
+gateway = "192.168.1.1"
+publicIPs = ["1.1.1.1", "8.8.8.8:53"]
+timeout = "1s"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.NotNil(t, conf.GetDiagnoser())
+}
+
+func TestGetDiagnoser_disabled(t *testing.T) {
+	path := writeTestConfig(t, validConfigBase())
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.Nil(t, conf.GetDiagnoser())
+}
+
+func TestValidate_diagnosisInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[diagnosis]
+enabled = true
+publicIPs = ["one.one.one.one:53"]
+port = 70000
+timeout = "-1s"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "diagnosis: publicIPs[0]: must be an IP address")
+	assert.Contains(t, err.Error(), "port: must be between 1 and 65535")
+	assert.Contains(t, err.Error(), "timeout: must not be negative")
+}
+
+func TestGetDownAction_stages(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+stopExec = "true"
+
+[[downAction.stages]]
+name = "restart wan"
+after = "1m"
+exec = "ifup wan"
+repeat = "1m"
+expBackoffLimit = "3m"
+
+[[downAction.stages]]
+after = "20m"
+exec = "reboot-modem"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	da := conf.GetDownAction()
+	require.NotNil(t, da)
+	require.Len(t, da.Stages, 2)
+	assert.Equal(t, "restart wan", da.Stages[0].Name)
+	assert.Equal(t, time.Minute, da.Stages[0].After)
+	assert.Equal(t, time.Minute, da.Stages[0].Every)
+	assert.Equal(t, 3*time.Minute, da.Stages[0].BackoffLimit)
+	assert.Equal(t, 20*time.Minute, da.Stages[1].After)
+	assert.Equal(t, "reboot-modem", da.Stages[1].Exec)
+}
+
+func TestValidate_stagesInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "true"
+
+[[downAction.stages]]
+after = "5m"
+exec = "ifup wan"
+
+[[downAction.stages]]
+after = "5m"
+repeat = "-1m"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "downAction: exec: cannot be combined with stages")
+	assert.Contains(t, err.Error(), "stages: [1].exec: required")
+	assert.Contains(t, err.Error(), "[1].repeat: must not be negative")
+	assert.Contains(t, err.Error(), "[1].after: must be later than the previous stage")
+}
+
+func TestGetDownAction_webhooks(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction.webhook]
+url = "http://192.168.1.1/api/restart"
+headers = { Authorization = "Bearer secret" }
+body = '{"down": "{{.DownFor}}"}'
+timeout = "5s"
+successCodes = [200, 202]
+
+[downAction.stopWebhook]
+method = "GET"
+url = "https://example.com/up"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	da := conf.GetDownAction()
+	require.NotNil(t, da)
+	require.NotNil(t, da.Webhook)
+	assert.Equal(t, "http://192.168.1.1/api/restart", da.Webhook.URL)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer secret"}, da.Webhook.Headers)
+	assert.Equal(t, 5*time.Second, da.Webhook.Timeout)
+	assert.Equal(t, []int{200, 202}, da.Webhook.SuccessCodes)
+	require.NotNil(t, da.StopWebhook)
+	assert.Equal(t, "GET", da.StopWebhook.Method)
+}
+
+func TestValidate_webhookInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "true"
+
+[downAction.webhook]
+url = "ftp://example.com/"
+body = "{{.Iteration"
+
+[[downAction.stages]]
+webhook = { url = "http://example.com/", successCodes = [700] }`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "downAction: exec: cannot be combined with stages")
+	assert.Contains(t, err.Error(), "webhook: cannot be combined with stages")
+	assert.Contains(t, err.Error(), "webhook: url: must be an absolute http or https URL")
+	assert.Contains(t, err.Error(), "[0].webhook: successCodes: 700 must be between 100 and 599")
+}
+
+func TestValidate_execWithWebhook(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "true"
+
+[downAction.webhook]
+url = "http://example.com/"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "downAction: exec: only one of exec, webhook and powerCycle can be set")
+}
+
+func TestGetDownAction_powerCycle(t *testing.T) {
+	config := validConfigBase() + `
+
+[[downAction.stages]]
+after = "20m"
+
+[downAction.stages.powerCycle]
+firmware = "shellyGen2"
+host = "192.168.1.50"
+relay = 1
+offFor = "30s"
+retries = 5`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	da := conf.GetDownAction()
+	require.NotNil(t, da)
+	require.Len(t, da.Stages, 1)
+
+	pc := da.Stages[0].PowerCycle
+	require.NotNil(t, pc)
+	assert.Equal(t, "shellyGen2", pc.Firmware)
+	assert.Equal(t, "192.168.1.50", pc.Host)
+	assert.Equal(t, 1, pc.Relay)
+	assert.Equal(t, 30*time.Second, pc.OffFor)
+	assert.Equal(t, 5, pc.Retries)
+}
+
+func TestGetDownAction_powerCycleRetries(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction.powerCycle]
+firmware = "tasmota"
+host = "192.168.1.50"`
+
+	conf, err := ReadConf(writeTestConfig(t, config))
+	require.NoError(t, err)
+	assert.Zero(t, conf.GetDownAction().PowerCycle.Retries, "unset uses the default")
+
+	conf, err = ReadConf(writeTestConfig(t, config+`
+retries = 0`))
+	require.NoError(t, err)
+	assert.Equal(t, logic.NoPowerCycleRetries, conf.GetDownAction().PowerCycle.Retries)
+}
+
+func TestValidate_powerCycleInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction.powerCycle]
+firmware = "kasa"
+relay = -1
+retries = -2`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "powerCycle: firmware: must be one of: tasmota, shellyGen1, shellyGen2")
+	assert.Contains(t, err.Error(), "relay: must not be negative")
+	assert.Contains(t, err.Error(), "retries: must not be negative")
+}
+
+func TestGetName(t *testing.T) {
+	path := writeTestConfig(t, `name = "cabin"
+`+validConfigBase())
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.Equal(t, "cabin", conf.GetName())
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	conf.Name = ""
+	assert.Equal(t, hostname, conf.GetName())
+}
+
+func TestGetDownAction_stdinJSON(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "notify"
+stdinJSON = true`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.True(t, conf.GetDownAction().StdinJSON)
+}
+
+func TestGetDownAction_exitCodes(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "fix-network"
+failureBudget = 5
+
+[downAction.exitCodes]
+recheck = 10
+giveUp = 11`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	da := conf.GetDownAction()
+	assert.Equal(t, 10, da.RecheckExitCode)
+	assert.Equal(t, 11, da.GiveUpExitCode)
+	assert.Equal(t, 5, da.FailureBudget)
+}
+
+func TestValidate_exitCodesInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "fix-network"
+failureBudget = -1
+
+[downAction.exitCodes]
+recheck = 300
+giveUp = 300`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exitCodes: recheck: must be between 1 and 255, or 0 to disable")
+	assert.Contains(t, err.Error(), "giveUp: must differ from recheck")
+	assert.Contains(t, err.Error(), "failureBudget: must not be negative")
+}
+
+func TestGetDownAction_limits(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+
+[downAction.limits]
+maxPerDay = 4
+minInterval = "2h"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	da := conf.GetDownAction()
+	assert.Equal(t, 4, da.MaxPerDay)
+	assert.Equal(t, 2*time.Hour, da.MinInterval)
+}
+
+func TestValidate_limitsInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+
+[downAction.limits]
+maxPerDay = -1
+minInterval = "-1h"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "limits.maxPerDay: must not be negative")
+	assert.Contains(t, err.Error(), "limits.minInterval: must not be negative")
+}
+
+func TestGetDownAction_stateFile(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+stateFile = "` + filepath.Join(t.TempDir(), "state.json") + `"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.NotNil(t, conf.GetDownAction().State)
+}
+
+func TestValidate_stateFileMissingDirectory(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+stateFile = "/does/not/exist/state.json"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stateFile: must be in an existing directory")
+}
+
+func TestGetMaintenance(t *testing.T) {
+	config := validConfigBase() + `
+
+[[maintenance]]
+name = "isp"
+days = ["Tue"]
+start = "02:00"
+end = "05:00"
+timezone = "Europe/Paris"
+excludeFromAvailability = true`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	windows, err := conf.GetMaintenance()
+	require.NoError(t, err)
+	require.Len(t, windows, 1)
+	assert.Equal(t, "isp", windows[0].Name)
+	assert.Equal(t, []time.Weekday{time.Tuesday}, windows[0].Days)
+	assert.Equal(t, 2*time.Hour, windows[0].Start)
+	assert.Equal(t, 5*time.Hour, windows[0].End)
+	assert.Equal(t, "Europe/Paris", windows[0].Location.String())
+	assert.True(t, windows[0].ExcludeFromAvailability)
+}
+
+func TestValidate_maintenanceInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[[maintenance]]
+days = ["tue"]
+start = "02:00"
+end = "05:00"
+
+[[maintenance]]
+days = ["someday"]
+start = "2am"
+end = "02:00"
+timezone = "Nowhere/Special"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "maintenance: [1]: days:")
+	assert.Contains(t, err.Error(), "start:")
+	assert.Contains(t, err.Error(), "timezone:")
+	assert.NotContains(t, err.Error(), "[0]")
+}
+
+func TestGetNotifications(t *testing.T) {
+	config := validConfigBase() + `
+
+[[notify]]
+name = "chat"
+events = ["down", "up"]
+template = '{"text": {{json .Summary}}}'
+timeout = "5s"
+
+[notify.webhook]
+url = "https://chat.example.com/hook"
+headers = { "Content-Type" = "application/json" }
+
+[[notify]]
+exec = "logger -t upd"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	routes, err := conf.GetNotifications()
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+
+	assert.Equal(t, "chat", routes[0].Name)
+	assert.Equal(t, []notify.EventType{notify.EventDown, notify.EventUp}, routes[0].Events)
+	assert.Equal(t, 5*time.Second, routes[0].Timeout)
+	assert.Equal(t, &notify.WebhookSink{
+		URL:     "https://chat.example.com/hook",
+		Headers: map[string]string{"Content-Type": "application/json"},
+	}, routes[0].Sink)
+
+	assert.Equal(t, "notify[1]", routes[1].Name)
+	assert.Empty(t, routes[1].Events)
+	require.IsType(t, &notify.ExecSink{}, routes[1].Sink)
+	assert.Equal(t, "logger -t upd", routes[1].Sink.(*notify.ExecSink).Command)
+	assert.NotNil(t, routes[1].Sink.(*notify.ExecSink).Start, "run like down action commands")
+}
+
+func TestGetNotifyQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "notify")
+	config := validConfigBase() + `
+
+[notifyQueue]
+dir = "` + dir + `"
+maxAge = "24h"
+retryMin = "1m"
+retryMax = "1h"
+maxPending = 50`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.Equal(t, notify.Queue{
+		Dir:        dir,
+		MaxAge:     24 * time.Hour,
+		RetryMin:   time.Minute,
+		RetryMax:   time.Hour,
+		MaxPending: 50,
+	}, conf.GetNotifyQueue())
+}
+
+func TestGetNotifications_email(t *testing.T) {
+	config := validConfigBase() + `
+
+[[notify]]
+[notify.email]
+server = "smtp.example.com:587"
+username = "upd"
+password = "secret"
+from = "upd <upd@example.com>"
+to = ["ops@example.com"]`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	routes, err := conf.GetNotifications()
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+
+	assert.Equal(t, []notify.EventType{notify.EventUp}, routes[0].Events, "one email per outage")
+	assert.Equal(t, &notify.EmailSink{
+		Server:   "smtp.example.com:587",
+		Username: "upd",
+		Password: "secret",
+		From:     "upd <upd@example.com>",
+		To:       []string{"ops@example.com"},
+	}, routes[0].Sink)
+}
+
+func TestGetDigest(t *testing.T) {
+	config := validConfigBase() + `
+
+[notifyDigest]
+every = "weekly"
+day = "friday"
+at = "18:30"
+timezone = "Europe/Paris"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	digest, err := conf.GetDigest()
+	require.NoError(t, err)
+	require.NotNil(t, digest)
+	assert.Equal(t, 7*24*time.Hour, digest.Period)
+	assert.Equal(t, []time.Weekday{time.Friday}, digest.At.Days)
+	assert.Equal(t, 18*time.Hour+30*time.Minute, digest.At.Start)
+	assert.Equal(t, "Europe/Paris", digest.At.Location.String())
+}
+
+func TestGetDigest_defaults(t *testing.T) {
+	conf, err := ReadConf(writeTestConfig(t, validConfigBase()))
+	require.NoError(t, err)
+
+	digest, err := conf.GetDigest()
+	require.NoError(t, err)
+	assert.Nil(t, digest, "disabled by default")
+
+	conf.NotifyDigest.Every = "daily"
+	digest, err = conf.GetDigest()
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, digest.Period)
+	assert.Empty(t, digest.At.Days)
+	assert.Equal(t, 8*time.Hour, digest.At.Start)
+}
+
+func TestValidate_notifyDigestInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[notifyDigest]
+every = "daily"
+day = "mon"
+at = "8am"
+
+[[notify]]
+exec = "logger"
+
+[notify.email]
+server = "smtp.example.com"
+from = "upd@example.com"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "notifyDigest: day: only used with weekly digests")
+	assert.Contains(t, err.Error(), "at: \"8am\": must be a time of day")
+	assert.Contains(t, err.Error(), "sink: email: server: must be a host:port address")
+
+	path = writeTestConfig(t, validConfigBase()+`
+
+[notifyDigest]
+at = "08:00"`)
+
+	_, err = ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "notifyDigest: every: required when notifyDigest is configured")
+}
+
+func TestValidate_notifyQueueInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[notifyQueue]
+dir = "/does/not/exist/notify"
+maxAge = "-1h"
+retryMin = "1h"
+retryMax = "1m"
+maxPending = -1`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "notifyQueue: dir: must be in an existing directory")
+	assert.Contains(t, err.Error(), "maxAge: must not be negative")
+	assert.Contains(t, err.Error(), "retryMax: must not be less than retryMin")
+	assert.Contains(t, err.Error(), "maxPending: must not be negative")
+}
+
+func TestGetMQTT(t *testing.T) {
+	config := "name = \"lab\"\n" + validConfigBase() + `
+
+[mqtt]
+broker = "mqtts://broker.example.com"
+clientID = "upd-lab"
+username = "upd"
+password = "secret"
+keepAlive = "1m"
+discovery = true
+commandTopic = "upd/lab/check"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	mqttConf := conf.GetMQTT()
+	require.NotNil(t, mqttConf)
+	assert.Equal(t, mqtt.Options{
+		Broker:    "mqtts://broker.example.com",
+		ClientID:  "upd-lab",
+		Username:  "upd",
+		Password:  "secret",
+		KeepAlive: time.Minute,
+	}, mqttConf.Options)
+	assert.True(t, mqttConf.Discovery)
+	assert.Equal(t, "upd/lab/check", mqttConf.CommandTopic)
+	assert.Equal(t, "lab", mqttConf.Name)
+	assert.Equal(t, conf.GetStatServerConfig().Reports, mqttConf.Reports)
+}
+
+func TestGetMQTT_disabled(t *testing.T) {
+	path := writeTestConfig(t, validConfigBase())
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.Nil(t, conf.GetMQTT())
+}
+
+func TestValidate_mqttInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[mqtt]
+broker = "localhost:1883"
+keepAlive = "-1s"
+commandTopic = "upd/#"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mqtt: broker: must be an mqtt://")
+	assert.Contains(t, err.Error(), "keepAlive: must not be negative")
+	assert.Contains(t, err.Error(), "commandTopic: must not contain the + and # wildcards")
+}
+
+func TestValidate_mqttInvalidOptions(t *testing.T) {
+	for name, tt := range map[string]struct {
+		option string
+		want   string
+	}{
+		"password without username": {`password = "secret"`, "mqtt: password: requires a username"},
+		"keep alive too long":       {`keepAlive = "19h"`, "mqtt: keepAlive: must be at most 65535s"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := writeTestConfig(t, validConfigBase()+`
+
+[mqtt]
+broker = "mqtt://localhost"
+`+tt.option)
+
+			_, err := ReadConf(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestValidate_mqttMissingBroker(t *testing.T) {
+	config := validConfigBase() + `
+
+[mqtt]
+discovery = true`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mqtt: broker: required when mqtt is configured")
+}
+
+func TestValidate_notifyInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[[notify]]
+exec = "logger"
+
+[[notify]]
+events = ["sideways"]
+template = "{{.Summary"
+timeout = "-1s"
+
+[[notify]]
+exec = "logger"
+
+[notify.webhook]
+url = "chat.example.com"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "notify: [1]: events[0]:")
+	assert.Contains(t, err.Error(), "template: invalid template")
+	assert.Contains(t, err.Error(), "timeout: must not be negative")
+	assert.Contains(t, err.Error(), "sink: one of webhook, exec and email is required")
+	assert.Contains(t, err.Error(), "[2]: sink: webhook: url:")
+	assert.NotContains(t, err.Error(), "notify: [0]")
+}
+
+func TestValidate_maintenanceEmptyWindow(t *testing.T) {
+	config := validConfigBase() + `
+
+[[maintenance]]
+start = "02:00"
+end = "02:00"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "end: must differ from start")
+}
+
+func TestGetDownAction_backoff(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+
+[downAction.every]
+repeat = "2m"
+expBackoffLimit = "10m"
+
+[downAction.backoff]
+strategy = "linear"
+jitter = 0.2`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	da := conf.GetDownAction()
+	assert.Equal(t, logic.LinearBackoff{
+		Every: 2 * time.Minute,
+		Step:  2 * time.Minute,
+		Limit: 10 * time.Minute,
+	}, da.Backoff)
+	assert.InDelta(t, 0.2, da.Jitter, 1e-9)
+}
+
+func TestGetDownAction_stageBackoffSchedule(t *testing.T) {
+	config := validConfigBase() + `
+
+[[downAction.stages]]
+exec = "restart-wan"
+
+[downAction.stages.backoff]
+strategy = "schedule"
+schedule = ["1m", "5m", "15m", "1h"]`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	da := conf.GetDownAction()
+	require.Len(t, da.Stages, 1)
+	assert.Equal(t, logic.ScheduleBackoff{
+		time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour,
+	}, da.Stages[0].Backoff)
+}
+
+func TestGetDownAction_defaultBackoff(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+
+[downAction.every]
+repeat = "2m"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.Nil(t, conf.GetDownAction().Backoff)
+}
+
+func TestValidate_backoffInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+
+[downAction.backoff]
+strategy = "fixed"
+factor = 0.5
+jitter = 1.5
+schedule = ["1m"]`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "backoff: strategy: requires repeat")
+	assert.Contains(t, err.Error(), "factor: must be at least 1")
+	assert.Contains(t, err.Error(), "jitter: must be between 0 and 1")
+	assert.Contains(t, err.Error(), "schedule: only used with the schedule strategy")
+}
+
+func TestValidate_backoffSchedule(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+
+[downAction.backoff]
+strategy = "schedule"
+
+[[downAction.stages]]
+exec = "restart-wan"
+
+[downAction.stages.backoff]
+strategy = "schedule"
+schedule = ["1m", "0s"]
+
+[[downAction.stages]]
+after = "1h"
+exec = "reboot-modem"
+
+[downAction.stages.backoff]
+strategy = "random"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "backoff: schedule: required with the schedule strategy")
+	assert.Contains(t, err.Error(), "[0].backoff: schedule[1]: must be greater than 0")
+	assert.Contains(t, err.Error(), "[1].backoff: strategy: must be one of")
+}
+
+func TestGetDownAction_killGrace(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+killGrace = "20s"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Second, conf.GetDownAction().KillGrace)
+}
+
+func TestGetDownAction_dryRun(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+dryRun = true`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+	assert.True(t, conf.GetDownAction().DryRun)
+}
+
+func TestValidate_killGraceNegative(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+killGrace = "-1s"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "killGrace: must not be negative")
+}
+
+func TestGetDownAction_command(t *testing.T) {
+	dir := t.TempDir()
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+
+[downAction.command]
+dir = "` + dir + `"
+envAllow = ["PATH"]
+env = { B = "2", A = "1" }
+umask = "027"
+timeout = "2m"`
+
+	path := writeTestConfig(t, config)
+
+	conf, err := ReadConf(path)
+	require.NoError(t, err)
+
+	cmd := conf.GetDownAction().Command
+	assert.Equal(t, dir, cmd.Dir)
+	assert.Equal(t, []string{"PATH"}, cmd.EnvAllow)
+	assert.Equal(t, []string{"A=1", "B=2"}, cmd.Env)
+	require.NotNil(t, cmd.Umask)
+	assert.Equal(t, os.FileMode(0o027), *cmd.Umask)
+	assert.Equal(t, 2*time.Minute, cmd.Timeout)
+}
+
+func TestValidate_commandInvalid(t *testing.T) {
+	config := validConfigBase() + `
+
+[downAction]
+exec = "reboot-modem"
+
+[downAction.command]
+user = "upd-no-such-user"
+dir = "/does/not/exist"
+env = { "A=B" = "1" }
+umask = "999"
+timeout = "-1s"`
+
+	path := writeTestConfig(t, config)
+
+	_, err := ReadConf(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "command: umask: must be an octal mode")
+	assert.Contains(t, err.Error(), "user: user \"upd-no-such-user\"")
+	assert.Contains(t, err.Error(), "dir: must be an existing directory")
+	assert.Contains(t, err.Error(), "env[\"A=B\"]: must not be empty or contain =")
+	assert.Contains(t, err.Error(), "timeout: must not be negative")
+}
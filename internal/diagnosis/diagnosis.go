@@ -0,0 +1,353 @@
+// Package diagnosis determines which network layer failed during an outage.
+//
+// When the connection goes down, a Diagnoser walks the path to the internet
+// from the inside out:
+//  1. the local interface and the default gateway
+//  2. the ISP next hop
+//  3. public IP addresses, without DNS
+//  4. public names, resolved via the system resolver
+//
+// The first step that fails determines the Layer: rebooting the modem is
+// pointless when only the Wi-Fi access point, or only DNS, is broken.
+//
+// A host counts as reachable when a TCP connection to it either succeeds or
+// is actively refused: both prove that packets make it there and back.
+package diagnosis
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hugoh/upd/internal/check"
+	"github.com/hugoh/upd/internal/logger"
+)
+
+// Layer is the network layer an outage was attributed to.
+type Layer string
+
+const (
+	// LayerLAN means no usable local interface, or the gateway is unreachable.
+	LayerLAN Layer = "lan"
+	// LayerISP means the gateway answers but the ISP network does not.
+	LayerISP Layer = "isp"
+	// LayerDNS means public addresses are reachable but names do not resolve.
+	LayerDNS Layer = "dns"
+	// LayerUpstream means every layer works: the probed targets themselves
+	// are failing.
+	LayerUpstream Layer = "upstream"
+)
+
+// Step names.
+const (
+	StepInterface   = "interface"
+	StepGateway     = "gateway"
+	StepISPHop      = "ispHop"
+	StepPublicIPs   = "publicIPs"
+	StepPublicNames = "publicNames"
+)
+
+const (
+	// DefaultTimeout bounds each diagnostic step.
+	DefaultTimeout = 2 * time.Second
+	// DefaultPort is dialed on hosts configured without a port.
+	DefaultPort = 80
+	// procNetRoute is the Linux routing table, used to find the gateway.
+	procNetRoute = "/proc/net/route"
+)
+
+//nolint:gochecknoglobals // read-only defaults
+var (
+	// DefaultPublicIPs are dialed by address when none are configured.
+	DefaultPublicIPs = []string{"1.1.1.1:53", "8.8.8.8:53", "9.9.9.9:53"}
+	// DefaultPublicNames are resolved when none are configured.
+	DefaultPublicNames = []string{"one.one.one.one", "dns.google"}
+)
+
+var (
+	// ErrNoInterface is returned when no non-loopback interface is up with
+	// an address.
+	ErrNoInterface = errors.New("no usable network interface")
+	// ErrNoGateway is returned when the default gateway cannot be found.
+	ErrNoGateway = errors.New("no default gateway found")
+)
+
+// Config holds the diagnosis settings. Zero values mean defaults.
+type Config struct {
+	// Gateway is the default gateway (host or host:port). Auto-detected on
+	// Linux when empty.
+	Gateway string
+	// ISPHop is the first router on the ISP side (host or host:port). The
+	// step is skipped when empty.
+	ISPHop      string
+	PublicIPs   []string
+	PublicNames []string
+	// Port is dialed on the gateway and the ISP hop when they have no port,
+	// such as an auto-detected gateway.
+	Port    int
+	Timeout time.Duration
+}
+
+// Step is the outcome of one diagnostic step.
+type Step struct {
+	Name   string
+	Target string
+	Err    error
+}
+
+// OK reports whether the step succeeded.
+func (s Step) OK() bool { return s.Err == nil }
+
+// Result is the outcome of a diagnosis.
+type Result struct {
+	Layer Layer
+	Steps []Step
+}
+
+// Diagnoser runs the diagnostic sequence.
+type Diagnoser struct {
+	cfg        Config
+	dialer     check.Dialer
+	resolver   check.DNSResolver
+	interfaces func() ([]string, error)
+	gateway    func() (string, error)
+}
+
+// New creates a Diagnoser for the given configuration.
+func New(cfg Config) *Diagnoser {
+	if len(cfg.PublicIPs) == 0 {
+		cfg.PublicIPs = DefaultPublicIPs
+	}
+
+	if len(cfg.PublicNames) == 0 {
+		cfg.PublicNames = DefaultPublicNames
+	}
+
+	cfg.Port = cmp.Or(cfg.Port, DefaultPort)
+	cfg.Timeout = cmp.Or(cfg.Timeout, DefaultTimeout)
+
+	return &Diagnoser{
+		cfg:        cfg,
+		dialer:     &net.Dialer{},
+		resolver:   net.DefaultResolver,
+		interfaces: usableInterfaces,
+		gateway:    defaultGateway,
+	}
+}
+
+// Run executes the diagnostic steps in order and stops at the first failure.
+func (d *Diagnoser) Run(ctx context.Context) Result {
+	var result Result
+
+	steps := []struct {
+		layer Layer
+		run   func(context.Context) []Step
+	}{
+		{LayerLAN, d.checkLocal},
+		{LayerISP, d.checkISP},
+		{LayerDNS, d.checkNames},
+	}
+
+	for _, step := range steps {
+		ran := step.run(ctx)
+		result.Steps = append(result.Steps, ran...)
+
+		if len(ran) > 0 && !ran[len(ran)-1].OK() {
+			result.Layer = step.layer
+
+			break
+		}
+	}
+
+	result.Layer = cmp.Or(result.Layer, LayerUpstream)
+
+	logger.Diagnosis().Info("outage diagnosed", "layer", result.Layer)
+
+	for _, step := range result.Steps {
+		logger.Diagnosis().Debug("diagnosis step",
+			"step", step.Name, "target", step.Target, "error", step.Err)
+	}
+
+	return result
+}
+
+func (d *Diagnoser) checkLocal(ctx context.Context) []Step {
+	name, err := d.localInterface()
+
+	steps := []Step{{Name: StepInterface, Target: name, Err: err}}
+	if err != nil {
+		return steps
+	}
+
+	gateway := d.cfg.Gateway
+	if gateway == "" {
+		gateway, err = d.gateway()
+		if err != nil {
+			// Not fatal: the gateway may simply not be detectable here.
+			logger.Diagnosis().Debug("skipping gateway step", "error", err)
+
+			return steps
+		}
+	}
+
+	return append(steps, Step{Name: StepGateway, Target: gateway, Err: d.reach(ctx, gateway)})
+}
+
+func (d *Diagnoser) checkISP(ctx context.Context) []Step {
+	var steps []Step
+
+	if d.cfg.ISPHop != "" {
+		steps = append(steps, Step{
+			Name:   StepISPHop,
+			Target: d.cfg.ISPHop,
+			Err:    d.reach(ctx, d.cfg.ISPHop),
+		})
+
+		if !steps[0].OK() {
+			return steps
+		}
+	}
+
+	return append(steps, d.any(StepPublicIPs, d.cfg.PublicIPs, func(target string) error {
+		return d.reach(ctx, target)
+	}))
+}
+
+func (d *Diagnoser) checkNames(ctx context.Context) []Step {
+	return []Step{d.any(StepPublicNames, d.cfg.PublicNames, func(name string) error {
+		ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+		defer cancel()
+
+		_, err := d.resolver.LookupHost(ctx, name)
+
+		return err //nolint:wrapcheck // wrapped by any
+	})}
+}
+
+// any returns a successful step for the first target that passes, or a
+// failed step carrying every error.
+func (d *Diagnoser) any(name string, targets []string, try func(string) error) Step {
+	errs := make([]error, 0, len(targets))
+
+	for _, target := range targets {
+		err := try(target)
+		if err == nil {
+			return Step{Name: name, Target: target}
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", target, err))
+	}
+
+	return Step{Name: name, Target: strings.Join(targets, ","), Err: errors.Join(errs...)}
+}
+
+// reach reports whether the host answers, counting a refused connection as
+// an answer.
+func (d *Diagnoser) reach(ctx context.Context, host string) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, strconv.Itoa(d.cfg.Port))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	conn, err := d.dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return nil
+		}
+
+		return fmt.Errorf("cannot reach %s: %w", host, err)
+	}
+
+	_ = conn.Close()
+
+	return nil
+}
+
+func (d *Diagnoser) localInterface() (string, error) {
+	names, err := d.interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	if len(names) == 0 {
+		return "", ErrNoInterface
+	}
+
+	return names[0], nil
+}
+
+// usableInterfaces returns the names of the non-loopback interfaces that are
+// up and have an address.
+func usableInterfaces() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("listing interfaces: %w", err)
+	}
+
+	var names []string
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err == nil && len(addrs) > 0 {
+			names = append(names, iface.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// defaultGateway reads the default route from the Linux routing table.
+func defaultGateway() (string, error) {
+	file, err := os.Open(procNetRoute)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrNoGateway, err)
+	}
+	defer file.Close()
+
+	return parseDefaultGateway(bufio.NewScanner(file))
+}
+
+func parseDefaultGateway(scanner *bufio.Scanner) (string, error) {
+	const (
+		destinationField = 1
+		gatewayField     = 2
+		minFields        = 3
+		defaultRoute     = "00000000"
+	)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < minFields || fields[destinationField] != defaultRoute {
+			continue
+		}
+
+		raw, err := hex.DecodeString(fields[gatewayField])
+		if err != nil || len(raw) != net.IPv4len {
+			continue
+		}
+
+		// The kernel prints the address in host (little-endian) order.
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+
+		return ip.String(), nil
+	}
+
+	return "", ErrNoGateway
+}
@@ -0,0 +1,228 @@
+package diagnosis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnreachable = errors.New("unreachable")
+
+// fakeDialer answers for the hosts in up, refuses the hosts in refused and
+// fails every other dial.
+type fakeDialer struct {
+	up      map[string]bool
+	refused map[string]bool
+	dialed  []string
+}
+
+func (f *fakeDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	f.dialed = append(f.dialed, address)
+	host, _, _ := net.SplitHostPort(address)
+
+	switch {
+	case f.up[host]:
+		client, server := net.Pipe()
+		_ = server.Close()
+
+		return client, nil
+	case f.refused[host]:
+		return nil, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	default:
+		return nil, errUnreachable
+	}
+}
+
+type fakeResolver struct {
+	ok bool
+}
+
+func (f *fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if !f.ok {
+		return nil, &net.DNSError{Name: host, Err: "no such host"}
+	}
+
+	return []string{"192.0.2.10"}, nil
+}
+
+func newTestDiagnoser(dialer *fakeDialer, resolver *fakeResolver) *Diagnoser {
+	d := New(Config{
+		Gateway:   "192.0.2.1",
+		ISPHop:    "198.51.100.1",
+		PublicIPs: []string{"203.0.113.1:53", "203.0.113.2:53"},
+	})
+	d.dialer = dialer
+	d.resolver = resolver
+	d.interfaces = func() ([]string, error) { return []string{"eth0"}, nil }
+
+	return d
+}
+
+func stepNames(r Result) []string {
+	names := make([]string, len(r.Steps))
+	for i, s := range r.Steps {
+		names[i] = s.Name
+	}
+
+	return names
+}
+
+func TestRun_Layers(t *testing.T) {
+	all := map[string]bool{
+		"192.0.2.1":    true,
+		"198.51.100.1": true,
+		"203.0.113.1":  true,
+		"203.0.113.2":  true,
+	}
+
+	without := func(hosts ...string) map[string]bool {
+		up := make(map[string]bool, len(all))
+		for h := range all {
+			up[h] = true
+		}
+
+		for _, h := range hosts {
+			delete(up, h)
+		}
+
+		return up
+	}
+
+	tests := []struct {
+		name      string
+		up        map[string]bool
+		resolving bool
+		layer     Layer
+		steps     []string
+	}{
+		{
+			name:  "gateway down",
+			up:    without("192.0.2.1"),
+			layer: LayerLAN,
+			steps: []string{StepInterface, StepGateway},
+		},
+		{
+			name:  "ISP hop down",
+			up:    without("198.51.100.1"),
+			layer: LayerISP,
+			steps: []string{StepInterface, StepGateway, StepISPHop},
+		},
+		{
+			name:  "public IPs down",
+			up:    without("203.0.113.1", "203.0.113.2"),
+			layer: LayerISP,
+			steps: []string{StepInterface, StepGateway, StepISPHop, StepPublicIPs},
+		},
+		{
+			name:  "DNS down",
+			up:    all,
+			layer: LayerDNS,
+			steps: []string{StepInterface, StepGateway, StepISPHop, StepPublicIPs, StepPublicNames},
+		},
+		{
+			name:      "everything up",
+			up:        all,
+			resolving: true,
+			layer:     LayerUpstream,
+			steps:     []string{StepInterface, StepGateway, StepISPHop, StepPublicIPs, StepPublicNames},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDiagnoser(&fakeDialer{up: tt.up}, &fakeResolver{ok: tt.resolving})
+
+			result := d.Run(t.Context())
+			assert.Equal(t, tt.layer, result.Layer)
+			assert.Equal(t, tt.steps, stepNames(result))
+		})
+	}
+}
+
+func TestRun_OnePublicIPIsEnough(t *testing.T) {
+	d := newTestDiagnoser(&fakeDialer{up: map[string]bool{
+		"192.0.2.1":    true,
+		"198.51.100.1": true,
+		"203.0.113.2":  true,
+	}}, &fakeResolver{ok: true})
+
+	result := d.Run(t.Context())
+	assert.Equal(t, LayerUpstream, result.Layer)
+	assert.Equal(t, "203.0.113.2:53", result.Steps[3].Target)
+}
+
+func TestRun_RefusedCountsAsReachable(t *testing.T) {
+	d := newTestDiagnoser(&fakeDialer{
+		up:      map[string]bool{"198.51.100.1": true, "203.0.113.1": true},
+		refused: map[string]bool{"192.0.2.1": true},
+	}, &fakeResolver{ok: true})
+
+	result := d.Run(t.Context())
+	assert.Equal(t, LayerUpstream, result.Layer)
+	assert.True(t, result.Steps[1].OK())
+}
+
+func TestRun_Port(t *testing.T) {
+	dialer := &fakeDialer{}
+	d := newTestDiagnoser(dialer, &fakeResolver{})
+	d.cfg.Gateway = ""
+	d.cfg.Port = 443
+	d.gateway = func() (string, error) { return "192.0.2.1", nil }
+
+	d.Run(t.Context())
+	assert.Equal(t, []string{"192.0.2.1:443"}, dialer.dialed)
+}
+
+func TestRun_NoInterface(t *testing.T) {
+	d := newTestDiagnoser(&fakeDialer{}, &fakeResolver{})
+	d.interfaces = func() ([]string, error) { return nil, nil }
+
+	result := d.Run(t.Context())
+	assert.Equal(t, LayerLAN, result.Layer)
+	require.Len(t, result.Steps, 1)
+	require.ErrorIs(t, result.Steps[0].Err, ErrNoInterface)
+}
+
+func TestRun_UndetectedGatewayIsSkipped(t *testing.T) {
+	d := newTestDiagnoser(&fakeDialer{up: map[string]bool{"203.0.113.1": true}}, &fakeResolver{ok: true})
+	d.cfg.Gateway = ""
+	d.cfg.ISPHop = ""
+	d.gateway = func() (string, error) { return "", ErrNoGateway }
+
+	result := d.Run(t.Context())
+	assert.Equal(t, LayerUpstream, result.Layer)
+	assert.Equal(t, []string{StepInterface, StepPublicIPs, StepPublicNames}, stepNames(result))
+}
+
+func TestNew_Defaults(t *testing.T) {
+	d := New(Config{})
+	assert.Equal(t, DefaultPublicIPs, d.cfg.PublicIPs)
+	assert.Equal(t, DefaultPublicNames, d.cfg.PublicNames)
+	assert.Equal(t, DefaultPort, d.cfg.Port)
+	assert.Equal(t, DefaultTimeout, d.cfg.Timeout)
+}
+
+func TestParseDefaultGateway(t *testing.T) {
+	table := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0002000A	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	010200C0	0003	0	0	100	00000000	0	0	0
+`
+
+	gateway, err := parseDefaultGateway(bufio.NewScanner(strings.NewReader(table)))
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", gateway)
+}
+
+func TestParseDefaultGateway_NoDefaultRoute(t *testing.T) {
+	table := "Iface\tDestination\tGateway\neth0\t0002000A\t00000000\n"
+
+	_, err := parseDefaultGateway(bufio.NewScanner(strings.NewReader(table)))
+	require.ErrorIs(t, err, ErrNoGateway)
+}
@@ -14,6 +14,9 @@ const (
 	logComponentLoop       = "loop"
 	logComponentStats      = "stats"
 	logComponentConfig     = "config"
+	logComponentDiagnosis  = "diagnosis"
+	logComponentNotify     = "notify"
+	logComponentMQTT       = "mqtt"
 	logComponentApp        = "app"
 )
 
@@ -34,6 +37,9 @@ var (
 	loopLogger       = Component(logComponentLoop)
 	statsLogger      = Component(logComponentStats)
 	configLogger     = Component(logComponentConfig)
+	diagnosisLogger  = Component(logComponentDiagnosis)
+	notifyLogger     = Component(logComponentNotify)
+	mqttLogger       = Component(logComponentMQTT)
 	appLogger        = Component(logComponentApp)
 )
 
@@ -55,6 +61,15 @@ func Stats() *slog.Logger { return statsLogger }
 // Config returns a logger for the config component.
 func Config() *slog.Logger { return configLogger }
 
+// Diagnosis returns a logger for the outage diagnosis component.
+func Diagnosis() *slog.Logger { return diagnosisLogger }
+
+// Notify returns a logger for the notification component.
+func Notify() *slog.Logger { return notifyLogger }
+
+// MQTT returns a logger for the MQTT publisher component.
+func MQTT() *slog.Logger { return mqttLogger }
+
 // App returns a logger for the app component.
 func App() *slog.Logger { return appLogger }
 
@@ -34,6 +34,9 @@ func TestComponentAccessors(t *testing.T) {
 		{"Loop", Loop},
 		{"Stats", Stats},
 		{"Config", Config},
+		{"Diagnosis", Diagnosis},
+		{"Notify", Notify},
+		{"MQTT", MQTT},
 		{"App", App},
 	}
 
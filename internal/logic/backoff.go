@@ -0,0 +1,90 @@
+package logic
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// UpcomingRuns is how many planned executions DownActionLoop.Status lists.
+const UpcomingRuns = 5
+
+// Backoff computes the delays between repetitions of a stage action.
+type Backoff interface {
+	// Delay returns the delay before repetition n, 1 being the first one,
+	// and whether it reached the cap of the strategy.
+	Delay(n uint32) (time.Duration, bool)
+}
+
+// FixedBackoff repeats every Every.
+type FixedBackoff struct {
+	Every time.Duration
+}
+
+// Delay implements Backoff.
+func (b FixedBackoff) Delay(uint32) (time.Duration, bool) {
+	return b.Every, false
+}
+
+// LinearBackoff waits Every, then Step longer each repetition, up to Limit
+// when not 0.
+type LinearBackoff struct {
+	Every time.Duration
+	Step  time.Duration
+	Limit time.Duration
+}
+
+// Delay implements Backoff.
+func (b LinearBackoff) Delay(n uint32) (time.Duration, bool) {
+	return capped(b.Every+time.Duration(n-1)*b.Step, b.Limit)
+}
+
+// ExponentialBackoff waits Every, then Factor times longer each repetition,
+// up to Limit when not 0.
+type ExponentialBackoff struct {
+	Every  time.Duration
+	Factor float64
+	Limit  time.Duration
+}
+
+// Delay implements Backoff.
+func (b ExponentialBackoff) Delay(n uint32) (time.Duration, bool) {
+	delay := float64(b.Every) * math.Pow(b.Factor, float64(n-1))
+	if delay >= math.MaxInt64 {
+		return capped(math.MaxInt64, b.Limit)
+	}
+
+	return capped(time.Duration(delay), b.Limit)
+}
+
+// ScheduleBackoff waits each of its delays in turn, then repeats the last one.
+type ScheduleBackoff []time.Duration
+
+// Delay implements Backoff.
+func (b ScheduleBackoff) Delay(n uint32) (time.Duration, bool) {
+	if int(n) >= len(b) {
+		return b[len(b)-1], true
+	}
+
+	return b[n-1], false
+}
+
+func capped(delay, limit time.Duration) (time.Duration, bool) {
+	if limit != 0 && delay >= limit {
+		return limit, true
+	}
+
+	return delay, false
+}
+
+// jittered spreads delay uniformly by up to ±fraction of it.
+func jittered(delay time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return delay
+	}
+
+	//nolint:gosec // jitter does not need a cryptographic source
+	spread := fraction * (2*rand.Float64() - 1)
+
+	return time.Duration(float64(delay) * (1 + spread))
+}
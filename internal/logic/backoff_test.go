@@ -0,0 +1,155 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func delays(b Backoff, n int) []time.Duration {
+	result := make([]time.Duration, n)
+	for i := range result {
+		result[i], _ = b.Delay(uint32(i + 1)) //nolint:gosec // tiny test values
+	}
+
+	return result
+}
+
+func TestBackoff_Strategies(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+		want    []time.Duration
+	}{
+		{
+			name:    "fixed",
+			backoff: FixedBackoff{Every: time.Minute},
+			want:    []time.Duration{time.Minute, time.Minute, time.Minute, time.Minute},
+		},
+		{
+			name:    "linear",
+			backoff: LinearBackoff{Every: time.Minute, Step: 2 * time.Minute, Limit: 6 * time.Minute},
+			want:    []time.Duration{time.Minute, 3 * time.Minute, 5 * time.Minute, 6 * time.Minute},
+		},
+		{
+			name:    "exponential",
+			backoff: ExponentialBackoff{Every: time.Minute, Factor: 2},
+			want:    []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute},
+		},
+		{
+			name:    "schedule",
+			backoff: ScheduleBackoff{time.Minute, 5 * time.Minute, 15 * time.Minute},
+			want:    []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, 15 * time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, delays(tt.backoff, len(tt.want)))
+		})
+	}
+}
+
+func TestBackoff_Capped(t *testing.T) {
+	_, capped := ExponentialBackoff{Every: time.Minute, Factor: 2, Limit: 3 * time.Minute}.Delay(2)
+	assert.False(t, capped)
+
+	delay, capped := ExponentialBackoff{Every: time.Minute, Factor: 2, Limit: 3 * time.Minute}.Delay(3)
+	assert.True(t, capped)
+	assert.Equal(t, 3*time.Minute, delay)
+
+	_, capped = ScheduleBackoff{time.Minute, time.Hour}.Delay(1)
+	assert.False(t, capped)
+
+	_, capped = ScheduleBackoff{time.Minute, time.Hour}.Delay(2)
+	assert.True(t, capped)
+
+	delay, capped = ExponentialBackoff{Every: time.Hour, Factor: 10}.Delay(100)
+	assert.False(t, capped)
+	assert.Positive(t, delay, "huge delays must not overflow")
+}
+
+func TestJittered(t *testing.T) {
+	assert.Equal(t, time.Minute, jittered(time.Minute, 0))
+
+	for range 100 {
+		d := jittered(time.Minute, 0.1)
+		assert.GreaterOrEqual(t, d, 54*time.Second)
+		assert.LessOrEqual(t, d, 66*time.Second)
+	}
+}
+
+func Test_nextSleep_UsesBackoff(t *testing.T) {
+	da := &DownAction{
+		Exec:    testTrue,
+		Backoff: ScheduleBackoff{time.Minute, 5 * time.Minute},
+	}
+	dal, _ := da.NewDownActionLoop(t.Context())
+
+	assert.Equal(t, time.Minute, dal.nextSleep())
+	assert.False(t, dal.limitReached.Load())
+	assert.Equal(t, 5*time.Minute, dal.nextSleep())
+	assert.True(t, dal.limitReached.Load())
+	assert.Equal(t, 5*time.Minute, dal.nextSleep())
+}
+
+func Test_nextSleep_Jitter(t *testing.T) {
+	da := &DownAction{Exec: testTrue, Every: time.Minute, Jitter: 0.5}
+	dal, _ := da.NewDownActionLoop(t.Context())
+
+	seen := map[time.Duration]bool{}
+
+	for range 10 {
+		dal.iteration.Store(0)
+
+		d := dal.nextSleep()
+		assert.GreaterOrEqual(t, d, 30*time.Second)
+		assert.LessOrEqual(t, d, 90*time.Second)
+
+		seen[d] = true
+	}
+
+	assert.Greater(t, len(seen), 1, "delays should vary")
+}
+
+func Test_Status_Upcoming(t *testing.T) {
+	da := &DownAction{
+		Stages: []DownActionStage{
+			{After: 0, Exec: testTrue, Backoff: FixedBackoff{Every: time.Minute}},
+			{After: 150 * time.Second, Exec: testTrue},
+			{After: time.Hour, Exec: testTrue, Every: time.Minute},
+		},
+	}
+	dal, _ := da.NewDownActionLoop(t.Context())
+	assert.Empty(t, dal.Status().Upcoming, "nothing planned before the loop sleeps")
+
+	start := dal.started.Round(0)
+	dal.nextRunAt.Store(start.UnixNano())
+
+	assert.Equal(t, []time.Time{
+		start,
+		start.Add(time.Minute),
+		start.Add(2 * time.Minute),
+		start.Add(150 * time.Second),
+		start.Add(time.Hour),
+	}, dal.Status().Upcoming)
+}
+
+func Test_Status_UpcomingWhileRunning(t *testing.T) {
+	da := &DownAction{After: time.Hour, Every: time.Minute, Exec: testTrue}
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return len(dal.Status().Upcoming) == UpcomingRuns
+	}, time.Second, time.Millisecond)
+
+	upcoming := dal.Status().Upcoming
+	assert.WithinDuration(t, time.Now().Add(time.Hour), upcoming[0], time.Second)
+	assert.Equal(t, time.Minute, upcoming[1].Sub(upcoming[0]))
+	assert.Equal(t, time.Duration(1.5*float64(time.Minute)), upcoming[2].Sub(upcoming[1]))
+
+	dal.Stop(t.Context())
+	assert.Empty(t, dal.Status().Upcoming)
+}
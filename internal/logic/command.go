@@ -0,0 +1,202 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotRoot is returned when a command should run as another user while upd
+// does not run as root.
+var ErrNotRoot = errors.New("running commands as another user requires root")
+
+// CommandOptions sets up the process of down action commands. The zero value
+// runs them like upd itself, with its whole environment.
+type CommandOptions struct {
+	// User and Group, names or numeric IDs, run commands with these
+	// credentials. Group defaults to the primary group of User.
+	User  string
+	Group string
+	// Dir is the working directory, the one of upd when empty.
+	Dir string
+	// EnvAllow, when not nil, lists the only variables of the environment of
+	// upd passed on. HOME, USER and LOGNAME are set for User.
+	EnvAllow []string
+	// Env holds additional variables, in KEY=value form.
+	Env []string
+	// Umask, when set, is the file mode creation mask of commands, set by sh
+	// before it executes them.
+	Umask *os.FileMode
+	// Timeout, when not 0, bounds how long a down command may run.
+	Timeout time.Duration
+}
+
+// credential holds the resolved identity commands run as.
+type credential struct {
+	uid    uint32
+	gid    uint32
+	groups []uint32
+	name   string
+	home   string
+}
+
+// apply sets the environment, working directory and credentials of cmd.
+// actionEnv, the UPD_ variables, comes last so that it takes precedence.
+func (o *CommandOptions) apply(cmd *exec.Cmd, actionEnv []string) error {
+	cred, err := o.credential()
+	if err != nil {
+		return err
+	}
+
+	if cred != nil {
+		if err := setCredential(cmd, cred); err != nil {
+			return err
+		}
+	}
+
+	env := os.Environ()
+	if o.EnvAllow != nil {
+		env = slices.DeleteFunc(env, func(kv string) bool {
+			name, _, _ := strings.Cut(kv, "=")
+
+			return !slices.Contains(o.EnvAllow, name)
+		})
+	}
+
+	if cred != nil {
+		env = append(env, "HOME="+cred.home, "USER="+cred.name, "LOGNAME="+cred.name)
+	}
+
+	env = append(env, o.Env...)
+	cmd.Env = append(env, actionEnv...)
+	cmd.Dir = o.Dir
+
+	return nil
+}
+
+// Start sets up cmd like apply and starts it with the umask, if any. It runs
+// notification commands like down action commands.
+func (o *CommandOptions) Start(cmd *exec.Cmd, actionEnv []string) error {
+	if err := o.apply(cmd, actionEnv); err != nil {
+		return err
+	}
+
+	return startWithUmask(cmd, o.Umask)
+}
+
+// credential resolves User and Group, nil when commands run as upd.
+func (o *CommandOptions) credential() (*credential, error) {
+	if o.User == "" && o.Group == "" {
+		return nil, nil //nolint:nilnil // no credential to set
+	}
+
+	u, err := lookupUser(o.User)
+	if err != nil {
+		return nil, err
+	}
+
+	gid := u.Gid
+	if o.Group != "" {
+		g, err := lookupGroup(o.Group)
+		if err != nil {
+			return nil, err
+		}
+
+		gid = g.Gid
+	}
+
+	cred := &credential{name: u.Username, home: u.HomeDir}
+
+	if cred.uid, err = parseID(u.Uid); err != nil {
+		return nil, err
+	}
+
+	if cred.gid, err = parseID(gid); err != nil {
+		return nil, err
+	}
+
+	if o.Group == "" {
+		// Supplementary groups are best effort: they are not always listed.
+		ids, _ := u.GroupIds()
+		for _, id := range ids {
+			if n, err := parseID(id); err == nil && n != cred.gid {
+				cred.groups = append(cred.groups, n)
+			}
+		}
+	}
+
+	if os.Geteuid() != 0 {
+		if int(cred.uid) != os.Geteuid() || int(cred.gid) != os.Getegid() {
+			return nil, ErrNotRoot
+		}
+
+		// Already running as cred, which cannot be set again without root.
+		return nil, nil //nolint:nilnil // no credential to set
+	}
+
+	return cred, nil
+}
+
+// lookupUser finds a user by name or ID, the current user when empty.
+func lookupUser(name string) (*user.User, error) {
+	if name == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("current user: %w", err)
+		}
+
+		return u, nil
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, convErr := strconv.Atoi(name); convErr == nil {
+			u, err = user.LookupId(name)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("user %q: %w", name, err)
+	}
+
+	return u, nil
+}
+
+// lookupGroup finds a group by name or ID.
+func lookupGroup(name string) (*user.Group, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		if _, convErr := strconv.Atoi(name); convErr == nil {
+			g, err = user.LookupGroupId(name)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("group %q: %w", name, err)
+	}
+
+	return g, nil
+}
+
+func parseID(id string) (uint32, error) {
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("numeric ID %q: %w", id, err)
+	}
+
+	return uint32(n), nil
+}
+
+// Validate checks that the user and group exist, and that upd can switch to
+// them.
+func (o *CommandOptions) Validate() error {
+	_, err := o.credential()
+
+	return err
+}
@@ -0,0 +1,106 @@
+package logic
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/notify"
+	"github.com/hugoh/upd/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runWith runs command with opts and returns its history record.
+func runWith(t *testing.T, opts CommandOptions, command string) status.CommandRecord {
+	t.Helper()
+
+	dal, _ := (&DownAction{Command: opts}).NewDownActionLoop(t.Context())
+	require.NoError(t, dal.Execute(t.Context(), command))
+	dal.cmdWG.Wait()
+
+	history := dal.Status().History
+	require.Len(t, history, 1)
+
+	return history[0]
+}
+
+func Test_Command_InheritsEnvironment(t *testing.T) {
+	t.Setenv("UPD_TEST_SECRET", "hunter2")
+
+	rec := runWith(t, CommandOptions{}, "printenv UPD_TEST_SECRET")
+	assert.Equal(t, "hunter2", strings.TrimSpace(rec.Stdout))
+}
+
+func Test_Command_EnvAllowlist(t *testing.T) {
+	t.Setenv("UPD_TEST_SECRET", "hunter2")
+	t.Setenv("UPD_TEST_KEEP", "kept")
+
+	rec := runWith(t, CommandOptions{
+		EnvAllow: []string{"PATH", "UPD_TEST_KEEP"},
+		Env:      []string{"MODEM_HOST=192.168.100.1", "UPD_EVENT=overridden"},
+	}, "env")
+
+	assert.NotContains(t, rec.Stdout, "UPD_TEST_SECRET")
+	assert.Contains(t, rec.Stdout, "UPD_TEST_KEEP=kept")
+	assert.Contains(t, rec.Stdout, "MODEM_HOST=192.168.100.1")
+	assert.Contains(t, rec.Stdout, "UPD_STAGE=1", "the action context is always passed")
+	assert.NotContains(t, rec.Stdout, "UPD_EVENT=overridden", "the action context takes precedence")
+}
+
+func Test_Command_Dir(t *testing.T) {
+	dir := t.TempDir()
+
+	rec := runWith(t, CommandOptions{Dir: dir}, "pwd")
+	assert.Equal(t, dir, strings.TrimSpace(rec.Stdout))
+}
+
+func Test_Command_NotifyExecSink(t *testing.T) {
+	t.Setenv("UPD_TEST_SECRET", "hunter2")
+
+	dir := t.TempDir()
+	opts := CommandOptions{Dir: dir, EnvAllow: []string{"PATH"}}
+	sink := &notify.ExecSink{Command: "sh -c 'pwd > out; env >> out'", Start: opts.Start}
+
+	require.NoError(t, sink.Send(t.Context(), notify.Message{Event: notify.Event{Type: notify.EventUp}}))
+
+	data, err := os.ReadFile(filepath.Join(dir, "out")) // #nosec G304 -- path under t.TempDir()
+	require.NoError(t, err)
+
+	out := string(data)
+	assert.True(t, strings.HasPrefix(out, dir+"\n"), "notification commands run in the directory")
+	assert.NotContains(t, out, "UPD_TEST_SECRET")
+	assert.Contains(t, out, "UPD_EVENT=up")
+}
+
+func Test_Command_Timeout(t *testing.T) {
+	start := time.Now()
+
+	rec := runWith(t, CommandOptions{Timeout: 50 * time.Millisecond}, "sleep 5")
+
+	assert.Less(t, time.Since(start), 4*time.Second)
+	assert.True(t, rec.Killed)
+}
+
+func Test_Command_InvalidUser(t *testing.T) {
+	opts := CommandOptions{User: "upd-no-such-user"}
+	require.Error(t, opts.Validate())
+
+	dal, _ := (&DownAction{Command: opts}).NewDownActionLoop(t.Context())
+	require.Error(t, dal.Execute(t.Context(), "true"))
+
+	history := dal.Status().History
+	require.Len(t, history, 1)
+	assert.Contains(t, history[0].Error, "upd-no-such-user")
+}
+
+func Test_Command_CurrentUser(t *testing.T) {
+	current, err := user.Current()
+	require.NoError(t, err)
+
+	opts := CommandOptions{User: current.Username}
+	require.NoError(t, opts.Validate(), "running as the current user needs no privilege")
+}
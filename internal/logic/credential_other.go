@@ -0,0 +1,25 @@
+//go:build !unix
+
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// setCredential fails: commands can only run as another user on Unix.
+func setCredential(*exec.Cmd, *credential) error {
+	return fmt.Errorf("running commands as another user: %w", errors.ErrUnsupported)
+}
+
+// startWithUmask starts cmd, failing if a umask is set: it only exists on
+// Unix.
+func startWithUmask(cmd *exec.Cmd, umask *os.FileMode) error {
+	if umask != nil {
+		return fmt.Errorf("umask: %w", errors.ErrUnsupported)
+	}
+
+	return cmd.Start() //nolint:wrapcheck // wrapped by the caller
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package logic
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// umaskShell sets the umask of the command it then runs in its place, "$@".
+const umaskShell = `umask %04o && exec "$@"`
+
+// setCredential runs cmd as cred.
+func setCredential(cmd *exec.Cmd, cred *credential) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    cred.uid,
+		Gid:    cred.gid,
+		Groups: cred.groups,
+	}
+
+	return nil
+}
+
+// startWithUmask starts cmd with the given file mode creation mask, if any.
+// The mask is set by a shell that then executes the command, since the mask
+// of the upd process applies to all its goroutines.
+func startWithUmask(cmd *exec.Cmd, umask *os.FileMode) error {
+	// A command that was not found fails to start as is.
+	if umask != nil && cmd.Err == nil {
+		shell, err := exec.LookPath("sh")
+		if err != nil {
+			return fmt.Errorf("umask: %w", err)
+		}
+
+		cmd.Args = append([]string{"sh", "-c", fmt.Sprintf(umaskShell, *umask), "sh", cmd.Path}, cmd.Args[1:]...)
+		cmd.Path = shell
+	}
+
+	return cmd.Start() //nolint:wrapcheck // wrapped by the caller
+}
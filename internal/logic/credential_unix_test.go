@@ -0,0 +1,63 @@
+//go:build unix
+
+package logic
+
+import (
+	"os"
+	"os/user"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Command_Umask(t *testing.T) {
+	umask := os.FileMode(0o027)
+	previous := currentUmask()
+
+	rec := runWith(t, CommandOptions{Umask: &umask}, `sh -c 'umask; echo "$0" "$1"' first second`)
+	assert.Equal(t, "0027\nfirst second", strings.TrimSpace(rec.Stdout), "arguments are passed as is")
+	assert.NotContains(t, rec.Command, "exec", "the history shows the command without the umask shell")
+
+	assert.Equal(t, previous, currentUmask(), "the umask of upd does not change")
+}
+
+// currentUmask returns the umask of the test process.
+func currentUmask() int {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+
+	return mask
+}
+
+func Test_Command_User(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+
+	rec := runWith(t, CommandOptions{User: "nobody", EnvAllow: []string{"PATH"}},
+		`sh -c 'id -u; id -g; echo $HOME'`)
+	require.Empty(t, rec.Error)
+
+	lines := strings.Split(strings.TrimSpace(rec.Stdout), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, nobody.Uid, lines[0])
+	assert.Equal(t, nobody.Gid, lines[1])
+	assert.Equal(t, nobody.HomeDir, lines[2])
+}
+
+func Test_Command_NotRoot(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("only applies when not running as root")
+	}
+
+	opts := CommandOptions{User: "root"}
+	require.ErrorIs(t, opts.Validate(), ErrNotRoot)
+}
@@ -0,0 +1,87 @@
+package logic
+
+import (
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+	"github.com/hugoh/upd/internal/notify"
+	"github.com/hugoh/upd/internal/schedule"
+)
+
+// Digest schedules a notification summarizing the past period.
+type Digest struct {
+	// At is sent at the start of each occurrence of the window; only its
+	// days, start time and location are used.
+	At schedule.Window
+	// Period is how far back the digest looks for outages.
+	Period time.Duration
+}
+
+// SetDigest schedules the digest; nil disables it. State changes are kept
+// for the digest period too. Must be called from Reload, or before Run.
+func (l *Loop) SetDigest(digest *Digest) {
+	if l.digestTimer != nil {
+		l.digestTimer.Stop()
+		l.digestTimer = nil
+	}
+
+	l.digest = digest
+	l.status.SetRetention(l.retention())
+	l.scheduleDigest(time.Now())
+}
+
+func (l *Loop) scheduleDigest(now time.Time) {
+	if l.digest == nil {
+		return
+	}
+
+	next := l.digest.At.Next(now)
+	logger.Loop().Debug("digest scheduled", "at", next)
+	l.digestTimer = time.NewTimer(next.Sub(now))
+}
+
+// digestDue returns the channel of the next digest, nil when none is
+// scheduled.
+func (l *Loop) digestDue() <-chan time.Time {
+	if l.digestTimer == nil {
+		return nil
+	}
+
+	return l.digestTimer.C
+}
+
+// sendDigest notifies the availability and the outages of the digest period,
+// then schedules the next digest.
+func (l *Loop) sendDigest() {
+	now := time.Now()
+	outages, complete := l.status.OutagesSince(now.Add(-l.digest.Period))
+
+	ev := notify.Event{
+		Type:             notify.EventDigest,
+		Time:             now,
+		Period:           l.digest.Period,
+		Availability:     availability(l.status.PeriodReports([]time.Duration{l.digest.Period})),
+		OutagesTruncated: !complete,
+	}
+
+	for _, o := range outages {
+		outage := notify.Outage{
+			Start:    o.Start,
+			Duration: time.Duration(o.Duration),
+			FixedBy:  o.FixedBy,
+		}
+
+		if o.End != nil {
+			outage.End = *o.End
+		}
+
+		if o.Diagnosis != nil {
+			outage.Diagnosis = o.Diagnosis.Layer
+		}
+
+		ev.Outages = append(ev.Outages, outage)
+	}
+
+	l.Notify(ev)
+	l.scheduleDigest(now)
+}
@@ -4,37 +4,173 @@ package logic
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"os/exec"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/shlex"
 	"github.com/hugoh/upd/internal/logger"
+	"github.com/hugoh/upd/internal/notify"
 	"github.com/hugoh/upd/internal/status"
 )
 
 // DownAction holds configuration for actions executed when connection is down.
+// Either one of Exec, Webhook and PowerCycle (with After, Every,
+// BackoffLimit, Backoff and Jitter), or Stages is set. StopExec and
+// StopWebhook run when the connection comes back.
 type DownAction struct {
 	After        time.Duration
 	Every        time.Duration
 	BackoffLimit time.Duration
+	Backoff      Backoff
+	Jitter       float64
 	Exec         string
+	Webhook      *Webhook
+	PowerCycle   *PowerCycle
 	StopExec     string
+	StopWebhook  *Webhook
+	Stages       []DownActionStage
+	// StdinJSON sends the ActionContext as JSON on the stdin of commands.
+	StdinJSON bool
+	// RecheckExitCode, when not 0, is the exit code with which a command
+	// reports that it fixed the connection: a check runs immediately.
+	RecheckExitCode int
+	// GiveUpExitCode, when not 0, is the exit code with which a command
+	// stops the down action loop until the connection comes back.
+	GiveUpExitCode int
+	// FailureBudget, when not 0, is how many commands may fail with another
+	// non-zero exit code during an outage before the loop gives up.
+	FailureBudget int
+	// MaxPerDay, when not 0, caps how many actions run per rolling
+	// RateLimitWindow, across outages and stages.
+	MaxPerDay int
+	// MinInterval, when not 0, is the minimum time between two actions,
+	// across outages and stages. Actions over a limit are skipped.
+	MinInterval time.Duration
+	// Command sets up the process of commands: credentials, working
+	// directory, environment, umask and the timeout of Exec.
+	Command CommandOptions
+	// DryRun logs and records the actions instead of running them, and
+	// leaves the rate limits and the state file alone.
+	DryRun bool
+	// KillGrace is how long terminated commands, and the process groups they
+	// started on Unix, may take to exit before they are killed;
+	// DefaultKillGrace when 0.
+	KillGrace time.Duration
+	// State, when set, persists the schedule so that it resumes after a
+	// restart or reload instead of starting over.
+	State *StateFile
+	// history records executed commands and executions when actions ran.
+	// Set by the Loop so that they survive individual outages.
+	history    *commandHistory
+	executions *executionLog
+	// recheck asks the Loop for an immediate check. Set by the Loop.
+	recheck func()
+	// maintenance suppresses actions during its windows. Set by the Loop.
+	maintenance *maintenanceWindows
+	// notify sends the outcome of actions. Set by the Loop.
+	notify func(notify.Event)
+}
+
+// DownActionStage is one step of an escalation ladder. Its command first runs
+// After the outage started, then repeats with backoff until the connection
+// comes back or the next stage starts.
+//
+// Backoff, when set, replaces the default exponential backoff from Every by
+// BackoffFactor up to BackoffLimit. Jitter, between 0 and 1, spreads each
+// delay by up to that fraction of it, so that hosts do not act in lockstep.
+type DownActionStage struct {
+	Name         string
+	After        time.Duration
+	Every        time.Duration
+	BackoffLimit time.Duration
+	Backoff      Backoff
+	Jitter       float64
+	Exec         string
+	Webhook      *Webhook
+	PowerCycle   *PowerCycle
+}
+
+// label returns the stage name, or its 1-based position when unnamed.
+func (s *DownActionStage) label(idx int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	return fmt.Sprintf("stage %d", idx+1)
+}
+
+// backoff returns the repetition strategy of the stage, nil when its action
+// runs only once.
+//
+//nolint:ireturn // strategies are pluggable
+func (s *DownActionStage) backoff() Backoff {
+	switch {
+	case s.Backoff != nil:
+		return s.Backoff
+	case s.Every > 0:
+		return ExponentialBackoff{Every: s.Every, Factor: BackoffFactor, Limit: s.BackoffLimit}
+	default:
+		return nil
+	}
+}
+
+// stages returns the escalation ladder, a single stage for a plain Exec.
+func (da *DownAction) stages() []DownActionStage {
+	if len(da.Stages) > 0 {
+		return da.Stages
+	}
+
+	return []DownActionStage{{
+		After:        da.After,
+		Every:        da.Every,
+		BackoffLimit: da.BackoffLimit,
+		Backoff:      da.Backoff,
+		Jitter:       da.Jitter,
+		Exec:         da.Exec,
+		Webhook:      da.Webhook,
+		PowerCycle:   da.PowerCycle,
+	}}
 }
 
 // DownActionLoop manages execution of down action commands.
 type DownActionLoop struct {
-	da           *DownAction
-	cancelFunc   context.CancelFunc
-	iteration    atomic.Uint32
-	sleepTime    atomic.Int64
+	da         *DownAction
+	info       OutageInfoFunc
+	cancelFunc context.CancelFunc
+	stages     []DownActionStage
+	started    time.Time
+	// stage is the index of the current stage; executed is 1 + the index of
+	// the last stage whose command was started, 0 if none was.
+	stage     atomic.Int32
+	executed  atomic.Int32
+	iteration atomic.Uint32
+	sleepTime atomic.Int64
+	// nextRunAt is when the current sleep ends, in Unix nanoseconds; 0 when
+	// the loop is not sleeping.
+	nextRunAt    atomic.Int64
 	limitReached atomic.Bool
-	currentCmd   *exec.Cmd
-	cmdMu        sync.Mutex
+	currentCmd   *commandRun
+	history      *commandHistory
+	executions   *executionLog
+	skipped      atomic.Uint32
+	suppressed   atomic.Uint32
+	// resumeAt is when the restored schedule runs next; done means the
+	// restored schedule had completed. Only used by the run goroutine.
+	resumeAt time.Time
+	done     bool
+	failures atomic.Int32
+	cmdMu    sync.Mutex
+	// gaveUp is why the loop gave up, "" while it runs. Guarded by cmdMu.
+	gaveUp string
+	// leftovers are the down commands that exited with processes of their
+	// group still running, reaped once the loop ends. Guarded by cmdMu.
+	leftovers []*commandRun
 	// zero value means "nothing to wait for", so Stop() works even if
 	// Start() was never called.
 	runWG sync.WaitGroup
@@ -46,7 +182,7 @@ type DownActionLoop struct {
 // StopExecTimeout bounds how long the stop command may run.
 const StopExecTimeout = 30 * time.Second
 
-// BackoffFactor is the multiplier for exponential backoff.
+// BackoffFactor is the multiplier of the default exponential backoff.
 // Each iteration beyond the second will increase the delay by this factor.
 // Value of 1.5 results in: 10s -> 15s -> 22.5s -> 33.75s...
 const BackoffFactor = 1.5
@@ -72,17 +208,26 @@ func validateCommand(command []string) error {
 
 // Execute runs the specified command string with the iteration context.
 func (dal *DownActionLoop) Execute(ctx context.Context, execString string) error {
-	cmd, stderrBuf, err := dal.startCommand(ctx, execString)
+	cancel := context.CancelFunc(func() {})
+	if timeout := dal.da.Command.Timeout; timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	run, err := dal.startCommand(ctx, execString, EventDown)
 	if err != nil {
+		cancel()
+
 		return err
 	}
 
 	dal.cmdMu.Lock()
-	dal.currentCmd = cmd
+	dal.currentCmd = run
 	dal.cmdMu.Unlock()
 
 	dal.cmdWG.Go(func() {
-		dal.waitForCmd(cmd, stderrBuf)
+		defer cancel()
+
+		dal.waitForCmd(ctx, run)
 	})
 
 	return nil
@@ -94,15 +239,30 @@ func (da *DownAction) NewDownActionLoop(ctx context.Context) (*DownActionLoop, c
 	dal := &DownActionLoop{
 		da:         da,
 		cancelFunc: cancelFunc,
+		stages:     da.stages(),
+		started:    time.Now(),
+		history:    da.history,
+		executions: da.executions,
 	}
-	dal.sleepTime.Store(int64(da.After))
+
+	if dal.history == nil {
+		dal.history = &commandHistory{}
+	}
+
+	if dal.executions == nil {
+		dal.executions = &executionLog{}
+	}
+	dal.sleepTime.Store(int64(dal.stages[0].After))
+	dal.restore()
 
 	return dal, ctx
 }
 
-// Start begins the down action loop in a goroutine.
-func (da *DownAction) Start(ctx context.Context) *DownActionLoop {
+// Start begins the down action loop in a goroutine. info, if not nil,
+// describes the outage to each command.
+func (da *DownAction) Start(ctx context.Context, info OutageInfoFunc) *DownActionLoop {
 	dal, ctx := da.NewDownActionLoop(ctx)
+	dal.info = info
 	dal.runWG.Add(1)
 
 	logger.DownAction().Debug("kicking off run loop")
@@ -114,143 +274,485 @@ func (da *DownAction) Start(ctx context.Context) *DownActionLoop {
 
 // Stop cancels the loop, waits for it to exit so it can't start a new
 // command during cleanup, then runs the stop command to completion.
-func (dal *DownActionLoop) Stop(_ context.Context) {
+func (dal *DownActionLoop) Stop(ctx context.Context) {
+	dal.Suspend(ctx)
+	dal.finish()
+}
+
+// StopRecovered stops the loop like Stop once the connection is back up.
+// info describes the outage to the stop action, since the loop has already
+// reset its failures and diagnosis.
+func (dal *DownActionLoop) StopRecovered(ctx context.Context, info OutageInfo) {
+	dal.Suspend(ctx)
+	// The loop has exited: nothing else reads info anymore.
+	dal.info = func() OutageInfo { return info }
+	dal.finish()
+}
+
+// finish records the end of the outage and runs the stop action.
+func (dal *DownActionLoop) finish() {
+	dal.saveState(nil)
+
+	if mw := dal.da.maintenance.active(time.Now()); mw != nil && dal.executed.Load() == 0 {
+		logger.DownAction().Info("maintenance window: skipping stop action",
+			"window", mw.Name, "until", mw.Until)
+
+		return
+	}
+
+	if dal.da.StopExec != "" {
+		//nolint:contextcheck // intentionally detached: must survive loop cancellation
+		dal.runStopExec()
+	}
+
+	if dal.da.StopWebhook != nil {
+		//nolint:contextcheck // intentionally detached: must survive loop cancellation
+		dal.runStopWebhook()
+	}
+}
+
+// Suspend cancels the loop and kills its command, along with what earlier
+// commands left running, but does not run the stop action: the outage is not
+// over. Its saved state lets a later loop resume.
+func (dal *DownActionLoop) Suspend(_ context.Context) {
 	logger.DownAction().Debug("sending shutdown signal")
 	dal.cancelFunc()
 	dal.runWG.Wait()
 	dal.killCurrentCmd()
 	dal.cmdWG.Wait()
+	dal.reapLeftovers()
+}
 
-	if dal.da.StopExec != "" {
-		//nolint:contextcheck // intentionally detached: must survive loop cancellation
-		dal.runStopExec()
+// reapLeftovers terminates the processes left running by down commands that
+// exited, such as a backgrounded curl.
+func (dal *DownActionLoop) reapLeftovers() {
+	dal.cmdMu.Lock()
+	runs := dal.leftovers
+	dal.leftovers = nil
+	dal.cmdMu.Unlock()
+
+	runs = slices.DeleteFunc(runs, func(r *commandRun) bool { return !groupRunning(r.Process) })
+	if len(runs) == 0 {
+		return
 	}
+
+	logger.DownAction().Warn("terminating processes left by commands", "commands", len(runs))
+	stopGroups(dal.da.killGrace(), runs...)
 }
 
 // Status returns a snapshot of the current down action loop state.
 func (dal *DownActionLoop) Status() status.DownActionStatus {
+	idx := int(dal.stage.Load())
+
+	dal.cmdMu.Lock()
+	gaveUp := dal.gaveUp
+	dal.cmdMu.Unlock()
+
+	limit := dal.executions.check(dal.da, time.Now())
+
+	var nextAllowed *time.Time
+	if limit.reason != "" {
+		nextAllowed = &limit.next
+	}
+
 	return status.DownActionStatus{
+		Stage:         idx + 1,
+		StageName:     dal.stages[idx].Name,
 		Iteration:     dal.iteration.Load(),
 		SleepTime:     status.ReadableDuration(time.Duration(dal.sleepTime.Load())),
 		BackoffCapped: dal.limitReached.Load(),
+		Failures:      int(dal.failures.Load()),
+		GaveUp:        gaveUp,
+		Executions24h: limit.recent,
+		Skipped:       dal.skipped.Load(),
+		Suppressed:    dal.suppressed.Load(),
+		RateLimited:   limit.reason,
+		NextAllowedAt: nextAllowed,
+		Upcoming:      dal.upcoming(),
+		DryRun:        dal.da.DryRun,
+		History:       dal.history.snapshot(),
+	}
+}
+
+// upcoming returns the next UpcomingRuns planned executions, across stages.
+// Later ones are before jitter, and do not account for maintenance windows
+// or rate limits.
+func (dal *DownActionLoop) upcoming() []time.Time {
+	next := dal.nextRunAt.Load()
+	if next == 0 {
+		return nil
+	}
+
+	at := time.Unix(0, next)
+	started := dal.started.Round(0)
+	idx := int(dal.stage.Load())
+	n := dal.iteration.Load()
+
+	var times []time.Time
+
+	for len(times) < UpcomingRuns && idx < len(dal.stages) {
+		if idx+1 < len(dal.stages) {
+			if nextStage := started.Add(dal.stages[idx+1].After); !at.Before(nextStage) {
+				idx, n, at = idx+1, 0, nextStage
+
+				continue
+			}
+		}
+
+		times = append(times, at)
+
+		backoff := dal.stages[idx].backoff()
+		if backoff == nil {
+			idx, n = idx+1, 0
+			if idx < len(dal.stages) {
+				at = latest(at, started.Add(dal.stages[idx].After))
+			}
+
+			continue
+		}
+
+		n++
+		delay, _ := backoff.Delay(n)
+		at = at.Add(delay)
+	}
+
+	return times
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
 	}
+
+	return b
+}
+
+// ExecutedStage returns the name (or position) of the last stage whose
+// command was started, or "" if no command ran.
+func (dal *DownActionLoop) ExecutedStage() string {
+	executed := int(dal.executed.Load())
+	if executed == 0 {
+		return ""
+	}
+
+	return dal.stages[executed-1].label(executed - 1)
+}
+
+func (dal *DownActionLoop) current() *DownActionStage {
+	return &dal.stages[dal.stage.Load()]
+}
+
+// ActionContext returns the outage context for a command run for event.
+func (dal *DownActionLoop) ActionContext(event string) ActionContext {
+	var info OutageInfo
+	if dal.info != nil {
+		info = dal.info()
+	}
+
+	actx := ActionContext{
+		Event:          event,
+		Name:           info.Name,
+		Iteration:      dal.iteration.Load(),
+		Stage:          int(dal.stage.Load()) + 1,
+		DownSince:      dal.started,
+		DownSeconds:    int64(time.Since(dal.started).Seconds()),
+		BackoffSeconds: int64(time.Duration(dal.sleepTime.Load()).Seconds()),
+		Failure:        info.Failure.String(),
+		Diagnosis:      string(info.Diagnosis),
+		FailedProbes:   info.FailedProbes,
+	}
+
+	if !info.LastSuccess.IsZero() {
+		actx.LastSuccess = &info.LastSuccess
+	}
+
+	return actx
 }
 
 // startCommand parses, validates, and starts the given command string.
 func (dal *DownActionLoop) startCommand(
 	ctx context.Context,
 	execString string,
-) (*exec.Cmd, *bytes.Buffer, error) {
+	event string,
+) (*commandRun, error) {
 	if execString == "" {
-		return nil, nil, ErrNoCommand
+		return nil, ErrNoCommand
 	}
 
 	command, errSh := shlex.Split(execString)
 	if errSh != nil {
-		return nil, nil, fmt.Errorf("failed to parse DownAction definition: %w", errSh)
+		return nil, fmt.Errorf("failed to parse DownAction definition: %w", errSh)
 	}
 
 	err := validateCommand(command)
 	if err != nil {
-		return nil, nil, fmt.Errorf("invalid command: %w", err)
+		return nil, fmt.Errorf("invalid command: %w", err)
 	}
 
-	iteration := dal.iteration.Load()
+	actx := dal.ActionContext(event)
 
 	// #nosec G204 // Command is validated by shlex.Split() and validateCommand() before execution
 	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	run := &commandRun{
+		Cmd:       cmd,
+		command:   cmd.String(),
+		event:     event,
+		stage:     actx.Stage,
+		iteration: actx.Iteration,
+		done:      make(chan struct{}),
+	}
 
-	var stderrBuf bytes.Buffer
+	// Cancellation terminates the whole process group, which is killed if
+	// still running after the grace period.
+	grace := dal.da.killGrace()
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		run.killed.Store(true)
 
-	cmd.Stderr = &stderrBuf
+		return terminateGroup(cmd.Process)
+	}
+	cmd.WaitDelay = grace
+
+	cmd.Stdout = &run.stdout
+	cmd.Stderr = &run.stderr
+
+	if err := dal.da.Command.apply(cmd, actx.Env()); err != nil {
+		run.start = time.Now()
+		dal.recordCommand(run.record(err))
+
+		return nil, fmt.Errorf("failed to set up DownAction: %w", err)
+	}
+
+	if dal.da.StdinJSON {
+		doc, err := json.Marshal(actx)
+		if err != nil {
+			return nil, fmt.Errorf("encoding action context: %w", err)
+		}
+
+		cmd.Stdin = bytes.NewReader(doc)
+	}
 
-	cmd.Env = append(os.Environ(), fmt.Sprintf("UPD_ITERATION=%d", iteration))
 	logger.DownAction().Info("executing command",
 		"exec", cmd.String(),
-		"iteration", iteration,
+		"event", event,
+		"stage", actx.Stage,
+		"iteration", actx.Iteration,
 	)
 
-	if err = cmd.Start(); err != nil {
+	run.start = time.Now()
+
+	if err = startWithUmask(cmd, dal.da.Command.Umask); err != nil {
 		logger.DownAction().Error("failed to run",
 			"exec", cmd.String(), "error", err)
 
-		return nil, nil, fmt.Errorf("failed to execute DownAction: %w", err)
+		dal.recordCommand(run.record(err))
+
+		return nil, fmt.Errorf("failed to execute DownAction: %w", err)
 	}
 
-	return cmd, &stderrBuf, nil
+	return run, nil
 }
 
 // runStopExec runs the stop command to completion on a context detached from
 // the loop so cancellation cannot kill it, bounded by StopExecTimeout.
 func (dal *DownActionLoop) runStopExec() {
+	if dal.da.DryRun {
+		dal.dryRun(EventStop, dal.da.StopExec)
+
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), StopExecTimeout)
 	defer cancel()
 
-	cmd, stderrBuf, err := dal.startCommand(ctx, dal.da.StopExec)
+	run, err := dal.startCommand(ctx, dal.da.StopExec, EventStop)
 	if err != nil {
 		logger.DownAction().Warn("failed to execute stop command", "error", err)
 
 		return
 	}
 
-	dal.waitForCmd(cmd, stderrBuf)
+	dal.waitForCmd(ctx, run)
+}
+
+// runAction runs the action of a stage: a command is started in the
+// background, while webhooks and power cycles complete before returning.
+func (dal *DownActionLoop) runAction(ctx context.Context, stage *DownActionStage) error {
+	if dal.da.DryRun {
+		dal.dryRun(EventDown, stage.describe())
+
+		return nil
+	}
+
+	var err error
+
+	switch {
+	case stage.PowerCycle != nil:
+		err = stage.PowerCycle.Run(ctx)
+	case stage.Webhook != nil:
+		err = stage.Webhook.Send(ctx, dal.webhookData(EventDown))
+	default:
+		// Commands notify once they complete.
+		return dal.Execute(ctx, stage.Exec)
+	}
+
+	dal.notifyAction(EventDown, stage.describe(), err)
+
+	return err
+}
+
+// runStopWebhook sends the stop webhook on a context detached from the loop,
+// bounded by StopExecTimeout.
+func (dal *DownActionLoop) runStopWebhook() {
+	if dal.da.DryRun {
+		dal.dryRun(EventStop, dal.da.StopWebhook.describe())
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), StopExecTimeout)
+	defer cancel()
+
+	err := dal.da.StopWebhook.Send(ctx, dal.webhookData(EventStop))
+	if err != nil {
+		logger.DownAction().Warn("failed to send stop webhook", "error", err)
+	}
+
+	dal.notifyAction(EventStop, dal.da.StopWebhook.describe(), err)
 }
 
-func (dal *DownActionLoop) waitForCmd(cmd *exec.Cmd, stderrBuf *bytes.Buffer) {
-	waitErr := cmd.Wait()
+func (dal *DownActionLoop) webhookData(event string) WebhookData {
+	return WebhookData{
+		Event:       event,
+		Iteration:   dal.iteration.Load(),
+		Stage:       int(dal.stage.Load()) + 1,
+		OutageStart: dal.started,
+		DownFor:     time.Since(dal.started),
+	}
+}
+
+// waitForCmd reaps the command and records it in the history. A command
+// whose ctx ended was terminated by exec.CommandContext: the rest of its
+// process group gets the grace period to exit, then is killed. The group of
+// a down command that exited on its own is reaped when the loop ends.
+func (dal *DownActionLoop) waitForCmd(ctx context.Context, run *commandRun) {
+	waitErr := run.Wait()
+	close(run.done)
 
 	dal.cmdMu.Lock()
-	if dal.currentCmd == cmd {
+	if dal.currentCmd == run {
 		dal.currentCmd = nil
 	}
 	dal.cmdMu.Unlock()
 
+	if ctx.Err() != nil {
+		run.killed.Store(true)
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.DownAction().Warn("command timed out", "exec", run.String())
+	}
+
+	switch {
+	case run.killed.Load():
+		// Leave nothing of a terminated command running.
+		awaitGroups(dal.da.killGrace(), run)
+	case run.event == EventDown && groupRunning(run.Process):
+		dal.cmdMu.Lock()
+		dal.leftovers = slices.DeleteFunc(dal.leftovers, func(r *commandRun) bool {
+			return !groupRunning(r.Process)
+		})
+		dal.leftovers = append(dal.leftovers, run)
+		dal.cmdMu.Unlock()
+	}
+
+	rec := run.record(waitErr)
+	dal.recordCommand(rec)
+
 	if waitErr != nil {
 		logger.DownAction().Warn("error executing command",
-			"exec", cmd.String(),
+			"exec", rec.Command,
 			"error", waitErr,
-			"stderr", string(bytes.TrimSpace(stderrBuf.Bytes())),
+			"killed", rec.Killed,
+			"stderr", rec.Stderr,
 		)
 	}
+
+	if rec.Stdout != "" {
+		logger.DownAction().Debug("command output", "exec", rec.Command, "stdout", rec.Stdout)
+	}
+
+	if run.event == EventDown && !run.killed.Load() && run.ProcessState != nil {
+		dal.handleExitCode(rec.ExitCode)
+	}
 }
 
-// killCurrentCmd kills any currently running command and clears the reference.
-func (dal *DownActionLoop) killCurrentCmd() {
+// handleExitCode acts on the exit code of a down command: it can request an
+// immediate check, give up, or count toward the failure budget.
+func (dal *DownActionLoop) handleExitCode(code int) {
+	switch {
+	case code == 0:
+	case code == dal.da.RecheckExitCode:
+		logger.DownAction().Info("command requested an immediate check", "exitCode", code)
+
+		if dal.da.recheck != nil {
+			dal.da.recheck()
+		}
+	case code == dal.da.GiveUpExitCode:
+		dal.giveUp(fmt.Sprintf("command exited with give-up code %d", code))
+	default:
+		failures := int(dal.failures.Add(1))
+		if dal.da.FailureBudget > 0 && failures >= dal.da.FailureBudget {
+			dal.giveUp(fmt.Sprintf("failure budget of %d exhausted", dal.da.FailureBudget))
+		}
+	}
+}
+
+// giveUp stops the loop: no further command runs until the connection comes
+// back. The stop action still runs then.
+func (dal *DownActionLoop) giveUp(reason string) {
 	dal.cmdMu.Lock()
-	defer dal.cmdMu.Unlock()
+	first := dal.gaveUp == ""
+	if first {
+		dal.gaveUp = reason
+	}
+	dal.cmdMu.Unlock()
 
-	if dal.currentCmd == nil {
+	if !first {
 		return
 	}
 
-	// currentCmd is only set after a successful Start, so Process is non-nil.
-	logger.DownAction().Warn("killing current command",
-		"pid", dal.currentCmd.Process.Pid)
+	logger.DownAction().Warn("giving up on down action until the connection is back",
+		"reason", reason)
+	dal.cancelFunc()
+}
 
-	if err := dal.currentCmd.Process.Kill(); err != nil {
-		logger.DownAction().Warn("failed to kill current command", "error", err)
+// killCurrentCmd terminates any currently running command, waiting up to the
+// kill grace period for it to exit, and clears the reference.
+func (dal *DownActionLoop) killCurrentCmd() {
+	dal.cmdMu.Lock()
+	run := dal.currentCmd
+	dal.currentCmd = nil
+	dal.cmdMu.Unlock()
+
+	if run == nil {
+		return
 	}
 
-	dal.currentCmd = nil
+	// currentCmd is only set after a successful Start, so Process is non-nil.
+	logger.DownAction().Warn("terminating current command", "pid", run.Process.Pid)
+
+	run.terminate(dal.da.killGrace())
 }
 
+// nextSleep schedules the next repetition of the current stage, which must
+// have a backoff.
 func (dal *DownActionLoop) nextSleep() time.Duration {
-	dal.iteration.Add(1)
+	stage := dal.current()
 
-	switch dal.iteration.Load() {
-	case 1:
-		dal.sleepTime.Store(int64(dal.da.Every))
-	default:
-		if !dal.limitReached.Load() {
-			next := time.Duration(BackoffFactor * float64(dal.sleepTime.Load()))
-			if dal.da.BackoffLimit != 0 && next >= dal.da.BackoffLimit {
-				next = dal.da.BackoffLimit
-				dal.limitReached.Store(true)
-			}
-
-			dal.sleepTime.Store(int64(next))
-		}
-	}
+	delay, capped := stage.backoff().Delay(dal.iteration.Add(1))
+	dal.limitReached.Store(capped)
+	dal.sleepTime.Store(int64(jittered(delay, stage.Jitter)))
 
 	sleepTime := time.Duration(dal.sleepTime.Load())
 	logger.DownAction().Debug("iteration details",
@@ -261,20 +763,85 @@ func (dal *DownActionLoop) nextSleep() time.Duration {
 	return sleepTime
 }
 
+// enterStage makes idx the current stage, scheduling its first run at its
+// After delay from the start of the outage.
+func (dal *DownActionLoop) enterStage(idx int) {
+	stage := &dal.stages[idx]
+
+	dal.stage.Store(int32(idx)) //nolint:gosec // stage count is tiny
+	dal.iteration.Store(0)
+	dal.limitReached.Store(false)
+	dal.sleepTime.Store(int64(max(time.Until(dal.started.Add(stage.After)), 0)))
+
+	if len(dal.stages) > 1 {
+		logger.DownAction().Info("entering stage",
+			"stage", idx+1, "name", stage.Name, "after", stage.After)
+	}
+}
+
 func (dal *DownActionLoop) run(ctx context.Context) {
 	defer dal.runWG.Done()
+	defer dal.nextRunAt.Store(0)
 
 	logger.DownAction().Debug("down action loop started")
 
+	if dal.done {
+		logger.DownAction().Debug("restored down action loop was complete")
+
+		return
+	}
+
+	first := int(dal.stage.Load())
+
+	for idx := first; idx < len(dal.stages); idx++ {
+		if idx > first {
+			dal.enterStage(idx)
+		}
+
+		if !dal.runStage(ctx, idx) {
+			return
+		}
+	}
+
+	dal.saveState(&OutageState{Done: true})
+
+	logger.DownAction().Debug("down action loop complete")
+}
+
+// runStage runs the command of stage idx until the next stage is due. It
+// returns false when the loop was canceled.
+func (dal *DownActionLoop) runStage(ctx context.Context, idx int) bool {
+	stage := &dal.stages[idx]
+
+	var nextAt time.Time
+	if idx+1 < len(dal.stages) {
+		nextAt = dal.started.Add(dal.stages[idx+1].After)
+	}
+
 	for {
-		logger.DownAction().Debug("sleeping", "duration", time.Duration(dal.sleepTime.Load()))
+		sleepTime := time.Duration(dal.sleepTime.Load())
+		if !dal.resumeAt.IsZero() {
+			sleepTime = max(time.Until(dal.resumeAt), 0)
+			dal.resumeAt = time.Time{}
+		}
+
+		if !nextAt.IsZero() && time.Until(nextAt) <= sleepTime {
+			// The next stage is due before this one would repeat.
+			return true
+		}
+
+		runAt := time.Now().Add(sleepTime)
+		dal.nextRunAt.Store(runAt.UnixNano())
+		dal.saveState(&OutageState{NextRunAt: runAt})
+
+		logger.DownAction().Debug("sleeping", "duration", sleepTime)
 
 		select {
 		case <-ctx.Done():
 			logger.DownAction().Debug("canceled")
 
-			return
-		case <-time.After(time.Duration(dal.sleepTime.Load())):
+			return false
+		case <-time.After(sleepTime):
 		}
 
 		// select can pick the timer case even though ctx is already done;
@@ -282,14 +849,60 @@ func (dal *DownActionLoop) run(ctx context.Context) {
 		if ctx.Err() != nil {
 			logger.DownAction().Debug("canceled")
 
-			return
+			return false
+		}
+
+		if mw := dal.da.maintenance.active(time.Now()); mw != nil {
+			dal.suppressed.Add(1)
+			logger.DownAction().Info("maintenance window: skipping down action",
+				"stage", idx+1,
+				"iteration", dal.iteration.Load(),
+				"window", mw.Name,
+				"until", mw.Until,
+			)
+
+			if stage.backoff() == nil {
+				// A one-shot action is deferred to the end of the window
+				// rather than dropped.
+				dal.sleepTime.Store(int64(max(time.Until(mw.Until), 0)))
+
+				continue
+			}
+
+			dal.nextSleep()
+
+			continue
+		}
+
+		if limit := dal.executions.check(dal.da, time.Now()); limit.reason != "" {
+			dal.skipped.Add(1)
+			logger.DownAction().Warn("rate limit reached: skipping down action",
+				"stage", idx+1,
+				"iteration", dal.iteration.Load(),
+				"limit", limit.reason,
+				"nextAllowedAt", limit.next,
+			)
+
+			if stage.backoff() == nil {
+				return true
+			}
+
+			dal.nextSleep()
+
+			continue
 		}
 
 		dal.killCurrentCmd()
 
-		err := dal.Execute(ctx, dal.da.Exec)
+		if !dal.da.DryRun {
+			dal.executions.record(time.Now())
+		}
+
+		err := dal.runAction(ctx, stage)
 		if err != nil {
 			logger.DownAction().Error("failed to execute",
+				"stage",
+				idx+1,
 				"iteration",
 				dal.iteration.Load(),
 				"error",
@@ -299,12 +912,119 @@ func (dal *DownActionLoop) run(ctx context.Context) {
 			logger.DownAction().Debug("command succeeded")
 		}
 
-		if dal.da.Every > 0 {
-			dal.nextSleep()
-		} else {
-			logger.DownAction().Debug("down action loop complete")
+		dal.executed.Store(int32(idx + 1)) //nolint:gosec // stage count is tiny
 
-			break
+		if stage.backoff() == nil {
+			return true
 		}
+
+		dal.nextSleep()
+	}
+}
+
+// saveState persists the schedule, completing outage with the loop state, or
+// records that no outage is in progress when outage is nil.
+func (dal *DownActionLoop) saveState(outage *OutageState) {
+	if dal.da.State == nil || dal.da.DryRun {
+		return
+	}
+
+	if outage != nil {
+		outage.Start = dal.started
+		outage.Stage = int(dal.stage.Load()) + 1
+		outage.Iteration = dal.iteration.Load()
+		outage.SleepTime = time.Duration(dal.sleepTime.Load())
+		outage.BackoffCapped = dal.limitReached.Load()
+		outage.Executed = int(dal.executed.Load())
+	}
+
+	err := dal.da.State.Save(State{
+		Outage:     outage,
+		Executions: dal.executions.snapshot(time.Now()),
+	})
+	if err != nil {
+		logger.DownAction().Warn("could not save down action state", "error", err)
+	}
+}
+
+// clearOutage records that no outage is in progress, for when the connection
+// is up without a down action loop to stop, such as after a crash: the next
+// outage must not resume the schedule of the previous one.
+func (da *DownAction) clearOutage() {
+	if da.State == nil || da.DryRun {
+		return
+	}
+
+	st, err := da.State.Load()
+	if err != nil {
+		logger.DownAction().Warn("could not load down action state", "error", err)
+
+		return
+	}
+
+	if st.Outage == nil {
+		return
+	}
+
+	logger.DownAction().Info("connection up: discarding saved down action state",
+		"downSince", st.Outage.Start)
+
+	if err := da.State.Save(State{Executions: st.Executions}); err != nil {
+		logger.DownAction().Warn("could not save down action state", "error", err)
+	}
+}
+
+// restore resumes the schedule of the outage in the state file, if any.
+func (dal *DownActionLoop) restore() {
+	if dal.da.State == nil || dal.da.DryRun {
+		return
+	}
+
+	st, err := dal.da.State.Load()
+	if err != nil {
+		logger.DownAction().Warn("could not load down action state", "error", err)
+
+		return
 	}
+
+	now := time.Now()
+	dal.executions.restore(st.Executions, now)
+
+	outage := st.Outage
+	if outage == nil {
+		return
+	}
+
+	lastKnown := outage.NextRunAt
+	if outage.Done {
+		lastKnown = st.SavedAt
+	}
+
+	switch {
+	case outage.Stage < 1 || outage.Stage > len(dal.stages):
+		logger.DownAction().Warn("ignoring saved down action state: stages changed",
+			"stage", outage.Stage)
+
+		return
+	case now.Sub(lastKnown) > StateMaxOverdue:
+		logger.DownAction().Info("ignoring stale down action state", "savedAt", st.SavedAt)
+
+		return
+	}
+
+	dal.started = outage.Start
+	dal.stage.Store(int32(outage.Stage - 1))   //nolint:gosec // checked against the stage count
+	dal.executed.Store(int32(outage.Executed)) //nolint:gosec // stage count is tiny
+	dal.iteration.Store(outage.Iteration)
+	dal.sleepTime.Store(int64(outage.SleepTime))
+	dal.limitReached.Store(outage.BackoffCapped)
+	dal.resumeAt = outage.NextRunAt
+	dal.done = outage.Done
+
+	logger.DownAction().Info("resuming down action from saved state",
+		"downSince", outage.Start,
+		"stage", outage.Stage,
+		"iteration", outage.Iteration,
+		"nextRunAt", outage.NextRunAt,
+	)
 }
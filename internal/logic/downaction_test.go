@@ -1,11 +1,17 @@
 package logic
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/hugoh/upd/internal/check"
+	"github.com/hugoh/upd/internal/status"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -85,7 +91,7 @@ func Test_Stop_RunsStopExecToCompletion(t *testing.T) {
 		StopExec: "sh -c 'sleep 0.1 && touch " + marker + "'",
 	}
 
-	dal := da.Start(t.Context())
+	dal := da.Start(t.Context(), nil)
 
 	require.Eventually(t, func() bool {
 		dal.cmdMu.Lock()
@@ -113,7 +119,7 @@ func Test_Stop_NoExecAfterStopExecStarted(t *testing.T) {
 		StopExec: "sh -c 'touch " + stopStartedMarker + " && sleep 0.1'",
 	}
 
-	dal := da.Start(t.Context())
+	dal := da.Start(t.Context(), nil)
 
 	// Let several Exec iterations fire before stopping, to give a would-be
 	// race between run()'s loop and Stop() a chance to manifest.
@@ -230,7 +236,7 @@ func getTestDA() *DownAction {
 
 func Test_Start(t *testing.T) {
 	da := getTestDA()
-	dal := da.Start(t.Context())
+	dal := da.Start(t.Context(), nil)
 	assert.Equal(t, da, dal.da)
 	assert.NotNil(t, dal.cancelFunc)
 	dal.cancelFunc()
@@ -244,7 +250,7 @@ func Test_StartAndStop(t *testing.T) {
 		Exec:     testTrue,
 		StopExec: testTrue,
 	}
-	dal := da.Start(t.Context())
+	dal := da.Start(t.Context(), nil)
 	assert.NotNil(t, dal, "DownAction loop is running")
 
 	assert.Eventually(t, func() bool {
@@ -396,3 +402,222 @@ func TestValidateCommand(t *testing.T) {
 		})
 	}
 }
+
+func Test_Start_PassesEnv(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "env")
+	da := &DownAction{
+		After: time.Millisecond,
+		Exec:  "sh -c 'echo $UPD_FAILURE > " + out + "'",
+	}
+
+	dal := da.Start(t.Context(), func() OutageInfo {
+		return OutageInfo{Failure: check.FailureTimeout}
+	})
+
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(out)
+
+		return err == nil && string(data) == "timeout\n"
+	}, time.Second, 5*time.Millisecond, "command should see the extra environment")
+
+	dal.Stop(t.Context())
+}
+
+func Test_Stages_Escalate(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "stages")
+	da := &DownAction{
+		Stages: []DownActionStage{
+			{Name: "restart", After: time.Millisecond, Every: 10 * time.Millisecond,
+				Exec: "sh -c 'echo 1 >> " + out + "'"},
+			{Name: "reboot", After: 100 * time.Millisecond,
+				Exec: "sh -c 'echo $UPD_STAGE >> " + out + "'"},
+		},
+	}
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return slices.ContainsFunc(dal.Status().History, func(r status.CommandRecord) bool {
+			return r.Stage == 2
+		})
+	}, 2*time.Second, 5*time.Millisecond, "second stage should run")
+	assert.Equal(t, "reboot", dal.ExecutedStage())
+
+	st := dal.Status()
+	assert.Equal(t, 2, st.Stage)
+	assert.Equal(t, "reboot", st.StageName)
+
+	dal.Stop(t.Context())
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+
+	lines := strings.Fields(string(data))
+	require.GreaterOrEqual(t, len(lines), 3, "first stage repeats until the second starts")
+	assert.Equal(t, "2", lines[len(lines)-1])
+
+	for _, line := range lines[:len(lines)-1] {
+		assert.Equal(t, "1", line)
+	}
+}
+
+func Test_Stages_NothingExecuted(t *testing.T) {
+	da := &DownAction{
+		Stages: []DownActionStage{{After: time.Hour, Exec: testTrue}},
+	}
+	dal, _ := da.NewDownActionLoop(t.Context())
+
+	assert.Empty(t, dal.ExecutedStage())
+	assert.Equal(t, 1, dal.Status().Stage)
+	assert.Equal(t, time.Hour, time.Duration(dal.Status().SleepTime))
+}
+
+func Test_Stages_UnnamedLabel(t *testing.T) {
+	da := &DownAction{
+		Stages: []DownActionStage{{Exec: testTrue}, {After: time.Hour, Exec: testTrue}},
+	}
+	dal, _ := da.NewDownActionLoop(t.Context())
+	dal.executed.Store(2)
+
+	assert.Equal(t, "stage 2", dal.ExecutedStage())
+}
+
+func Test_Start_PassesContext(t *testing.T) {
+	dir := t.TempDir()
+	env := filepath.Join(dir, "env")
+	stdin := filepath.Join(dir, "stdin")
+	da := &DownAction{
+		After:     time.Millisecond,
+		Exec:      "sh -c 'env > " + env + "; cat > " + stdin + "'",
+		StdinJSON: true,
+	}
+
+	lastSuccess := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	dal := da.Start(t.Context(), func() OutageInfo {
+		return OutageInfo{
+			Name:        "home",
+			LastSuccess: lastSuccess,
+			Failure:     check.FailureRefused,
+			FailedProbes: []FailedProbe{
+				{Target: "tcp://1.1.1.1:53", Error: "connection refused"},
+				{Target: "tcp://8.8.8.8:53", Error: "connection refused"},
+			},
+		}
+	})
+
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(stdin)
+
+		return err == nil && len(data) > 0
+	}, time.Second, 5*time.Millisecond, "command should receive JSON on stdin")
+
+	dal.Stop(t.Context())
+
+	data, err := os.ReadFile(env)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "UPD_EVENT=down\n")
+	assert.Contains(t, string(data), "UPD_NAME=home\n")
+	assert.Contains(t, string(data), "UPD_LAST_SUCCESS=2026-01-02T03:04:05Z\n")
+	assert.Contains(t, string(data), "UPD_FAILURE=refused\n")
+	assert.Contains(t, string(data), "UPD_FAILED_TARGETS=tcp://1.1.1.1:53,tcp://8.8.8.8:53\n")
+	assert.Contains(t, string(data), "UPD_DOWN_SINCE=")
+
+	data, err = os.ReadFile(stdin)
+	require.NoError(t, err)
+
+	var actx ActionContext
+	require.NoError(t, json.Unmarshal(data, &actx))
+	assert.Equal(t, EventDown, actx.Event)
+	assert.Equal(t, "refused", actx.Failure)
+	assert.Equal(t, 1, actx.Stage)
+	require.NotNil(t, actx.LastSuccess)
+	assert.True(t, lastSuccess.Equal(*actx.LastSuccess))
+	assert.Len(t, actx.FailedProbes, 2)
+}
+
+func Test_Stop_EventIsStop(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "event")
+	da := &DownAction{
+		Exec:     testTrue,
+		StopExec: "sh -c 'echo $UPD_EVENT > " + out + "'",
+	}
+	dal, _ := da.NewDownActionLoop(t.Context())
+
+	dal.Stop(t.Context())
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "stop\n", string(data))
+}
+
+func Test_ExitCode_Recheck(t *testing.T) {
+	var rechecks atomic.Int32
+
+	da := &DownAction{RecheckExitCode: 10, recheck: func() { rechecks.Add(1) }}
+	dal, _ := da.NewDownActionLoop(t.Context())
+
+	require.NoError(t, dal.Execute(t.Context(), "sh -c 'exit 10'"))
+	dal.cmdWG.Wait()
+
+	assert.Equal(t, int32(1), rechecks.Load())
+	assert.Zero(t, dal.Status().Failures, "a recheck is not a failure")
+}
+
+func Test_ExitCode_GiveUp(t *testing.T) {
+	da := &DownAction{
+		After:          time.Millisecond,
+		Every:          time.Hour,
+		Exec:           "sh -c 'exit 11'",
+		GiveUpExitCode: 11,
+	}
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return dal.Status().GaveUp != ""
+	}, time.Second, time.Millisecond, "loop should give up")
+
+	// Without giving up, the loop would be sleeping for an hour.
+	dal.runWG.Wait()
+	dal.cmdWG.Wait()
+	assert.Contains(t, dal.Status().GaveUp, "give-up code 11")
+
+	dal.Stop(t.Context())
+}
+
+func Test_ExitCode_FailureBudget(t *testing.T) {
+	da := &DownAction{
+		After:         time.Millisecond,
+		Every:         5 * time.Millisecond,
+		BackoffLimit:  5 * time.Millisecond,
+		Exec:          testFalse,
+		FailureBudget: 3,
+	}
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return dal.Status().GaveUp != ""
+	}, time.Second, time.Millisecond, "loop should give up")
+
+	dal.runWG.Wait()
+	dal.cmdWG.Wait()
+
+	st := dal.Status()
+	assert.GreaterOrEqual(t, st.Failures, 3)
+	assert.Contains(t, st.GaveUp, "failure budget of 3")
+
+	dal.Stop(t.Context())
+}
+
+func Test_ExitCode_KilledIsNotAFailure(t *testing.T) {
+	dal := newRunningDAL(t)
+	dal.da.FailureBudget = 1
+
+	dal.killCurrentCmd()
+	dal.cmdWG.Wait()
+
+	st := dal.Status()
+	assert.Zero(t, st.Failures)
+	assert.Empty(t, st.GaveUp)
+}
@@ -0,0 +1,50 @@
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+	"github.com/hugoh/upd/internal/status"
+)
+
+// describe returns what the action of the stage does, for dry runs.
+func (s *DownActionStage) describe() string {
+	switch {
+	case s.PowerCycle != nil:
+		return s.PowerCycle.describe()
+	case s.Webhook != nil:
+		return s.Webhook.describe()
+	default:
+		return s.Exec
+	}
+}
+
+func (w *Webhook) describe() string {
+	return w.method() + " " + w.URL
+}
+
+func (p *PowerCycle) describe() string {
+	return fmt.Sprintf("power cycle %s relay %d for %s", p.Host, p.Relay, p.OffFor)
+}
+
+// dryRun logs and records the action the loop would run for event.
+func (dal *DownActionLoop) dryRun(event, action string) {
+	actx := dal.ActionContext(event)
+
+	logger.DownAction().Info("dry run: not running action",
+		"action", action,
+		"event", event,
+		"stage", actx.Stage,
+		"iteration", actx.Iteration,
+	)
+
+	dal.recordCommand(status.CommandRecord{
+		Command:   action,
+		Event:     event,
+		Stage:     actx.Stage,
+		Iteration: actx.Iteration,
+		Start:     time.Now(),
+		DryRun:    true,
+	})
+}
@@ -0,0 +1,190 @@
+package logic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/check"
+	"github.com/hugoh/upd/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DryRun_WalksSchedule(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	stopped := filepath.Join(dir, "stopped")
+
+	loop := NewLoop()
+	da := &DownAction{
+		StopExec: "touch " + stopped,
+		Stages: []DownActionStage{
+			{After: time.Millisecond, Backoff: FixedBackoff{Every: time.Millisecond}, Exec: "touch " + first},
+			{After: 20 * time.Millisecond, Exec: "touch " + second},
+		},
+		MaxPerDay: 1,
+		DryRun:    true,
+	}
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return dal.ExecutedStage() == "stage 2"
+	}, time.Second, time.Millisecond, "dry runs should walk every stage")
+	dal.Stop(t.Context())
+
+	st := dal.Status()
+	assert.True(t, st.DryRun)
+	assert.Empty(t, st.RateLimited, "dry runs are not rate limited")
+
+	require.GreaterOrEqual(t, len(st.History), 3)
+
+	// Newest first.
+	assert.Equal(t, EventStop, st.History[0].Event)
+	assert.Equal(t, "touch "+stopped, st.History[0].Command)
+
+	for _, rec := range st.History {
+		assert.True(t, rec.DryRun)
+	}
+
+	oldest := st.History[len(st.History)-1]
+	assert.Equal(t, "touch "+first, oldest.Command)
+	assert.Equal(t, EventDown, oldest.Event)
+	assert.NoFileExists(t, first)
+	assert.NoFileExists(t, second)
+	assert.NoFileExists(t, stopped)
+}
+
+func Test_DryRun_Describe(t *testing.T) {
+	assert.Equal(t, "GET http://example.com/hook",
+		(&DownActionStage{Webhook: &Webhook{URL: "http://example.com/hook"}}).describe())
+	assert.Equal(t, "power cycle plug relay 1 for 5s",
+		(&DownActionStage{PowerCycle: &PowerCycle{Host: "plug", Relay: 1, OffFor: 5 * time.Second}}).describe())
+	assert.Equal(t, "reboot", (&DownActionStage{Exec: "reboot"}).describe())
+}
+
+func Test_Loop_SetDryRun(t *testing.T) {
+	loop := NewLoop()
+	err := loop.status.SimulateOutage(t.Context(), time.Minute)
+	require.ErrorIs(t, err, status.ErrSimulationDisabled)
+
+	loop.SetDryRun(true)
+
+	da := &DownAction{Exec: testTrue}
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+
+	assert.True(t, da.DryRun, "the loop forces dry runs on its down actions")
+
+	loop.Configure(nil, Delays{}, nil, status.BucketConfig{})
+	err = loop.status.SimulateOutage(t.Context(), time.Minute)
+	require.ErrorIs(t, err, status.ErrSimulationDisabled, "nothing to simulate")
+}
+
+// newSimulationLoop returns a running dry run loop whose connection is up.
+func newSimulationLoop(t *testing.T) *Loop {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	alive := &check.Check{Probe: check.NewHTTPProbe(server.URL), Timeout: time.Second}
+	loop := NewLoop()
+	loop.SetDryRun(true)
+	loop.Configure(&check.List{Ordered: check.Checks{alive}}, Delays{Up: time.Hour, Down: time.Hour},
+		&DownAction{After: time.Millisecond, Exec: "reboot", StopExec: "echo back"},
+		status.BucketConfig{})
+
+	cancel, done := runLoopAsync(t, loop)
+	t.Cleanup(func() {
+		cancel()
+		waitDone(t, done, time.Second)
+		loop.Stop(t.Context())
+	})
+
+	require.Eventually(t, func() bool {
+		return loop.status.GenStatReport(nil).Up
+	}, time.Second, time.Millisecond)
+
+	return loop
+}
+
+func Test_Loop_SimulateOutage(t *testing.T) {
+	loop := newSimulationLoop(t)
+
+	require.NoError(t, loop.status.SimulateOutage(t.Context(), 100*time.Millisecond))
+
+	rpt := loop.status.GenStatReport(nil)
+	assert.True(t, rpt.Up, "simulated outages leave the connection status alone")
+	assert.NotNil(t, rpt.Loop.SimulatedUntil)
+
+	require.Eventually(t, func() bool {
+		return loop.status.GenStatReport(nil).Loop.SimulatedUntil == nil &&
+			loop.currentDownActionLoop() == nil
+	}, time.Second, time.Millisecond, "the simulated outage should end")
+
+	var history []status.CommandRecord
+
+	require.Eventually(t, func() bool {
+		history = loop.history.snapshot()
+
+		return len(history) == 2
+	}, time.Second, time.Millisecond, "the down action should stop")
+	assert.Equal(t, "echo back", history[0].Command)
+	assert.Equal(t, EventStop, history[0].Event)
+	assert.Equal(t, "reboot", history[1].Command)
+}
+
+func Test_Loop_SimulateOutage_End(t *testing.T) {
+	loop := newSimulationLoop(t)
+
+	require.NoError(t, loop.SimulateOutage(t.Context(), time.Hour))
+	require.NoError(t, loop.SimulateOutage(t.Context(), 0))
+
+	assert.Nil(t, loop.status.GenStatReport(nil).Loop.SimulatedUntil)
+	assert.Nil(t, loop.currentDownActionLoop())
+
+	assert.Eventually(t, func() bool {
+		history := loop.history.snapshot()
+
+		return len(history) > 0 && history[0].Event == EventStop
+	}, time.Second, time.Millisecond, "the down action should stop")
+}
+
+func Test_Loop_SimulateOutage_NotDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	alive := &check.Check{Probe: check.NewHTTPProbe(server.URL), Timeout: time.Second}
+	loop := NewLoop()
+	loop.Configure(&check.List{Ordered: check.Checks{alive}}, Delays{Up: time.Hour, Down: time.Hour},
+		&DownAction{Exec: "reboot"}, status.BucketConfig{})
+
+	cancel, done := runLoopAsync(t, loop)
+
+	require.Eventually(t, func() bool {
+		return loop.status.GenStatReport(nil).Up
+	}, time.Second, time.Millisecond)
+
+	err := loop.SimulateOutage(t.Context(), time.Minute)
+	require.ErrorIs(t, err, ErrNotDryRun)
+	assert.Nil(t, loop.currentDownActionLoop())
+
+	cancel()
+	waitDone(t, done, time.Second)
+}
+
+func Test_Loop_SimulateOutage_NoDownAction(t *testing.T) {
+	loop := newTestLoop(t, &check.List{}, Delays{Up: time.Hour, Down: time.Hour})
+	cancel, done := runLoopAsync(t, loop)
+
+	err := loop.SimulateOutage(t.Context(), time.Minute)
+	require.ErrorIs(t, err, ErrNoDownAction)
+
+	cancel()
+	waitDone(t, done, time.Second)
+}
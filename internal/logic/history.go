@@ -0,0 +1,140 @@
+package logic
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hugoh/upd/internal/status"
+)
+
+const (
+	// MaxCommandHistory is the number of most recent down action commands
+	// kept in the history.
+	MaxCommandHistory = 20
+	// MaxCommandOutput is how many bytes of stdout and of stderr are kept per
+	// command.
+	MaxCommandOutput = 2048
+	// truncatedMark is appended to output that exceeded MaxCommandOutput.
+	truncatedMark = "…"
+)
+
+// commandHistory keeps the most recent down action commands. It outlives
+// individual down action loops so past outages remain visible. Thread-safe.
+type commandHistory struct {
+	mu      sync.Mutex
+	records []status.CommandRecord
+}
+
+func (h *commandHistory) add(rec status.CommandRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.records) >= MaxCommandHistory {
+		h.records = slices.Delete(h.records, 0, len(h.records)-MaxCommandHistory+1)
+	}
+
+	h.records = append(h.records, rec)
+}
+
+// snapshot returns the history, newest first.
+func (h *commandHistory) snapshot() []status.CommandRecord {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.records) == 0 {
+		return nil
+	}
+
+	records := slices.Clone(h.records)
+	slices.Reverse(records)
+
+	return records
+}
+
+// limitedBuffer keeps the first MaxCommandOutput bytes written to it. Writes
+// never fail, so the command is not disturbed by the truncation.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+
+	room := MaxCommandOutput - b.buf.Len()
+	if n > room {
+		b.truncated = true
+		p = p[:max(room, 0)]
+	}
+
+	b.buf.Write(p)
+
+	return n, nil
+}
+
+// String returns the trimmed output, marked when truncated.
+func (b *limitedBuffer) String() string {
+	out := string(bytes.TrimSpace(b.buf.Bytes()))
+	if b.truncated {
+		out += truncatedMark
+	}
+
+	return out
+}
+
+// commandRun is a started down action command and its captured output.
+type commandRun struct {
+	*exec.Cmd
+
+	// command is the command line as configured, without the shell setting
+	// its umask.
+	command   string
+	event     string
+	stage     int
+	iteration uint32
+	start     time.Time
+	stdout    limitedBuffer
+	stderr    limitedBuffer
+	// killed is set when upd terminates the command. It only counts if the
+	// command did not exit on its own first.
+	killed atomic.Bool
+	// done is closed once the command has been waited for.
+	done chan struct{}
+}
+
+// String returns the command line as configured.
+func (r *commandRun) String() string {
+	return r.command
+}
+
+// record returns the history entry of the finished command.
+func (r *commandRun) record(waitErr error) status.CommandRecord {
+	rec := status.CommandRecord{
+		Command:   r.String(),
+		Event:     r.event,
+		Stage:     r.stage,
+		Iteration: r.iteration,
+		Start:     r.start,
+		Duration:  status.ReadableLatency(time.Since(r.start)),
+		ExitCode:  r.ProcessState.ExitCode(),
+		Killed:    r.killed.Load() && r.ProcessState.ExitCode() == -1,
+		Stdout:    r.stdout.String(),
+		Stderr:    r.stderr.String(),
+	}
+
+	var exitErr *exec.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exitErr) {
+		rec.Error = waitErr.Error()
+	}
+
+	return rec
+}
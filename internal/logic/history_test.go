@@ -0,0 +1,109 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hugoh/upd/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_commandHistory_BoundedNewestFirst(t *testing.T) {
+	h := &commandHistory{}
+
+	for i := range MaxCommandHistory + 5 {
+		h.add(status.CommandRecord{Command: fmt.Sprint(i)})
+	}
+
+	records := h.snapshot()
+	require.Len(t, records, MaxCommandHistory)
+	assert.Equal(t, fmt.Sprint(MaxCommandHistory+4), records[0].Command)
+	assert.Equal(t, "5", records[MaxCommandHistory-1].Command)
+}
+
+func Test_commandHistory_NilAndEmpty(t *testing.T) {
+	var h *commandHistory
+	assert.Nil(t, h.snapshot())
+	assert.Nil(t, (&commandHistory{}).snapshot())
+}
+
+func Test_limitedBuffer_Truncates(t *testing.T) {
+	var b limitedBuffer
+
+	n, err := b.Write([]byte(strings.Repeat("a", MaxCommandOutput-1)))
+	require.NoError(t, err)
+	assert.Equal(t, MaxCommandOutput-1, n)
+
+	n, err = b.Write([]byte("bcd"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n, "writes must never be reported short")
+
+	out := b.String()
+	assert.True(t, strings.HasSuffix(out, "ab"+truncatedMark))
+	assert.Len(t, strings.TrimSuffix(out, truncatedMark), MaxCommandOutput)
+}
+
+func Test_History_RecordsOutputAndExitCode(t *testing.T) {
+	dal, _ := (&DownAction{}).NewDownActionLoop(t.Context())
+
+	err := dal.Execute(t.Context(), "sh -c 'echo out; echo err >&2; exit 3'")
+	require.NoError(t, err)
+	dal.cmdWG.Wait()
+
+	history := dal.Status().History
+	require.Len(t, history, 1)
+
+	rec := history[0]
+	assert.Equal(t, EventDown, rec.Event)
+	assert.Equal(t, 1, rec.Stage)
+	assert.Equal(t, 3, rec.ExitCode)
+	assert.Equal(t, "out", rec.Stdout)
+	assert.Equal(t, "err", rec.Stderr)
+	assert.False(t, rec.Killed)
+	assert.Empty(t, rec.Error)
+	assert.False(t, rec.Start.IsZero())
+}
+
+func Test_History_RecordsKilledCommand(t *testing.T) {
+	dal := newRunningDAL(t)
+
+	dal.killCurrentCmd()
+	dal.cmdWG.Wait()
+
+	history := dal.Status().History
+	require.Len(t, history, 1)
+	assert.True(t, history[0].Killed)
+	assert.Equal(t, -1, history[0].ExitCode)
+}
+
+func Test_History_RecordsStartFailure(t *testing.T) {
+	dal, _ := (&DownAction{}).NewDownActionLoop(t.Context())
+
+	err := dal.Execute(t.Context(), "/DOES-NOT-EXIST")
+	require.Error(t, err)
+
+	history := dal.Status().History
+	require.Len(t, history, 1)
+	assert.Equal(t, -1, history[0].ExitCode)
+	assert.NotEmpty(t, history[0].Error)
+}
+
+func Test_History_SharedAcrossOutages(t *testing.T) {
+	loop := NewLoop()
+	da := &DownAction{}
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+
+	for range 2 {
+		dal, _ := da.NewDownActionLoop(t.Context())
+		require.NoError(t, dal.Execute(t.Context(), testTrue))
+		dal.cmdWG.Wait()
+	}
+
+	loop.pushStatus()
+
+	rpt := loop.status.GenStatReport(nil)
+	require.NotNil(t, rpt.DownAction, "history is reported after the outage")
+	assert.Len(t, rpt.DownAction.History, 2)
+}
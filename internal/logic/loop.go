@@ -36,8 +36,12 @@
 //   - After: Initial delay before first execution
 //   - Every: Interval between executions
 //   - BackoffLimit: Maximum delay before exponential backoff stops
+//   - Backoff: Optional strategy replacing the exponential backoff, with
+//     Jitter spreading its delays
 //   - Exec: Command to execute
 //   - StopExec: Command to execute when connection comes back
+//   - Stages: Escalation ladder replacing Exec, each stage with its own
+//     After, Every, BackoffLimit and Exec
 //
 // Example - Configure down action:
 //
@@ -76,16 +80,32 @@
 //	// Later, to shutdown:
 //	cancel()  // Context cancelled
 //	loop.Stop(ctx)  // Wait for cleanup
+//
+// Reloading:
+//
+// Reload applies new settings on the running loop between two checks, so
+// that a configuration reload keeps the statistics server and any in-flight
+// down action:
+//
+//	err := loop.Reload(ctx, func() {
+//		loop.SetChecks(newChecks, newDelays)
+//	})
 package logic
 
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hugoh/upd/internal/check"
+	"github.com/hugoh/upd/internal/diagnosis"
 	"github.com/hugoh/upd/internal/logger"
+	"github.com/hugoh/upd/internal/mqtt"
+	"github.com/hugoh/upd/internal/notify"
+	"github.com/hugoh/upd/internal/schedule"
 	"github.com/hugoh/upd/internal/status"
 )
 
@@ -104,6 +124,11 @@ func (d Delays) ForStatus(up bool) time.Duration {
 	return d.Down
 }
 
+// Diagnoser attributes an outage to a network layer.
+type Diagnoser interface {
+	Run(ctx context.Context) diagnosis.Result
+}
+
 // Loop manages periodic network connectivity checks.
 type Loop struct {
 	checkList      *check.List
@@ -114,14 +139,59 @@ type Loop struct {
 	statServer     *status.StatServer
 	status         *status.Status
 	rollingTracker *status.RollingProbeTracker
-	lastSuccess    time.Time
-	nextCheckAt    time.Time
+	failures       *failureTally
+	history        *commandHistory
+	executions     *executionLog
+	maintenance    *maintenanceWindows
+	recheck        chan struct{}
+	reloads        chan func()
+	// name is read by the down action goroutines while reloads set it.
+	name        atomic.Pointer[string]
+	diagnoser   Diagnoser
+	diagnosisMu sync.Mutex
+	diagnosis   diagnosis.Layer
+	outageSeq   uint64
+	diagnoses   sync.WaitGroup
+	lastSuccess time.Time
+	nextCheckAt time.Time
+	dryRun      bool
+	// simulation ends the simulated outage, if any. Only used by the Run
+	// goroutine.
+	simulation     *time.Timer
+	simulatedUntil time.Time
+	// notifier is replaced on reload while down actions notify from their
+	// own goroutines.
+	notifier atomic.Pointer[notify.Notifier]
+	// outageMu guards the start of the current outage and the down actions
+	// run since, recorded from the down action goroutines. outageMuted tells
+	// whether its EventDown was dropped within a maintenance window.
+	outageMu      sync.Mutex
+	outageStart   time.Time
+	outageActions []notify.Action
+	outageMuted   bool
+	// mqtt publishes the state, if configured. Only used by the Run
+	// goroutine.
+	mqtt       *mqtt.Publisher
+	mqttConfig mqtt.Config
+	// reports are the statistics report periods, summarized in
+	// notifications.
+	reports []time.Duration
+	// digest sends the scheduled digest, if any. Only used by the Run
+	// goroutine.
+	digest      *Digest
+	digestTimer *time.Timer
 }
 
 // NewLoop creates a new monitoring loop.
 func NewLoop() *Loop {
 	return &Loop{
-		status: status.NewStatus(),
+		status:      status.NewStatus(),
+		failures:    &failureTally{},
+		history:     &commandHistory{},
+		executions:  &executionLog{},
+		maintenance: &maintenanceWindows{},
+		recheck:     make(chan struct{}, 1),
+		reloads:     make(chan func()),
 	}
 }
 
@@ -133,20 +203,82 @@ func (l *Loop) Configure(
 	buckets status.BucketConfig,
 	periods ...time.Duration,
 ) {
+	l.SetChecks(checkList, delays)
+	l.setDownAction(downAction)
+	l.SetReports(buckets, periods...)
+}
+
+// SetChecks replaces the checks and the delays between them.
+func (l *Loop) SetChecks(checkList *check.List, delays Delays) {
 	l.checkList = checkList
 	l.delays = delays
+}
+
+// SetDownAction replaces the down action. An in-flight down action loop is
+// suspended without running its stop action, since the connection is still
+// down: the next check resumes it with the new settings.
+func (l *Loop) SetDownAction(ctx context.Context, downAction *DownAction) {
+	l.downActionMu.Lock()
+	dal := l.downActionLoop
+	l.downActionLoop = nil
+	l.downActionMu.Unlock()
+
+	if dal != nil {
+		logger.Loop().Info("down action changed: restarting it")
+		dal.Suspend(ctx)
+	}
+
+	l.clearSimulation()
+	l.setDownAction(downAction)
+}
+
+func (l *Loop) setDownAction(downAction *DownAction) {
 	l.downAction = downAction
 
-	var retention time.Duration
-	for _, p := range periods {
-		if p > retention {
-			retention = p
+	// The statistics server only triggers simulated outages of dry runs.
+	var simulator status.OutageSimulator
+	if downAction != nil && (downAction.DryRun || l.dryRun) {
+		simulator = l.SimulateOutage
+	}
+
+	l.status.SetOutageSimulator(simulator)
+
+	if downAction != nil {
+		downAction.DryRun = downAction.DryRun || l.dryRun
+		downAction.history = l.history
+		downAction.executions = l.executions
+		downAction.recheck = l.requestRecheck
+		downAction.maintenance = l.maintenance
+		downAction.notify = l.Notify
+	}
+}
+
+// SetMaintenance sets the maintenance windows, during which down actions are
+// suppressed while checks and statistics go on. Downtime within windows
+// marked ExcludeFromAvailability does not count against availability.
+func (l *Loop) SetMaintenance(windows schedule.Schedule) {
+	l.maintenance.set(windows)
+
+	var exclude status.ExcludeFunc
+
+	for _, w := range windows {
+		if w.ExcludeFromAvailability {
+			exclude = windows.Excluded
+
+			break
 		}
 	}
 
-	l.status.SetRetention(retention)
+	l.status.SetExclusion(exclude)
+}
+
+// SetReports sets the statistics report periods; retention is derived from
+// the longest one. Per-probe statistics start over.
+func (l *Loop) SetReports(buckets status.BucketConfig, periods ...time.Duration) {
+	l.reports = periods
+	l.status.SetRetention(l.retention())
 
-	if retention > 0 {
+	if len(periods) > 0 {
 		l.rollingTracker = status.NewRollingProbeTracker(periods, buckets)
 		l.status.SetRollingTracker(l.rollingTracker)
 	} else {
@@ -155,6 +287,48 @@ func (l *Loop) Configure(
 	}
 }
 
+// retention is how long state changes are kept: the longest of the report
+// periods and the digest period.
+func (l *Loop) retention() time.Duration {
+	var retention time.Duration
+	if l.digest != nil {
+		retention = l.digest.Period
+	}
+
+	for _, p := range l.reports {
+		retention = max(retention, p)
+	}
+
+	return retention
+}
+
+// SetDryRun makes down actions, including those set later, log and record
+// their actions instead of running them.
+func (l *Loop) SetDryRun(dryRun bool) {
+	l.dryRun = dryRun
+}
+
+// SetName sets the group or host name passed to down action commands.
+func (l *Loop) SetName(name string) {
+	l.name.Store(&name)
+}
+
+// loopName returns the group or host name, empty when not set.
+func (l *Loop) loopName() string {
+	if name := l.name.Load(); name != nil {
+		return *name
+	}
+
+	return ""
+}
+
+// SetDiagnoser sets the diagnoser run when the connection goes down. A nil
+// diagnoser disables outage diagnosis. Must be called from Reload, or before
+// Run: diagnoses in progress keep the diagnoser they started with.
+func (l *Loop) SetDiagnoser(d Diagnoser) {
+	l.diagnoser = d
+}
+
 // ErrDownActionRunning is returned when trying to start a down action while one is active.
 var ErrDownActionRunning = errors.New("cannot start new DownAction when one is already running")
 
@@ -167,11 +341,27 @@ func (l *Loop) DownActionStart(ctx context.Context) error {
 		return ErrDownActionRunning
 	}
 
-	l.downActionLoop = l.downAction.Start(ctx)
+	l.downActionLoop = l.downAction.Start(ctx, l.outageInfo)
 
 	return nil
 }
 
+// outageInfo describes the outage to down action commands. The diagnosis is
+// only set once it has completed.
+func (l *Loop) outageInfo() OutageInfo {
+	l.diagnosisMu.Lock()
+	layer := l.diagnosis
+	l.diagnosisMu.Unlock()
+
+	return OutageInfo{
+		Name:         l.loopName(),
+		LastSuccess:  l.status.LastSuccessAt(),
+		Failure:      l.failures.dominant(),
+		Diagnosis:    layer,
+		FailedProbes: l.failures.failedProbes(),
+	}
+}
+
 // DownActionStop halts the current down action loop, blocking until its
 // StopExec command (if any) has run to completion.
 func (l *Loop) DownActionStop(ctx context.Context) {
@@ -192,9 +382,37 @@ func (l *Loop) DownActionStop(ctx context.Context) {
 func (l *Loop) ProcessCheck(ctx context.Context, upStatus bool) {
 	changed := l.status.Update(upStatus)
 
+	// The failed probes of the outage are notified, and its context given to
+	// the stop action, once the connection is back up, after the tally and
+	// the diagnosis are reset.
+	var (
+		failed []FailedProbe
+		info   OutageInfo
+	)
+
+	if changed {
+		failed = l.failures.failedProbes()
+		info = l.outageInfo()
+	}
+
+	if upStatus {
+		l.failures.reset()
+	}
+
 	if changed {
 		logger.Loop().Info("connection status changed", "up", l.status.Up)
-		l.handleStateChange(ctx, upStatus)
+		// A real outage takes over from a simulated one.
+		l.endSimulation(ctx)
+		l.notifyStateChange(upStatus, failed)
+		l.trackOutage(ctx, upStatus)
+		l.handleStateChange(ctx, upStatus, info)
+	} else if !upStatus && l.downAction != nil && l.currentDownActionLoop() == nil {
+		// Still down after a reload: pick the down action back up.
+		logger.Loop().Info("resuming down action")
+
+		if err := l.DownActionStart(ctx); err != nil {
+			logger.Loop().Error("could not start DownAction", "error", err)
+		}
 	}
 
 	l.nextCheckAt = time.Now().Add(l.delays.ForStatus(l.status.Up))
@@ -203,14 +421,23 @@ func (l *Loop) ProcessCheck(ctx context.Context, upStatus bool) {
 
 // Run starts the monitoring loop with optional statistics server config.
 func (l *Loop) Run(ctx context.Context, statServerConfig *status.StatServerConfig) {
-	checker := LoopChecker{tracker: l.rollingTracker}
-
 	if l.statServer == nil {
 		l.statServer = status.StartStatServer(l.status, statServerConfig)
 	}
 
 	for {
-		checkStatus := check.CheckerRun(ctx, checker, l.checkList.All())
+		checker := LoopChecker{
+			tracker:   l.rollingTracker,
+			checkList: l.checkList,
+			failures:  l.failures,
+		}
+
+		var checkStatus bool
+		if l.checkList.Exhaustive {
+			checkStatus = l.checkList.RunExhaustive(ctx, checker)
+		} else {
+			checkStatus = check.CheckerRun(ctx, checker, l.checkList.All())
+		}
 		if checkStatus {
 			l.lastSuccess = time.Now()
 		}
@@ -226,13 +453,85 @@ func (l *Loop) Run(ctx context.Context, statServerConfig *status.StatServerConfi
 
 			return
 		case <-time.After(sleepTime):
+		case <-l.recheck:
+			logger.Loop().Info("checking now as requested")
+		case apply := <-l.reloads:
+			apply()
+		case <-l.simulationEnd():
+			l.endSimulation(ctx)
+			l.pushStatus()
+		case <-l.digestDue():
+			l.sendDigest()
 		}
 	}
 }
 
-// Stop gracefully shuts down the loop and its components.
+// Reload runs apply on the Run goroutine between two checks, so that it can
+// change the loop settings without racing with it, then checks right away.
+// It blocks until apply has run, and fails if ctx ends first.
+func (l *Loop) Reload(ctx context.Context, apply func()) error {
+	done := make(chan struct{})
+
+	select {
+	case l.reloads <- func() { apply(); close(done) }:
+	case <-ctx.Done():
+		return fmt.Errorf("reload not applied: %w", ctx.Err())
+	}
+
+	<-done
+
+	return nil
+}
+
+// SetStatServerConfig applies a new statistics server configuration. The
+// server is only restarted when its port or timeouts change. Must be called
+// from Reload.
+func (l *Loop) SetStatServerConfig(ctx context.Context, config *status.StatServerConfig) {
+	if l.statServer != nil && l.statServer.SameListener(config) {
+		l.statServer.SetReports(config.Reports)
+
+		return
+	}
+
+	if l.statServer != nil {
+		l.statServer.Shutdown(ctx)
+	}
+
+	l.statServer = status.StartStatServer(l.status, config)
+}
+
+// requestRecheck makes Run check immediately instead of waiting for the next
+// iteration. Requests made while one is pending are merged.
+func (l *Loop) requestRecheck() {
+	select {
+	case l.recheck <- struct{}{}:
+	default:
+	}
+}
+
+// Stop gracefully shuts down the loop and its components. A down action
+// with a state file is suspended rather than stopped, so that it resumes
+// when upd restarts.
 func (l *Loop) Stop(ctx context.Context) {
+	l.downActionMu.Lock()
+	suspended := l.downActionLoop
+	if suspended != nil && suspended.da.State != nil && !suspended.da.DryRun {
+		l.downActionLoop = nil
+	} else {
+		suspended = nil
+	}
+	l.downActionMu.Unlock()
+
+	if suspended != nil {
+		suspended.Suspend(ctx)
+	}
+
+	l.clearSimulation()
+	l.SetDigest(nil)
 	l.DownActionStop(ctx)
+	l.diagnoses.Wait()
+	l.notifier.Swap(nil).Close()
+	l.SetMQTT(nil)
 
 	if l.statServer != nil {
 		l.statServer.Shutdown(ctx)
@@ -247,7 +546,73 @@ func (l *Loop) currentDownActionLoop() *DownActionLoop {
 	return l.downActionLoop
 }
 
-func (l *Loop) handleStateChange(ctx context.Context, upStatus bool) {
+// trackOutage records outages in the status history and diagnoses them.
+func (l *Loop) trackOutage(ctx context.Context, upStatus bool) {
+	now := time.Now()
+
+	l.diagnosisMu.Lock()
+	l.outageSeq++
+	l.diagnosis = ""
+	seq := l.outageSeq
+	l.diagnosisMu.Unlock()
+
+	if upStatus {
+		var fixedBy string
+		if dal := l.currentDownActionLoop(); dal != nil {
+			fixedBy = dal.ExecutedStage()
+		}
+
+		if fixedBy != "" {
+			logger.Loop().Info("connection recovered after down action", "stage", fixedBy)
+		}
+
+		l.status.EndOutage(now, fixedBy)
+
+		return
+	}
+
+	l.status.StartOutage(now)
+
+	if diagnoser := l.diagnoser; diagnoser != nil {
+		l.diagnoses.Go(func() { l.diagnose(ctx, diagnoser, seq) })
+	}
+}
+
+func (l *Loop) diagnose(ctx context.Context, diagnoser Diagnoser, seq uint64) {
+	result := diagnoser.Run(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	l.diagnosisMu.Lock()
+	defer l.diagnosisMu.Unlock()
+
+	if seq != l.outageSeq {
+		// The connection came back while diagnosing.
+		return
+	}
+
+	l.diagnosis = result.Layer
+
+	steps := make([]status.DiagnosisStep, len(result.Steps))
+	for i, step := range result.Steps {
+		steps[i] = status.DiagnosisStep{
+			Name:   step.Name,
+			Target: step.Target,
+			OK:     step.OK(),
+		}
+
+		if step.Err != nil {
+			steps[i].Error = step.Err.Error()
+		}
+	}
+
+	l.status.SetOutageDiagnosis(status.Diagnosis{Layer: string(result.Layer), Steps: steps})
+}
+
+// handleStateChange starts or stops the down action; info describes the
+// outage that ended to the stop action.
+func (l *Loop) handleStateChange(ctx context.Context, upStatus bool, info OutageInfo) {
 	if l.downAction == nil {
 		return
 	}
@@ -261,7 +626,9 @@ func (l *Loop) handleStateChange(ctx context.Context, upStatus bool) {
 		if dal != nil {
 			// Async: StopExec can take up to StopExecTimeout and must not
 			// block the check loop.
-			go dal.Stop(ctx)
+			go dal.StopRecovered(ctx, info)
+		} else {
+			l.downAction.clearOutage()
 		}
 	} else {
 		err := l.DownActionStart(ctx)
@@ -273,7 +640,13 @@ func (l *Loop) handleStateChange(ctx context.Context, upStatus bool) {
 
 func (l *Loop) pushStatus() {
 	loopSt := status.LoopStatus{
-		Interval: status.ReadableDuration(l.delays.ForStatus(l.status.Up)),
+		Interval:    status.ReadableDuration(l.delays.ForStatus(l.status.Up)),
+		Maintenance: l.maintenance.active(time.Now()),
+	}
+
+	if l.simulation != nil {
+		until := l.simulatedUntil
+		loopSt.SimulatedUntil = &until
 	}
 
 	l.status.SetLoopStatus(loopSt)
@@ -283,17 +656,53 @@ func (l *Loop) pushStatus() {
 		l.status.SetLastSuccessAt(l.lastSuccess)
 	}
 
+	l.status.SetBreakerStatus(l.breakerStatus())
+
 	if dal := l.currentDownActionLoop(); dal != nil {
 		l.status.SetDownActionStatus(dal.Status())
 	} else {
-		l.status.SetDownActionStatus(status.DownActionStatus{})
+		l.status.SetDownActionStatus(status.DownActionStatus{History: l.history.snapshot()})
 	}
+
+	l.publishMQTT()
 }
 
-// LoopChecker implements check.Checker for logging check lifecycle events and
-// probe-level stats collection.
+func (l *Loop) breakerStatus() []status.ProbeBreakerStatus {
+	if l.checkList == nil {
+		return nil
+	}
+
+	snapshot := l.checkList.Breakers.Snapshot()
+	if len(snapshot) == 0 {
+		return nil
+	}
+
+	result := make([]status.ProbeBreakerStatus, len(snapshot))
+
+	for i, br := range snapshot {
+		result[i] = status.ProbeBreakerStatus{
+			Scheme:   br.Scheme,
+			Target:   br.Target,
+			State:    br.State.String(),
+			Failures: br.Failures,
+		}
+
+		if br.State == check.BreakerOpen {
+			retryAt := br.RetryAt
+			result[i].RetryAt = &retryAt
+		}
+	}
+
+	return result
+}
+
+// LoopChecker implements check.Checker for logging check lifecycle events,
+// probe-level stats collection, adaptive check ordering feedback and outage
+// failure classification.
 type LoopChecker struct {
-	tracker *status.RollingProbeTracker
+	tracker   *status.RollingProbeTracker
+	checkList *check.List
+	failures  *failureTally
 }
 
 // CheckRun logs the start of a check.
@@ -311,17 +720,37 @@ func (LoopChecker) CheckRun(chk check.Check) {
 // ProbeSuccess logs successful probe results.
 func (c LoopChecker) ProbeSuccess(report *check.Report) {
 	logger.Check().Debug("success", report.LogAttrs())
+	c.checkList.Observe(report)
 
 	if c.tracker != nil {
-		c.tracker.Record(false)
+		c.tracker.Record(probeResult(report))
 	}
 }
 
 // ProbeFailure logs failed probe results.
 func (c LoopChecker) ProbeFailure(report *check.Report) {
 	logger.Check().Warn("failed", report.LogAttrs())
+	c.checkList.Observe(report)
+
+	if c.failures != nil {
+		c.failures.record(report.Failure())
+		c.failures.recordError(report.Target(), report.Error())
+	}
 
 	if c.tracker != nil {
-		c.tracker.Record(true)
+		c.tracker.Record(probeResult(report))
+	}
+}
+
+func probeResult(report *check.Report) status.ProbeResult {
+	return status.ProbeResult{
+		ProbeTarget: status.ProbeTarget{
+			Scheme: report.Protocol(),
+			Target: report.Target(),
+			Name:   report.Name(),
+		},
+		Failed:  report.Error() != nil,
+		Failure: report.Failure(),
+		Latency: report.Elapsed(),
 	}
 }
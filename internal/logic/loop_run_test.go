@@ -2,12 +2,16 @@ package logic
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/hugoh/upd/internal/check"
 	"github.com/hugoh/upd/internal/status"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // newTestLoop builds and configures a Loop for tests that drive Run/Stop
@@ -157,3 +161,148 @@ func TestRun_StopsTimerOnContextCancel(t *testing.T) {
 		t.Fatal("Run() did not exit within expected time - timer may not be stopped properly")
 	}
 }
+
+func TestRun_ReportsOpenBreakers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	dead := &check.Check{
+		Probe:   check.NewHTTPProbe("http://127.0.0.1:1/"),
+		Timeout: time.Second,
+	}
+	alive := &check.Check{Probe: check.NewHTTPProbe(server.URL), Timeout: time.Second}
+	checkList := &check.List{
+		Ordered:  check.Checks{dead, alive},
+		Breakers: check.NewBreakers(check.BreakerConfig{Threshold: 1}),
+	}
+
+	loop := newTestLoop(
+		t,
+		checkList,
+		Delays{Up: 10 * time.Millisecond, Down: 10 * time.Millisecond},
+	)
+	runLoopAsync(t, loop)
+
+	assert.Eventually(t, func() bool {
+		breakers := loop.status.GenStatReport(nil).Breakers
+
+		return len(breakers) == 1 &&
+			breakers[0].Target == "http://127.0.0.1:1/" &&
+			breakers[0].State == "open" &&
+			breakers[0].RetryAt != nil
+	}, 2*time.Second, 5*time.Millisecond, "dead probe should have an open circuit")
+}
+
+func TestRun_ExhaustiveRecordsEveryProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	alive := &check.Check{Probe: check.NewHTTPProbe(server.URL), Timeout: time.Second}
+	dead := &check.Check{Probe: check.NewHTTPProbe("http://127.0.0.1:1/"), Timeout: time.Second}
+	checkList := &check.List{
+		Ordered:    check.Checks{alive, dead},
+		Exhaustive: true,
+	}
+
+	loop := newTestLoop(
+		t,
+		checkList,
+		Delays{Up: time.Hour, Down: time.Hour},
+		time.Minute,
+	)
+	runLoopAsync(t, loop)
+
+	assert.Eventually(t, func() bool {
+		stats := loop.status.GenStatReport([]time.Duration{time.Minute}).Stats
+
+		return len(stats) == 1 && stats[0].TotalProbes == 2 && stats[0].FailedProbes == 1
+	}, 2*time.Second, 5*time.Millisecond, "both probes should feed the stats")
+	assert.True(t, loop.status.GenStatReport(nil).Up)
+}
+
+func TestRun_RecheckChecksImmediately(t *testing.T) {
+	longDelay := 10 * time.Second
+	loop := newTestLoop(t, &check.List{}, Delays{Up: longDelay, Down: longDelay}, time.Minute)
+	cancel, done := runLoopAsync(t, loop)
+
+	checksRun := func() uint32 {
+		return loop.status.GenStatReport(nil).Loop.TotalChecksRun
+	}
+
+	assert.Eventually(t, func() bool { return checksRun() == 1 },
+		1*time.Second, 5*time.Millisecond, "first check should run")
+
+	loop.requestRecheck()
+
+	assert.Eventually(t, func() bool { return checksRun() == 2 },
+		1*time.Second, 5*time.Millisecond, "recheck should not wait for the delay")
+
+	cancel()
+	waitDone(t, done, 1*time.Second)
+}
+
+func TestReload_AppliesBetweenChecks(t *testing.T) {
+	loop := newTestLoop(t, &check.List{}, Delays{Up: 10 * time.Second, Down: 10 * time.Second}, time.Minute)
+	cancel, done := runLoopAsync(t, loop)
+
+	newDelays := Delays{Up: time.Hour, Down: time.Hour}
+	err := loop.Reload(t.Context(), func() { loop.SetChecks(&check.List{}, newDelays) })
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return loop.status.GenStatReport(nil).Loop.TotalChecksRun >= 2
+	}, 1*time.Second, 5*time.Millisecond, "a check should run right after the reload")
+
+	cancel()
+	waitDone(t, done, 1*time.Second)
+	assert.Equal(t, newDelays, loop.delays)
+}
+
+func TestReload_FailsWhenNotRunning(t *testing.T) {
+	loop := newTestLoop(t, &check.List{}, Delays{})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	applied := false
+	err := loop.Reload(ctx, func() { applied = true })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, applied)
+}
+
+func TestSetStatServerConfig_RestartsOnlyOnListenerChange(t *testing.T) {
+	loop := newTestLoop(t, &check.List{}, Delays{})
+	port := freePort(t)
+
+	loop.SetStatServerConfig(t.Context(), &status.StatServerConfig{Port: port})
+	first := loop.statServer
+	require.NotNil(t, first)
+
+	t.Cleanup(func() { loop.Stop(context.Background()) })
+
+	loop.SetStatServerConfig(t.Context(), &status.StatServerConfig{
+		Port:    port,
+		Reports: []time.Duration{time.Hour},
+	})
+	assert.Same(t, first, loop.statServer, "new reports keep the server")
+
+	loop.SetStatServerConfig(t.Context(), &status.StatServerConfig{
+		Port:        port,
+		ReadTimeout: time.Minute,
+	})
+	assert.NotSame(t, first, loop.statServer, "new timeouts restart the server")
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func() { _ = l.Close() }()
+
+	addr, ok := l.Addr().(*net.TCPAddr)
+	require.True(t, ok)
+
+	return addr.Port
+}
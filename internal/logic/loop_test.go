@@ -1,12 +1,18 @@
 package logic
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/hugoh/upd/internal/check"
+	"github.com/hugoh/upd/internal/diagnosis"
+	"github.com/hugoh/upd/internal/notify"
 	"github.com/hugoh/upd/internal/status"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -211,3 +217,155 @@ func TestChecker_ProbeFailure(t *testing.T) {
 		checker.ProbeFailure(report)
 	})
 }
+
+func Test_ProcessCheck_ResetsFailuresWhenUp(t *testing.T) {
+	loop := emptyNewLoop()
+	loop.failures.record(check.FailureTimeout)
+
+	loop.ProcessCheck(t.Context(), false)
+	assert.Equal(t, check.FailureTimeout, loop.failures.dominant())
+
+	loop.ProcessCheck(t.Context(), true)
+	assert.Equal(t, check.FailureNone, loop.failures.dominant())
+}
+
+func Test_OutageInfo(t *testing.T) {
+	loop := emptyNewLoop()
+	loop.SetName("home")
+	loop.failures.record(check.FailureDNS)
+	loop.failures.recordError("dns://1.1.1.1/example.com", errors.New("no such host"))
+
+	lastSuccess := time.Now().Add(-time.Minute)
+	loop.status.SetLastSuccessAt(lastSuccess)
+
+	info := loop.outageInfo()
+	assert.Equal(t, "home", info.Name)
+	assert.Equal(t, check.FailureDNS, info.Failure)
+	assert.Equal(t, lastSuccess, info.LastSuccess)
+	assert.Equal(t, []FailedProbe{{Target: "dns://1.1.1.1/example.com", Error: "no such host"}},
+		info.FailedProbes)
+}
+
+func Test_ProcessCheck_StopActionGetsOutageContext(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "stop")
+	loop := emptyNewLoop()
+	loop.SetDiagnoser(fakeDiagnoser{layer: diagnosis.LayerLAN})
+	loop.downAction = &DownAction{
+		After:    time.Hour,
+		Exec:     testTrue,
+		StopExec: `sh -c 'echo "$UPD_FAILURE $UPD_DIAGNOSIS $UPD_FAILED_TARGETS" > ` + out + `'`,
+	}
+
+	loop.ProcessCheck(t.Context(), true)
+	loop.failures.record(check.FailureDNS)
+	loop.failures.recordError("dns://1.1.1.1/example.com", errors.New("no such host"))
+	loop.ProcessCheck(t.Context(), false)
+	loop.diagnoses.Wait()
+	loop.ProcessCheck(t.Context(), true)
+
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(out) // #nosec G304 -- path under t.TempDir()
+
+		return err == nil && strings.TrimSpace(string(data)) == "dns lan dns://1.1.1.1/example.com"
+	}, 2*time.Second, 5*time.Millisecond, "the stop action describes the outage that ended")
+}
+
+type fakeDiagnoser struct {
+	layer diagnosis.Layer
+}
+
+func (f fakeDiagnoser) Run(context.Context) diagnosis.Result {
+	return diagnosis.Result{
+		Layer: f.layer,
+		Steps: []diagnosis.Step{
+			{Name: diagnosis.StepInterface, Target: "eth0"},
+			{Name: diagnosis.StepGateway, Target: "192.0.2.1", Err: errors.New("unreachable")},
+		},
+	}
+}
+
+func Test_ProcessCheck_DiagnosesOutage(t *testing.T) {
+	loop := emptyNewLoop()
+	loop.SetDiagnoser(fakeDiagnoser{layer: diagnosis.LayerLAN})
+
+	loop.ProcessCheck(t.Context(), true)
+	loop.ProcessCheck(t.Context(), false)
+	loop.diagnoses.Wait()
+
+	assert.Equal(t, diagnosis.LayerLAN, loop.outageInfo().Diagnosis)
+
+	rpt := loop.status.GenStatReport(nil)
+	require.Len(t, rpt.Outages, 1)
+	assert.Nil(t, rpt.Outages[0].End)
+	require.NotNil(t, rpt.Outages[0].Diagnosis)
+	assert.Equal(t, "lan", rpt.Outages[0].Diagnosis.Layer)
+	require.Len(t, rpt.Outages[0].Diagnosis.Steps, 2)
+	assert.True(t, rpt.Outages[0].Diagnosis.Steps[0].OK)
+	assert.Equal(t, "unreachable", rpt.Outages[0].Diagnosis.Steps[1].Error)
+
+	loop.ProcessCheck(t.Context(), true)
+
+	assert.Empty(t, loop.outageInfo().Diagnosis)
+
+	rpt = loop.status.GenStatReport(nil)
+	require.Len(t, rpt.Outages, 1)
+	assert.NotNil(t, rpt.Outages[0].End)
+}
+
+func Test_ReloadDuringOutage(t *testing.T) {
+	loop := emptyNewLoop()
+	loop.SetDiagnoser(fakeDiagnoser{layer: diagnosis.LayerLAN})
+	loop.ProcessCheck(t.Context(), false)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for range 100 {
+			_ = loop.outageInfo()
+			loop.Notify(notify.Event{Type: notify.EventActionExecuted})
+		}
+	}()
+
+	// As ReloadLoop does, while down actions and the diagnosis run.
+	for i := range 100 {
+		loop.SetName(fmt.Sprintf("host%d", i))
+		loop.SetDiagnoser(nil)
+	}
+
+	<-done
+	loop.diagnoses.Wait()
+	assert.Equal(t, "host99", loop.outageInfo().Name)
+	assert.Equal(t, diagnosis.LayerLAN, loop.outageInfo().Diagnosis, "the diagnosis in progress completes")
+}
+
+func Test_ProcessCheck_OutageWithoutDiagnoser(t *testing.T) {
+	loop := emptyNewLoop()
+
+	loop.ProcessCheck(t.Context(), false)
+
+	rpt := loop.status.GenStatReport(nil)
+	require.Len(t, rpt.Outages, 1)
+	assert.Nil(t, rpt.Outages[0].Diagnosis)
+}
+
+func Test_ProcessCheck_RecordsFixingStage(t *testing.T) {
+	loop := emptyNewLoop()
+	loop.downAction = &DownAction{
+		Stages: []DownActionStage{{Name: "restart wan", After: time.Millisecond, Exec: testTrue}},
+	}
+
+	loop.ProcessCheck(t.Context(), false)
+
+	require.Eventually(t, func() bool {
+		return loop.currentDownActionLoop().ExecutedStage() != ""
+	}, time.Second, time.Millisecond)
+
+	loop.ProcessCheck(t.Context(), true)
+	loop.Stop(t.Context())
+
+	rpt := loop.status.GenStatReport(nil)
+	require.Len(t, rpt.Outages, 1)
+	assert.Equal(t, "restart wan", rpt.Outages[0].FixedBy)
+}
@@ -0,0 +1,41 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hugoh/upd/internal/schedule"
+	"github.com/hugoh/upd/internal/status"
+)
+
+// maintenanceWindows holds the windows during which down actions and their
+// stop actions are suppressed. Thread-safe: the Loop replaces the schedule on
+// reload while down action loops read it.
+type maintenanceWindows struct {
+	mu       sync.RWMutex
+	schedule schedule.Schedule
+}
+
+func (m *maintenanceWindows) set(s schedule.Schedule) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.schedule = s
+}
+
+// active returns the window in effect at now, or nil. Nil-safe.
+func (m *maintenanceWindows) active(now time.Time) *status.Maintenance {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	w, until := m.schedule.Active(now)
+	if w == nil {
+		return nil
+	}
+
+	return &status.Maintenance{Name: w.Name, Until: until}
+}
@@ -0,0 +1,100 @@
+package logic
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/schedule"
+	"github.com/hugoh/upd/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allDay is a window that is always active.
+var allDay = schedule.Schedule{{Name: "all day", End: 24 * time.Hour}}
+
+func Test_Maintenance_SuppressesActions(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "stopped")
+
+	loop := NewLoop()
+	da := &DownAction{
+		After:    time.Millisecond,
+		Every:    time.Millisecond,
+		Exec:     testTrue,
+		StopExec: "touch " + marker,
+	}
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+	loop.SetMaintenance(allDay)
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return dal.Status().Suppressed > 1
+	}, time.Second, time.Millisecond, "actions within the window should be suppressed")
+
+	dal.Stop(t.Context())
+
+	assert.Empty(t, dal.ExecutedStage())
+	assert.Empty(t, dal.Status().History)
+	assert.NoFileExists(t, marker, "nothing ran, so there is nothing to stop")
+}
+
+func Test_Maintenance_DefersOneShotAction(t *testing.T) {
+	loop := NewLoop()
+	da := &DownAction{After: time.Millisecond, Exec: testTrue}
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+
+	// A window ending shortly, as when an outage starts at its very end.
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	end := now.Add(100 * time.Millisecond).Sub(midnight)
+	loop.SetMaintenance(schedule.Schedule{{Name: "isp", Start: end - time.Hour, End: end}})
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return dal.ExecutedStage() != ""
+	}, 2*time.Second, time.Millisecond, "the one-shot action should run once the window is over")
+	dal.Stop(t.Context())
+
+	assert.Equal(t, uint32(1), dal.Status().Suppressed)
+	assert.Len(t, dal.Status().History, 1)
+}
+
+func Test_Maintenance_OutsideWindow(t *testing.T) {
+	loop := NewLoop()
+	da := &DownAction{After: time.Millisecond, Exec: testTrue}
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+
+	now := time.Now().UTC()
+	loop.SetMaintenance(schedule.Schedule{{
+		Days:  []time.Weekday{now.Add(48 * time.Hour).Weekday()},
+		Start: time.Hour,
+		End:   2 * time.Hour,
+	}})
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return dal.ExecutedStage() != ""
+	}, time.Second, time.Millisecond)
+	dal.Stop(t.Context())
+
+	assert.Zero(t, dal.Status().Suppressed)
+}
+
+func Test_Maintenance_Status(t *testing.T) {
+	loop := NewLoop()
+	loop.SetMaintenance(allDay)
+	loop.pushStatus()
+
+	rpt := loop.status.GenStatReport(nil)
+	require.NotNil(t, rpt.Loop.Maintenance)
+	assert.Equal(t, "all day", rpt.Loop.Maintenance.Name)
+	assert.True(t, rpt.Loop.Maintenance.Until.After(time.Now()))
+
+	loop.SetMaintenance(nil)
+	loop.pushStatus()
+	assert.Nil(t, loop.status.GenStatReport(nil).Loop.Maintenance)
+}
@@ -0,0 +1,33 @@
+package logic
+
+import (
+	"reflect"
+
+	"github.com/hugoh/upd/internal/mqtt"
+)
+
+// SetMQTT sets the MQTT broker the loop state is published on; nil stops
+// publishing. The publisher is only restarted when its configuration
+// changes. Must be called from Reload, or before Run.
+func (l *Loop) SetMQTT(config *mqtt.Config) {
+	if config != nil && l.mqtt != nil && reflect.DeepEqual(*config, l.mqttConfig) {
+		return
+	}
+
+	l.mqtt.Stop()
+	l.mqtt = nil
+
+	if config != nil {
+		l.mqttConfig = *config
+		l.mqtt = mqtt.Start(*config, l.requestRecheck)
+	}
+}
+
+// publishMQTT publishes the loop state, if an MQTT broker is set.
+func (l *Loop) publishMQTT() {
+	if l.mqtt == nil {
+		return
+	}
+
+	l.mqtt.Update(mqtt.StateOf(l.status.GenStatReport(l.mqttConfig.Reports)))
+}
@@ -0,0 +1,38 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/mqtt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SetMQTT_RestartsOnChange(t *testing.T) {
+	loop := NewLoop()
+	t.Cleanup(func() { loop.Stop(t.Context()) })
+
+	config := mqtt.Config{
+		Options: mqtt.Options{Broker: "mqtt://127.0.0.1:1"},
+		Reports: []time.Duration{time.Hour},
+	}
+
+	loop.SetMQTT(&config)
+	first := loop.mqtt
+	require.NotNil(t, first)
+
+	same := config
+	same.Reports = []time.Duration{time.Hour}
+	loop.SetMQTT(&same)
+	assert.Same(t, first, loop.mqtt, "an unchanged configuration keeps the publisher")
+
+	config.Topic = "lab"
+	loop.SetMQTT(&config)
+	assert.NotSame(t, first, loop.mqtt)
+
+	loop.ProcessCheck(t.Context(), true)
+
+	loop.SetMQTT(nil)
+	assert.Nil(t, loop.mqtt)
+}
@@ -0,0 +1,247 @@
+package logic
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hugoh/upd/internal/notify"
+	"github.com/hugoh/upd/internal/status"
+)
+
+// maxOutageActions caps the down actions listed in the EventUp of an outage;
+// the latest ones are kept.
+const maxOutageActions = 50
+
+// SetNotifications replaces the notification routes, with the messages that
+// could not be delivered kept in queue; no route disables notifications. The
+// previous notifier is closed first, so that its pending messages are stored
+// before the new one loads them. Must be called from Reload, or before Run.
+func (l *Loop) SetNotifications(queue notify.Queue, routes []notify.Route) error {
+	l.notifier.Swap(nil).Close()
+
+	if len(routes) == 0 {
+		return nil
+	}
+
+	notifier, err := notify.New(queue, routes...)
+	if err != nil {
+		return fmt.Errorf("starting notifications: %w", err)
+	}
+
+	l.notifier.Store(notifier)
+
+	return nil
+}
+
+// Notify sends ev with the loop name and the maintenance window in effect.
+// Within a maintenance window, EventDown and down action events are dropped;
+// down actions are still listed in the EventUp of their outage, which is only
+// dropped along with its EventDown (see notifyStateChange).
+func (l *Loop) Notify(ev notify.Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	l.recordOutageAction(ev)
+
+	notifier := l.notifier.Load()
+	if notifier == nil {
+		return
+	}
+
+	ev.Name = l.loopName()
+
+	if mw := l.maintenance.active(ev.Time); mw != nil {
+		if suppressedInMaintenance(ev.Type) {
+			return
+		}
+
+		ev.Maintenance = mw.Name
+	}
+
+	notifier.Notify(ev)
+}
+
+// suppressedInMaintenance tells whether events of type t are dropped within a
+// maintenance window.
+func suppressedInMaintenance(t notify.EventType) bool {
+	switch t {
+	case notify.EventDown, notify.EventActionExecuted, notify.EventActionFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// notifyStateChange notifies a transition of the connection status, with the
+// probes that failed. The connection being up on startup is not notified, nor
+// is the end of an outage whose start was not, as it began within a
+// maintenance window.
+func (l *Loop) notifyStateChange(upStatus bool, failed []FailedProbe) {
+	now := time.Now()
+
+	l.outageMu.Lock()
+	start, actions, muted := l.outageStart, l.outageActions, l.outageMuted
+	l.outageActions = nil
+
+	if upStatus {
+		l.outageStart = time.Time{}
+		l.outageMuted = false
+	} else {
+		l.outageStart = now
+		l.outageMuted = l.maintenance.active(now) != nil
+	}
+	l.outageMu.Unlock()
+
+	if !upStatus {
+		l.Notify(notify.Event{
+			Type:         notify.EventDown,
+			Time:         now,
+			Failure:      l.failures.dominant().String(),
+			FailedProbes: notifyProbes(failed),
+		})
+
+		return
+	}
+
+	if start.IsZero() || muted {
+		return
+	}
+
+	ev := notify.Event{
+		Type:         notify.EventUp,
+		Time:         now,
+		OutageStart:  start,
+		Duration:     now.Sub(start),
+		FailedProbes: notifyProbes(failed),
+		Actions:      actions,
+		Availability: availability(l.status.PeriodReports(l.reports)),
+	}
+
+	if dal := l.currentDownActionLoop(); dal != nil {
+		ev.FixedBy = dal.ExecutedStage()
+	}
+
+	l.diagnosisMu.Lock()
+	ev.Diagnosis = string(l.diagnosis)
+	l.diagnosisMu.Unlock()
+
+	l.Notify(ev)
+}
+
+func notifyProbes(failed []FailedProbe) []notify.Probe {
+	probes := make([]notify.Probe, len(failed))
+	for i, p := range failed {
+		probes[i] = notify.Probe{Target: p.Target, Error: p.Error}
+	}
+
+	return probes
+}
+
+// availability returns the availability of the periods computed so far.
+func availability(reports []status.ReportByPeriod) []notify.Availability {
+	var avail []notify.Availability
+
+	for _, stats := range reports {
+		if stats.Availability < 0 {
+			continue
+		}
+
+		avail = append(avail, notify.Availability{
+			Period:  time.Duration(stats.Period),
+			Percent: float64(stats.Availability) * status.PercentMultiplier,
+		})
+	}
+
+	return avail
+}
+
+// recordOutageAction keeps the down action of ev, if any, for the EventUp of
+// the current outage.
+func (l *Loop) recordOutageAction(ev notify.Event) {
+	if ev.Trigger != EventDown {
+		return
+	}
+
+	action := notify.Action{
+		Time:   ev.Time,
+		Stage:  ev.Stage,
+		Action: ev.Action,
+		Error:  ev.Error,
+	}
+
+	if ev.DryRun {
+		action.Action += " (dry run)"
+	}
+
+	if ev.Type == notify.EventActionFailed && action.Error == "" {
+		action.Error = fmt.Sprintf("exit code %d", ev.ExitCode)
+	}
+
+	l.outageMu.Lock()
+	defer l.outageMu.Unlock()
+
+	if l.outageStart.IsZero() {
+		return
+	}
+
+	if len(l.outageActions) >= maxOutageActions {
+		l.outageActions = slices.Delete(l.outageActions, 0, 1)
+	}
+
+	l.outageActions = append(l.outageActions, action)
+}
+
+// recordCommand adds a command to the history and notifies its outcome.
+func (dal *DownActionLoop) recordCommand(rec status.CommandRecord) {
+	dal.history.add(rec)
+
+	if dal.da.notify == nil {
+		return
+	}
+
+	ev := notify.Event{
+		Type:      notify.EventActionExecuted,
+		Trigger:   rec.Event,
+		Action:    rec.Command,
+		Stage:     rec.Stage,
+		Iteration: rec.Iteration,
+		ExitCode:  rec.ExitCode,
+		Error:     rec.Error,
+		DryRun:    rec.DryRun,
+	}
+
+	if rec.Killed {
+		ev.Error = "killed"
+	}
+
+	if ev.Error != "" || ev.ExitCode != 0 {
+		ev.Type = notify.EventActionFailed
+	}
+
+	dal.da.notify(ev)
+}
+
+// notifyAction notifies the outcome of a webhook or power cycle run for
+// trigger, EventDown or EventStop.
+func (dal *DownActionLoop) notifyAction(trigger, action string, err error) {
+	if dal.da.notify == nil {
+		return
+	}
+
+	ev := notify.Event{
+		Type:      notify.EventActionExecuted,
+		Trigger:   trigger,
+		Action:    action,
+		Stage:     int(dal.stage.Load()) + 1,
+		Iteration: dal.iteration.Load(),
+	}
+
+	if err != nil {
+		ev.Type = notify.EventActionFailed
+		ev.Error = err.Error()
+	}
+
+	dal.da.notify(ev)
+}
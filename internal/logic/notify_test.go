@@ -0,0 +1,327 @@
+package logic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/notify"
+	"github.com/hugoh/upd/internal/schedule"
+	"github.com/hugoh/upd/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventSink keeps the events it receives.
+type eventSink struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (s *eventSink) Send(_ context.Context, msg notify.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, msg.Event)
+
+	return nil
+}
+
+func (s *eventSink) received() []notify.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]notify.Event(nil), s.events...)
+}
+
+// failingSink fails every delivery.
+type failingSink struct{}
+
+func (failingSink) Send(context.Context, notify.Message) error {
+	return assert.AnError
+}
+
+func newNotifyingLoop(t *testing.T, sink *eventSink) *Loop {
+	t.Helper()
+
+	loop := NewLoop()
+	require.NoError(t, loop.SetNotifications(notify.Queue{}, []notify.Route{{Name: "test", Sink: sink}}))
+	t.Cleanup(func() { loop.Stop(context.Background()) })
+
+	return loop
+}
+
+func Test_Notify_StateChanges(t *testing.T) {
+	sink := &eventSink{}
+	loop := newNotifyingLoop(t, sink)
+	loop.SetName("home")
+
+	loop.ProcessCheck(t.Context(), true)
+	loop.ProcessCheck(t.Context(), false)
+	time.Sleep(10 * time.Millisecond)
+	loop.ProcessCheck(t.Context(), true)
+	loop.Stop(t.Context())
+
+	events := sink.received()
+	require.Len(t, events, 2, "being up on startup is not notified")
+
+	assert.Equal(t, notify.EventDown, events[0].Type)
+	assert.Equal(t, "home", events[0].Name)
+	assert.Empty(t, events[0].Maintenance)
+
+	assert.Equal(t, notify.EventUp, events[1].Type)
+	assert.GreaterOrEqual(t, events[1].Duration, 10*time.Millisecond)
+}
+
+func Test_Notify_Maintenance(t *testing.T) {
+	sink := &eventSink{}
+	loop := newNotifyingLoop(t, sink)
+
+	loop.ProcessCheck(t.Context(), true)
+	loop.ProcessCheck(t.Context(), false)
+	loop.SetMaintenance(allDay)
+	loop.Notify(notify.Event{Type: notify.EventActionExecuted, Trigger: EventDown, Action: "reboot"})
+	loop.Notify(notify.Event{Type: notify.EventActionFailed, Trigger: EventDown, Action: "reboot"})
+	loop.ProcessCheck(t.Context(), true)
+	loop.Stop(t.Context())
+
+	events := sink.received()
+	require.Len(t, events, 2, "action events are dropped within the window")
+
+	assert.Equal(t, notify.EventDown, events[0].Type)
+	assert.Equal(t, notify.EventUp, events[1].Type)
+	assert.Equal(t, "all day", events[1].Maintenance)
+	assert.Len(t, events[1].Actions, 2, "actions are still listed when the connection is back")
+}
+
+func Test_Notify_MaintenanceOutage(t *testing.T) {
+	sink := &eventSink{}
+	loop := newNotifyingLoop(t, sink)
+	loop.SetMaintenance(allDay)
+
+	loop.ProcessCheck(t.Context(), true)
+	loop.ProcessCheck(t.Context(), false)
+	loop.SetMaintenance(nil)
+	loop.ProcessCheck(t.Context(), true)
+	loop.ProcessCheck(t.Context(), false)
+	loop.ProcessCheck(t.Context(), true)
+	loop.Stop(t.Context())
+
+	events := sink.received()
+	require.Len(t, events, 2, "the end of an outage that began within the window is dropped")
+
+	assert.Equal(t, notify.EventDown, events[0].Type)
+	assert.Equal(t, notify.EventUp, events[1].Type)
+}
+
+func Test_Notify_Actions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+
+	sink := &eventSink{}
+	loop := newNotifyingLoop(t, sink)
+
+	da := &DownAction{
+		Stages: []DownActionStage{
+			{After: time.Millisecond, Exec: testTrue},
+			{After: 20 * time.Millisecond, Exec: testFalse},
+			{After: 40 * time.Millisecond, Webhook: &Webhook{URL: server.URL}},
+		},
+		StopExec: testTrue,
+	}
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return len(sink.received()) == 3
+	}, 2*time.Second, time.Millisecond)
+
+	dal.Stop(t.Context())
+	loop.Stop(t.Context())
+
+	events := sink.received()
+	require.Len(t, events, 4)
+
+	assert.Equal(t, notify.EventActionExecuted, events[0].Type)
+	assert.Contains(t, events[0].Action, testTrue)
+	assert.Equal(t, EventDown, events[0].Trigger)
+	assert.Equal(t, 1, events[0].Stage)
+
+	assert.Equal(t, notify.EventActionFailed, events[1].Type)
+	assert.Equal(t, 1, events[1].ExitCode)
+	assert.Equal(t, 2, events[1].Stage)
+
+	assert.Equal(t, notify.EventActionFailed, events[2].Type)
+	assert.Equal(t, "GET "+server.URL, events[2].Action)
+	assert.Contains(t, events[2].Error, "502")
+
+	assert.Equal(t, notify.EventActionExecuted, events[3].Type)
+	assert.Equal(t, EventStop, events[3].Trigger)
+}
+
+func Test_Notify_ReplacedNotifierDrains(t *testing.T) {
+	first := &eventSink{}
+	loop := newNotifyingLoop(t, first)
+
+	loop.Notify(notify.Event{Type: notify.EventConfigReloaded})
+
+	second := &eventSink{}
+	require.NoError(t, loop.SetNotifications(notify.Queue{}, []notify.Route{{Name: "second", Sink: second}}))
+	loop.Notify(notify.Event{Type: notify.EventConfigReloaded})
+	loop.Stop(t.Context())
+
+	assert.Len(t, first.received(), 1)
+	assert.Len(t, second.received(), 1)
+}
+
+func Test_Notify_ReplacedNotifierKeepsPending(t *testing.T) {
+	queue := notify.Queue{Dir: t.TempDir(), RetryMin: time.Hour}
+
+	loop := NewLoop()
+	t.Cleanup(func() { loop.Stop(context.Background()) })
+	require.NoError(t, loop.SetNotifications(queue, []notify.Route{{Name: "chat", Sink: failingSink{}}}))
+
+	loop.Notify(notify.Event{Type: notify.EventConfigReloaded})
+
+	sink := &eventSink{}
+	require.NoError(t, loop.SetNotifications(queue, []notify.Route{{Name: "chat", Sink: sink}}))
+
+	require.Eventually(t, func() bool {
+		return len(sink.received()) == 1
+	}, 2*time.Second, time.Millisecond, "the new notifier delivers what the old one could not")
+	loop.Stop(t.Context())
+
+	events := sink.received()
+	require.Len(t, events, 1)
+	assert.Equal(t, notify.EventConfigReloaded, events[0].Type)
+}
+
+func Test_Notify_NoRoutesDisables(t *testing.T) {
+	sink := &eventSink{}
+	loop := newNotifyingLoop(t, sink)
+
+	require.NoError(t, loop.SetNotifications(notify.Queue{}, nil))
+	loop.Notify(notify.Event{Type: notify.EventConfigReloaded})
+	loop.Stop(t.Context())
+
+	assert.Empty(t, sink.received())
+}
+
+func Test_Notify_OutageSummary(t *testing.T) {
+	sink := &eventSink{}
+	loop := newNotifyingLoop(t, sink)
+
+	da := &DownAction{
+		Stages: []DownActionStage{
+			{After: time.Millisecond, Exec: testTrue},
+			{After: 20 * time.Millisecond, Exec: testFalse},
+		},
+	}
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+
+	loop.ProcessCheck(t.Context(), false)
+	loop.Notify(notify.Event{Type: notify.EventActionExecuted, Trigger: EventStop, Action: "ignored"})
+
+	dal := loop.currentDownActionLoop()
+	require.NotNil(t, dal)
+	require.Eventually(t, func() bool {
+		return len(dal.history.snapshot()) == 2
+	}, 2*time.Second, time.Millisecond)
+
+	loop.ProcessCheck(t.Context(), true)
+	loop.Stop(t.Context())
+
+	events := sink.received()
+	up := events[len(events)-1]
+	require.Equal(t, notify.EventUp, up.Type)
+	assert.Equal(t, events[0].Time, up.OutageStart)
+	assert.Equal(t, up.Time.Sub(up.OutageStart), up.Duration)
+
+	require.Len(t, up.Actions, 2, "only the down actions of the outage")
+	assert.Equal(t, 1, up.Actions[0].Stage)
+	assert.Contains(t, up.Actions[0].Action, testTrue)
+	assert.Empty(t, up.Actions[0].Error)
+	assert.Equal(t, 2, up.Actions[1].Stage)
+	assert.Equal(t, "exit code 1", up.Actions[1].Error)
+	assert.Contains(t, up.Details(), "Actions:\n- ")
+}
+
+func Test_Notify_OutageActionsCapped(t *testing.T) {
+	loop := NewLoop()
+	loop.notifyStateChange(false, nil)
+
+	for i := range maxOutageActions + 5 {
+		loop.Notify(notify.Event{Type: notify.EventActionExecuted, Trigger: EventDown, Stage: i})
+	}
+
+	require.Len(t, loop.outageActions, maxOutageActions)
+	assert.Equal(t, 5, loop.outageActions[0].Stage, "the latest actions are kept")
+
+	loop.notifyStateChange(true, nil)
+	assert.Empty(t, loop.outageActions)
+}
+
+func Test_Notify_OutageProbesAndAvailability(t *testing.T) {
+	sink := &eventSink{}
+	loop := newNotifyingLoop(t, sink)
+	loop.SetReports(status.BucketConfig{}, time.Hour)
+
+	loop.ProcessCheck(t.Context(), true)
+	loop.failures.recordError("http://example.com", assert.AnError)
+	loop.ProcessCheck(t.Context(), false)
+	loop.ProcessCheck(t.Context(), true)
+	loop.Stop(t.Context())
+
+	events := sink.received()
+	require.Len(t, events, 2)
+
+	want := []notify.Probe{{Target: "http://example.com", Error: assert.AnError.Error()}}
+	assert.Equal(t, want, events[0].FailedProbes)
+	assert.Equal(t, want, events[1].FailedProbes, "the probes failed during the outage")
+
+	require.Len(t, events[1].Availability, 1)
+	assert.Equal(t, time.Hour, events[1].Availability[0].Period)
+	assert.Less(t, events[1].Availability[0].Percent, 100.0)
+}
+
+func Test_Notify_Digest(t *testing.T) {
+	sink := &eventSink{}
+	loop := newNotifyingLoop(t, sink)
+	loop.SetReports(status.BucketConfig{}, time.Hour)
+
+	loop.ProcessCheck(t.Context(), true)
+	loop.ProcessCheck(t.Context(), false)
+	loop.ProcessCheck(t.Context(), true)
+
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	at := now.Add(50 * time.Millisecond).Sub(midnight)
+	loop.SetDigest(&Digest{At: schedule.Window{Start: at, End: at}, Period: 24 * time.Hour})
+
+	select {
+	case <-loop.digestDue():
+	case <-time.After(2 * time.Second):
+		t.Fatal("digest not due")
+	}
+
+	loop.sendDigest()
+	assert.NotNil(t, loop.digestDue(), "the next digest is scheduled")
+	loop.Stop(t.Context())
+	assert.Nil(t, loop.digestDue())
+
+	events := sink.received()
+	digest := events[len(events)-1]
+	require.Equal(t, notify.EventDigest, digest.Type)
+	assert.Equal(t, 24*time.Hour, digest.Period)
+	require.Len(t, digest.Outages, 1)
+	assert.False(t, digest.Outages[0].End.IsZero())
+	assert.False(t, digest.OutagesTruncated)
+	require.Len(t, digest.Availability, 1)
+	assert.Equal(t, 24*time.Hour, digest.Availability[0].Period, "the availability of the digest period")
+}
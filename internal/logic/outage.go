@@ -0,0 +1,163 @@
+package logic
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hugoh/upd/internal/check"
+	"github.com/hugoh/upd/internal/diagnosis"
+)
+
+// Down action events, exposed as UPD_EVENT and to webhook templates as .Event.
+const (
+	// EventDown is sent while the connection is down.
+	EventDown = "down"
+	// EventStop is sent when the connection comes back.
+	EventStop = "stop"
+)
+
+// FailedProbe is a probe target that failed during the outage, with its
+// latest error.
+type FailedProbe struct {
+	Target string `json:"target"`
+	Error  string `json:"error"`
+}
+
+// OutageInfo describes the outage as seen by the monitoring loop.
+type OutageInfo struct {
+	Name         string
+	LastSuccess  time.Time
+	Failure      check.FailureClass
+	Diagnosis    diagnosis.Layer
+	FailedProbes []FailedProbe
+}
+
+// OutageInfoFunc returns the current OutageInfo. It is called each time a
+// down action command starts.
+type OutageInfoFunc func() OutageInfo
+
+// ActionContext is the outage context given to down action commands, as
+// UPD_* environment variables and optionally as JSON on stdin.
+type ActionContext struct {
+	Event          string        `json:"event"`
+	Name           string        `json:"name,omitempty"`
+	Iteration      uint32        `json:"iteration"`
+	Stage          int           `json:"stage"`
+	DownSince      time.Time     `json:"downSince"`
+	DownSeconds    int64         `json:"downSeconds"`
+	LastSuccess    *time.Time    `json:"lastSuccess,omitempty"`
+	BackoffSeconds int64         `json:"backoffSeconds"`
+	Failure        string        `json:"failure"`
+	Diagnosis      string        `json:"diagnosis,omitempty"`
+	FailedProbes   []FailedProbe `json:"failedProbes,omitempty"`
+}
+
+// Env returns the context as KEY=value environment variables. Variables for
+// unknown values (last success, diagnosis) are omitted.
+func (c *ActionContext) Env() []string {
+	env := []string{
+		"UPD_EVENT=" + c.Event,
+		"UPD_NAME=" + c.Name,
+		"UPD_ITERATION=" + strconv.FormatUint(uint64(c.Iteration), 10),
+		"UPD_STAGE=" + strconv.Itoa(c.Stage),
+		"UPD_DOWN_SINCE=" + c.DownSince.Format(time.RFC3339),
+		"UPD_DOWN_SECONDS=" + strconv.FormatInt(c.DownSeconds, 10),
+		"UPD_BACKOFF_SECONDS=" + strconv.FormatInt(c.BackoffSeconds, 10),
+		"UPD_FAILURE=" + c.Failure,
+	}
+
+	if c.LastSuccess != nil {
+		env = append(env, "UPD_LAST_SUCCESS="+c.LastSuccess.Format(time.RFC3339))
+	}
+
+	if c.Diagnosis != "" {
+		env = append(env, "UPD_DIAGNOSIS="+c.Diagnosis)
+	}
+
+	targets := make([]string, len(c.FailedProbes))
+	errs := make([]string, len(c.FailedProbes))
+
+	for i, probe := range c.FailedProbes {
+		targets[i] = probe.Target
+		errs[i] = probe.Target + ": " + probe.Error
+	}
+
+	return append(env,
+		"UPD_FAILED_TARGETS="+strings.Join(targets, ","),
+		"UPD_FAILED_ERRORS="+strings.Join(errs, "\n"))
+}
+
+// failureTally counts probe failures by class, and keeps the latest error
+// of each failed target, since the last successful iteration. Thread-safe.
+type failureTally struct {
+	mu     sync.Mutex
+	counts [check.FailureClassCount]int
+	probes map[string]string
+}
+
+func (t *failureTally) record(class check.FailureClass) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.counts[class]++
+}
+
+func (t *failureTally) recordError(target string, err error) {
+	if err == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.probes == nil {
+		t.probes = make(map[string]string)
+	}
+
+	t.probes[target] = err.Error()
+}
+
+func (t *failureTally) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.counts = [check.FailureClassCount]int{}
+	t.probes = nil
+}
+
+// dominant returns the most frequent failure class, FailureNone if no
+// failure was recorded. Ties go to the class listed first.
+func (t *failureTally) dominant() check.FailureClass {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	best := check.FailureNone
+	for class, n := range t.counts {
+		if n > t.counts[best] {
+			best = check.FailureClass(class)
+		}
+	}
+
+	return best
+}
+
+// failedProbes returns the failed targets sorted by target.
+func (t *failureTally) failedProbes() []FailedProbe {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	probes := make([]FailedProbe, 0, len(t.probes))
+	for target, err := range t.probes {
+		probes = append(probes, FailedProbe{Target: target, Error: err})
+	}
+
+	slices.SortFunc(probes, func(x, y FailedProbe) int {
+		return cmp.Compare(x.Target, y.Target)
+	})
+
+	return probes
+}
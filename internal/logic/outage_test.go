@@ -0,0 +1,83 @@
+package logic
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/check"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureTally_Dominant(t *testing.T) {
+	tally := &failureTally{}
+	assert.Equal(t, check.FailureNone, tally.dominant())
+
+	tally.record(check.FailureDNS)
+	tally.record(check.FailureTimeout)
+	tally.record(check.FailureTimeout)
+	assert.Equal(t, check.FailureTimeout, tally.dominant())
+
+	tally.reset()
+	assert.Equal(t, check.FailureNone, tally.dominant())
+}
+
+func TestFailureTally_TieGoesToFirstClass(t *testing.T) {
+	tally := &failureTally{}
+
+	tally.record(check.FailureTimeout)
+	tally.record(check.FailureDNS)
+
+	assert.Equal(t, check.FailureDNS, tally.dominant())
+}
+
+func TestFailureTally_FailedProbes(t *testing.T) {
+	tally := &failureTally{}
+	assert.Empty(t, tally.failedProbes())
+
+	tally.recordError("tcp://8.8.8.8:53", errors.New("timeout"))
+	tally.recordError("tcp://1.1.1.1:53", errors.New("refused"))
+	tally.recordError("tcp://8.8.8.8:53", errors.New("unreachable"))
+	tally.recordError("tcp://9.9.9.9:53", nil)
+
+	assert.Equal(t, []FailedProbe{
+		{Target: "tcp://1.1.1.1:53", Error: "refused"},
+		{Target: "tcp://8.8.8.8:53", Error: "unreachable"},
+	}, tally.failedProbes())
+
+	tally.reset()
+	assert.Empty(t, tally.failedProbes())
+}
+
+func TestActionContext_Env(t *testing.T) {
+	since := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	actx := ActionContext{
+		Event:          EventDown,
+		Name:           "cabin",
+		Iteration:      2,
+		Stage:          1,
+		DownSince:      since,
+		DownSeconds:    90,
+		BackoffSeconds: 15,
+		Failure:        "timeout",
+		Diagnosis:      "isp",
+		FailedProbes: []FailedProbe{
+			{Target: "a", Error: "e1"},
+			{Target: "b", Error: "e2"},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"UPD_EVENT=down",
+		"UPD_NAME=cabin",
+		"UPD_ITERATION=2",
+		"UPD_STAGE=1",
+		"UPD_DOWN_SINCE=2026-05-01T12:00:00Z",
+		"UPD_DOWN_SECONDS=90",
+		"UPD_BACKOFF_SECONDS=15",
+		"UPD_FAILURE=timeout",
+		"UPD_DIAGNOSIS=isp",
+		"UPD_FAILED_TARGETS=a,b",
+		"UPD_FAILED_ERRORS=a: e1\nb: e2",
+	}, actx.Env())
+}
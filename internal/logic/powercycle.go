@@ -0,0 +1,327 @@
+package logic
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hugoh/upd/internal/check"
+	"github.com/hugoh/upd/internal/logger"
+	"github.com/hugoh/upd/internal/notify"
+)
+
+// Smart plug firmwares supported by PowerCycle.
+const (
+	// FirmwareTasmota speaks the Tasmota cm?cmnd=Power command API.
+	FirmwareTasmota = "tasmota"
+	// FirmwareShellyGen1 speaks the Shelly Gen1 /relay API.
+	FirmwareShellyGen1 = "shellyGen1"
+	// FirmwareShellyGen2 speaks the Shelly Gen2+ RPC API.
+	FirmwareShellyGen2 = "shellyGen2"
+)
+
+const (
+	// DefaultPowerCycleOffFor is how long the relay stays off.
+	DefaultPowerCycleOffFor = 10 * time.Second
+	// DefaultPowerCycleRetries is how many times a relay command is retried
+	// when the relay state did not change.
+	DefaultPowerCycleRetries = 3
+	// NoPowerCycleRetries disables the retries of relay commands.
+	NoPowerCycleRetries = -1
+	// DefaultPowerCycleRetryDelay is the wait between retries.
+	DefaultPowerCycleRetryDelay = 2 * time.Second
+	// DefaultPowerCycleTimeout bounds each request to the plug.
+	DefaultPowerCycleTimeout = 5 * time.Second
+	// maxRelayResponse caps how much of a plug response is read.
+	maxRelayResponse = 4096
+)
+
+var (
+	// ErrUnknownFirmware is returned for an unsupported plug firmware.
+	ErrUnknownFirmware = errors.New("must be one of: tasmota, shellyGen1, shellyGen2")
+	// ErrPowerCycleHost is returned when the plug host is missing or not an
+	// HTTP(S) address.
+	ErrPowerCycleHost = errors.New("must be a host name, address or http(s) URL")
+	// ErrRelayState is returned when the relay did not reach the requested
+	// state after every retry.
+	ErrRelayState = errors.New("relay state did not change")
+	// errRelayResponse is returned when the plug answer cannot be understood.
+	errRelayResponse = errors.New("unexpected relay response")
+)
+
+// PowerCycle turns a smart plug relay off, waits, and turns it back on,
+// verifying each state change through the plug's local HTTP API.
+type PowerCycle struct {
+	Firmware string
+	// Host is the plug address, optionally with an http:// or https:// prefix.
+	Host string
+	// Relay is the 0-based relay index (Tasmota Power1 is relay 0).
+	Relay  int
+	OffFor time.Duration
+	// Retries is DefaultPowerCycleRetries when 0, and none when negative,
+	// such as NoPowerCycleRetries.
+	Retries    int
+	RetryDelay time.Duration
+	Timeout    time.Duration
+	User       string
+	Password   string
+}
+
+// Validate checks that the power cycle can be run.
+func (p *PowerCycle) Validate() error {
+	switch p.Firmware {
+	case FirmwareTasmota, FirmwareShellyGen1, FirmwareShellyGen2:
+	default:
+		return fmt.Errorf("firmware: %w", ErrUnknownFirmware)
+	}
+
+	parsed, err := url.Parse(p.baseURL())
+	if err != nil || p.Host == "" || (parsed.Scheme != check.HTTP && parsed.Scheme != check.HTTPS) {
+		return fmt.Errorf("host: %w", ErrPowerCycleHost)
+	}
+
+	return nil
+}
+
+// Run power-cycles the relay. Once the relay may be off it is always turned
+// back on, even when ctx is canceled while waiting: a canceled loop must never
+// leave the modem unpowered.
+func (p *PowerCycle) Run(ctx context.Context) error {
+	logger.DownAction().Info("power cycling relay",
+		"firmware", p.Firmware, "host", p.Host, "relay", p.Relay)
+
+	if err := p.setVerified(ctx, false); err != nil {
+		// The off command may have gone through before the failure.
+		if errOn := p.setVerified(context.WithoutCancel(ctx), true); errOn != nil {
+			return fmt.Errorf("turning relay off: %w (turning back on: %w)", err, errOn)
+		}
+
+		if ctx.Err() != nil {
+			logger.DownAction().Warn("canceled while turning relay off: turned it back on")
+
+			return nil
+		}
+
+		return fmt.Errorf("turning relay off: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		logger.DownAction().Warn("canceled while relay is off: turning it back on now")
+	case <-time.After(cmp.Or(p.OffFor, DefaultPowerCycleOffFor)):
+	}
+
+	if err := p.setVerified(context.WithoutCancel(ctx), true); err != nil {
+		return fmt.Errorf("turning relay back on: %w", err)
+	}
+
+	logger.DownAction().Info("relay power cycled", "host", p.Host, "relay", p.Relay)
+
+	return nil
+}
+
+// setVerified switches the relay and reads its state back, retrying until it
+// matches.
+func (p *PowerCycle) setVerified(ctx context.Context, on bool) error {
+	retries := p.Retries
+
+	switch {
+	case retries == 0:
+		retries = DefaultPowerCycleRetries
+	case retries < 0:
+		retries = 0
+	}
+
+	var err error
+
+	for attempt := range retries + 1 {
+		if attempt > 0 {
+			logger.DownAction().Warn("retrying relay command",
+				"host", p.Host, "on", on, "attempt", attempt, "error", err)
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+			case <-time.After(cmp.Or(p.RetryDelay, DefaultPowerCycleRetryDelay)):
+			}
+		}
+
+		err = p.set(ctx, on)
+		if err != nil {
+			continue
+		}
+
+		var state bool
+
+		state, err = p.state(ctx)
+		if err == nil && state != on {
+			err = ErrRelayState
+		}
+
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (p *PowerCycle) set(ctx context.Context, on bool) error {
+	_, err := p.get(ctx, p.setURL(on))
+
+	return err
+}
+
+func (p *PowerCycle) state(ctx context.Context) (bool, error) {
+	body, err := p.get(ctx, p.stateURL())
+	if err != nil {
+		return false, err
+	}
+
+	return p.parseState(body)
+}
+
+func (p *PowerCycle) baseURL() string {
+	host := strings.TrimSuffix(p.Host, "/")
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+
+	return host
+}
+
+func (p *PowerCycle) setURL(on bool) string {
+	relay := strconv.Itoa(p.Relay)
+
+	switch p.Firmware {
+	case FirmwareTasmota:
+		return p.tasmotaURL(fmt.Sprintf("Power%d %s", p.Relay+1, onOff(on, "On", "Off")))
+	case FirmwareShellyGen1:
+		return p.baseURL() + "/relay/" + relay + "?turn=" + onOff(on, "on", "off")
+	default:
+		return p.baseURL() + "/rpc/Switch.Set?id=" + relay + "&on=" + strconv.FormatBool(on)
+	}
+}
+
+func (p *PowerCycle) stateURL() string {
+	relay := strconv.Itoa(p.Relay)
+
+	switch p.Firmware {
+	case FirmwareTasmota:
+		return p.tasmotaURL(fmt.Sprintf("Power%d", p.Relay+1))
+	case FirmwareShellyGen1:
+		return p.baseURL() + "/relay/" + relay
+	default:
+		return p.baseURL() + "/rpc/Switch.GetStatus?id=" + relay
+	}
+}
+
+// tasmotaURL builds a command URL. Tasmota takes credentials as parameters.
+func (p *PowerCycle) tasmotaURL(command string) string {
+	query := url.Values{"cmnd": {command}}
+	if p.User != "" {
+		query.Set("user", p.User)
+		query.Set("password", p.Password)
+	}
+
+	return p.baseURL() + "/cm?" + query.Encode()
+}
+
+func (p *PowerCycle) parseState(body []byte) (bool, error) {
+	var state map[string]any
+	if err := json.Unmarshal(body, &state); err != nil {
+		return false, fmt.Errorf("%w: %w", errRelayResponse, err)
+	}
+
+	var value any
+
+	switch p.Firmware {
+	case FirmwareTasmota:
+		// Devices with a single relay answer POWER rather than POWER1.
+		value = cmp.Or(state[fmt.Sprintf("POWER%d", p.Relay+1)], state["POWER"])
+		if s, ok := value.(string); ok {
+			value = strings.EqualFold(s, "ON")
+		}
+	case FirmwareShellyGen1:
+		value = state["ison"]
+	default:
+		value = state["output"]
+	}
+
+	on, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s", errRelayResponse, body)
+	}
+
+	return on, nil
+}
+
+func (p *PowerCycle) get(ctx context.Context, target string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(p.Timeout, DefaultPowerCycleTimeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("error building relay request: %w", redactURLError(err))
+	}
+
+	if p.User != "" && p.Firmware != FirmwareTasmota {
+		req.SetBasicAuth(p.User, p.Password)
+	}
+
+	resp, err := notify.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("relay request failed: %w", redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRelayResponse))
+	if err != nil {
+		return nil, fmt.Errorf("reading relay response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", errRelayResponse, resp.Status)
+	}
+
+	return body, nil
+}
+
+// redactURLError hides the credentials in the URL of a request error, since
+// Tasmota takes the password as a query parameter.
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+
+	redacted := &url.Error{Op: urlErr.Op, URL: "[redacted]", Err: urlErr.Err}
+
+	if u, parseErr := url.Parse(urlErr.URL); parseErr == nil {
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", "xxxxx")
+			u.RawQuery = query.Encode()
+		}
+
+		redacted.URL = u.Redacted()
+	}
+
+	return redacted
+}
+
+func onOff(on bool, onValue, offValue string) string {
+	if on {
+		return onValue
+	}
+
+	return offValue
+}
@@ -0,0 +1,221 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePlug emulates the relay API of a smart plug firmware. ignore makes it
+// drop that many switch commands, as a flaky plug would.
+type fakePlug struct {
+	mu       sync.Mutex
+	firmware string
+	on       bool
+	ignore   int
+	switches []bool
+	auth     string
+}
+
+func newFakePlug(t *testing.T, firmware string) (*fakePlug, *httptest.Server) {
+	t.Helper()
+
+	plug := &fakePlug{firmware: firmware, on: true}
+	srv := httptest.NewServer(plug)
+	t.Cleanup(srv.Close)
+
+	return plug, srv
+}
+
+func (p *fakePlug) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if user, pass, ok := r.BasicAuth(); ok {
+		p.auth = user + ":" + pass
+	} else if user := r.URL.Query().Get("user"); user != "" {
+		p.auth = user + ":" + r.URL.Query().Get("password")
+	}
+
+	switch p.firmware {
+	case FirmwareTasmota:
+		cmnd := strings.Fields(r.URL.Query().Get("cmnd"))
+		if len(cmnd) == 2 {
+			p.toggle(strings.EqualFold(cmnd[1], "on"))
+		}
+
+		fmt.Fprintf(w, `{"POWER":%q}`, onOff(p.on, "ON", "OFF"))
+	case FirmwareShellyGen1:
+		if turn := r.URL.Query().Get("turn"); turn != "" {
+			p.toggle(turn == "on")
+		}
+
+		fmt.Fprintf(w, `{"ison":%t,"has_timer":false}`, p.on)
+	default:
+		if strings.HasSuffix(r.URL.Path, "Switch.Set") {
+			was := p.on
+			p.toggle(r.URL.Query().Get("on") == "true")
+			fmt.Fprintf(w, `{"was_on":%t}`, was)
+
+			return
+		}
+
+		fmt.Fprintf(w, `{"id":0,"output":%t}`, p.on)
+	}
+}
+
+func (p *fakePlug) toggle(on bool) {
+	p.switches = append(p.switches, on)
+	if p.ignore > 0 {
+		p.ignore--
+
+		return
+	}
+
+	p.on = on
+}
+
+func (p *fakePlug) snapshot() (bool, []bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.on, append([]bool(nil), p.switches...)
+}
+
+func testPowerCycle(srv *httptest.Server, firmware string) *PowerCycle {
+	return &PowerCycle{
+		Firmware:   firmware,
+		Host:       srv.URL,
+		OffFor:     time.Millisecond,
+		RetryDelay: time.Millisecond,
+	}
+}
+
+func TestPowerCycle_Firmwares(t *testing.T) {
+	for _, firmware := range []string{FirmwareTasmota, FirmwareShellyGen1, FirmwareShellyGen2} {
+		t.Run(firmware, func(t *testing.T) {
+			plug, srv := newFakePlug(t, firmware)
+			pc := testPowerCycle(srv, firmware)
+			pc.User = "admin"
+			pc.Password = "secret"
+
+			require.NoError(t, pc.Run(t.Context()))
+
+			on, switches := plug.snapshot()
+			assert.True(t, on)
+			assert.Equal(t, []bool{false, true}, switches)
+			assert.Equal(t, "admin:secret", plug.auth)
+		})
+	}
+}
+
+func TestPowerCycle_RetriesUntilStateChanges(t *testing.T) {
+	plug, srv := newFakePlug(t, FirmwareShellyGen2)
+	plug.ignore = 2
+
+	require.NoError(t, testPowerCycle(srv, FirmwareShellyGen2).Run(t.Context()))
+
+	on, switches := plug.snapshot()
+	assert.True(t, on)
+	assert.Equal(t, []bool{false, false, false, true}, switches)
+}
+
+func TestPowerCycle_GivesUp(t *testing.T) {
+	plug, srv := newFakePlug(t, FirmwareTasmota)
+	plug.ignore = 100
+	pc := testPowerCycle(srv, FirmwareTasmota)
+	pc.Retries = 1
+
+	err := pc.Run(t.Context())
+	require.ErrorIs(t, err, ErrRelayState)
+
+	_, switches := plug.snapshot()
+	assert.Equal(t, []bool{false, false, true}, switches,
+		"one attempt plus one retry, then a safety switch back on")
+}
+
+func TestPowerCycle_NoRetries(t *testing.T) {
+	plug, srv := newFakePlug(t, FirmwareShellyGen2)
+	plug.ignore = 100
+	pc := testPowerCycle(srv, FirmwareShellyGen2)
+	pc.Retries = NoPowerCycleRetries
+
+	require.ErrorIs(t, pc.Run(t.Context()), ErrRelayState)
+
+	_, switches := plug.snapshot()
+	assert.Equal(t, []bool{false, true}, switches, "a single attempt, then a safety switch back on")
+}
+
+func TestPowerCycle_TurnsBackOnWhenCanceled(t *testing.T) {
+	plug, srv := newFakePlug(t, FirmwareShellyGen1)
+	pc := testPowerCycle(srv, FirmwareShellyGen1)
+	pc.OffFor = time.Hour
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+
+	go func() { done <- pc.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		on, _ := plug.snapshot()
+
+		return !on
+	}, time.Second, time.Millisecond, "relay should be turned off")
+
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("power cycle did not finish after cancel")
+	}
+
+	on, _ := plug.snapshot()
+	assert.True(t, on, "relay must be turned back on")
+}
+
+func TestPowerCycle_ErrorHidesPassword(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	pc := testPowerCycle(srv, FirmwareTasmota)
+	pc.User = "admin"
+	pc.Password = "s3cret"
+	pc.Retries = 1
+
+	err := pc.Run(t.Context())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "s3cret")
+	assert.Contains(t, err.Error(), "password=xxxxx")
+}
+
+func TestPowerCycle_URLs(t *testing.T) {
+	pc := &PowerCycle{Firmware: FirmwareTasmota, Host: "192.0.2.5", Relay: 1}
+	assert.Equal(t, "http://192.0.2.5/cm?cmnd=Power2+Off", pc.setURL(false))
+	assert.Equal(t, "http://192.0.2.5/cm?cmnd=Power2", pc.stateURL())
+
+	pc = &PowerCycle{Firmware: FirmwareShellyGen1, Host: "http://plug.lan/"}
+	assert.Equal(t, "http://plug.lan/relay/0?turn=on", pc.setURL(true))
+
+	pc = &PowerCycle{Firmware: FirmwareShellyGen2, Host: "plug.lan", Relay: 2}
+	assert.Equal(t, "http://plug.lan/rpc/Switch.Set?id=2&on=false", pc.setURL(false))
+	assert.Equal(t, "http://plug.lan/rpc/Switch.GetStatus?id=2", pc.stateURL())
+}
+
+func TestPowerCycle_Validate(t *testing.T) {
+	require.NoError(t, (&PowerCycle{Firmware: FirmwareTasmota, Host: "192.0.2.5"}).Validate())
+	require.ErrorIs(t, (&PowerCycle{Firmware: "kasa", Host: "192.0.2.5"}).Validate(), ErrUnknownFirmware)
+	require.ErrorIs(t, (&PowerCycle{Firmware: FirmwareTasmota}).Validate(), ErrPowerCycleHost)
+	require.ErrorIs(t,
+		(&PowerCycle{Firmware: FirmwareTasmota, Host: "ftp://192.0.2.5"}).Validate(),
+		ErrPowerCycleHost)
+}
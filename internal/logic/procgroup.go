@@ -0,0 +1,74 @@
+package logic
+
+import (
+	"slices"
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+)
+
+// DefaultKillGrace is how long a terminated command may take to exit before
+// it is killed, when DownAction.KillGrace is 0.
+const DefaultKillGrace = 5 * time.Second
+
+// killGrace returns the grace period of terminated commands.
+func (da *DownAction) killGrace() time.Duration {
+	if da.KillGrace > 0 {
+		return da.KillGrace
+	}
+
+	return DefaultKillGrace
+}
+
+// groupPollInterval is how often a terminated process group is checked for
+// running processes.
+const groupPollInterval = 10 * time.Millisecond
+
+// terminate asks the process group of the command to exit, and kills what is
+// left of it once the whole group has exited or after grace. Must not be
+// called with cmdMu held, since waitForCmd needs it to finish.
+func (r *commandRun) terminate(grace time.Duration) {
+	r.killed.Store(true)
+	stopGroups(grace, r)
+}
+
+// stopGroups asks the process groups of runs to exit, and kills what is left
+// of them once they have all exited or after grace.
+func stopGroups(grace time.Duration, runs ...*commandRun) {
+	for _, r := range runs {
+		if err := terminateGroup(r.Process); err != nil {
+			logger.DownAction().Warn("failed to terminate command", "pid", r.Process.Pid, "error", err)
+		}
+	}
+
+	awaitGroups(grace, runs...)
+}
+
+// awaitGroups gives the processes of the groups of runs up to grace to exit,
+// then kills those left.
+func awaitGroups(grace time.Duration, runs ...*commandRun) {
+	running := func(r *commandRun) bool { return groupRunning(r.Process) }
+	deadline := time.Now().Add(grace)
+
+	for slices.ContainsFunc(runs, running) {
+		if !time.Now().Before(deadline) {
+			logger.DownAction().Warn("command did not exit in time: killing it",
+				"pid", runs[0].Process.Pid, "grace", grace)
+
+			break
+		}
+
+		time.Sleep(groupPollInterval)
+	}
+
+	for _, r := range runs {
+		r.reap()
+	}
+}
+
+// reap kills any process left in the group of the command.
+func (r *commandRun) reap() {
+	if err := killGroup(r.Process); err != nil {
+		logger.DownAction().Warn("failed to kill command", "pid", r.Process.Pid, "error", err)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !unix
+
+package logic
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op: only the command itself is signaled.
+func setProcessGroup(*exec.Cmd) {}
+
+// terminateGroup kills p, which cannot be asked to exit gracefully.
+func terminateGroup(p *os.Process) error {
+	return killGroup(p)
+}
+
+// groupRunning reports whether p is running: it has no group.
+func groupRunning(p *os.Process) bool {
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// killGroup kills p. A process that has already exited is not an error.
+func killGroup(p *os.Process) error {
+	err := p.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+
+	return err //nolint:wrapcheck // reported with the command
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package logic
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group, so that the
+// processes it spawns can be signaled with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateGroup asks the process group of p to exit.
+func terminateGroup(p *os.Process) error {
+	return signalGroup(p, syscall.SIGTERM)
+}
+
+// killGroup kills the process group of p. A group that has already exited is
+// not an error.
+func killGroup(p *os.Process) error {
+	return signalGroup(p, syscall.SIGKILL)
+}
+
+// groupRunning reports whether a process of the group of p is running.
+// Exited processes that were not reaped yet do not count. Without /proc to
+// tell them apart, any process of the group counts.
+func groupRunning(p *os.Process) bool {
+	if errors.Is(syscall.Kill(-p.Pid, 0), syscall.ESRCH) {
+		return false
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return true
+	}
+
+	pgid := strconv.Itoa(p.Pid)
+
+	for _, entry := range entries {
+		stat, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+
+		// The state, parent PID and process group follow the parenthesized
+		// command name.
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		if len(fields) > 2 && fields[2] == pgid && fields[0] != "Z" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func signalGroup(p *os.Process, sig syscall.Signal) error {
+	// The group leader is p, so the group ID is its PID.
+	err := syscall.Kill(-p.Pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+
+	return err //nolint:wrapcheck // reported with the command
+}
@@ -0,0 +1,179 @@
+//go:build unix
+
+package logic
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// processGone reports whether pid has exited. Orphans reparented to a PID 1
+// that does not reap them linger as zombies, which count as gone.
+func processGone(pid int) bool {
+	if errors.Is(syscall.Kill(pid, 0), syscall.ESRCH) {
+		return true
+	}
+
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+
+	// The state follows the parenthesized command name.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+// startWithChild runs a shell that runs setup, starts a background sleep and
+// waits for it. It returns the PID of the sleep.
+func startWithChild(ctx context.Context, t *testing.T, dal *DownActionLoop, setup string) int {
+	t.Helper()
+
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	script := setup + "sleep 30 & echo $! > " + pidFile + "; wait"
+
+	require.NoError(t, dal.Execute(ctx, "sh -c '"+script+"'"))
+
+	var pid int
+
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		if err != nil || !strings.HasSuffix(string(data), "\n") {
+			return false
+		}
+
+		pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	return pid
+}
+
+func Test_killCurrentCmd_KillsProcessGroup(t *testing.T) {
+	dal, _ := (&DownAction{}).NewDownActionLoop(t.Context())
+	child := startWithChild(t.Context(), t, dal, "")
+
+	dal.killCurrentCmd()
+	dal.cmdWG.Wait()
+
+	assert.Eventually(t, func() bool {
+		return processGone(child)
+	}, time.Second, time.Millisecond, "the background child must not be orphaned")
+
+	history := dal.Status().History
+	require.Len(t, history, 1)
+	assert.True(t, history[0].Killed)
+}
+
+func Test_killCurrentCmd_GracefulExit(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "terminated")
+
+	dal, _ := (&DownAction{KillGrace: 10 * time.Second}).NewDownActionLoop(t.Context())
+	child := startWithChild(t.Context(), t, dal, `trap "touch `+marker+`; exit 3" TERM; `)
+
+	start := time.Now()
+
+	dal.killCurrentCmd()
+	dal.cmdWG.Wait()
+
+	assert.Less(t, time.Since(start), 5*time.Second, "no need to wait for the grace period")
+	assert.FileExists(t, marker, "the command should get to clean up")
+	assert.Eventually(t, func() bool {
+		return processGone(child)
+	}, time.Second, time.Millisecond)
+	assert.Zero(t, dal.failures.Load(), "a terminated command does not count as failed")
+}
+
+func Test_killCurrentCmd_KillsAfterGrace(t *testing.T) {
+	const grace = 100 * time.Millisecond
+
+	dal, _ := (&DownAction{KillGrace: grace}).NewDownActionLoop(t.Context())
+	// Ignored signals stay ignored in the background sleep.
+	child := startWithChild(t.Context(), t, dal, `trap "" TERM; `)
+
+	start := time.Now()
+
+	dal.killCurrentCmd()
+	dal.cmdWG.Wait()
+
+	assert.GreaterOrEqual(t, time.Since(start), grace)
+	assert.Eventually(t, func() bool {
+		return processGone(child)
+	}, time.Second, time.Millisecond)
+}
+
+func Test_Cancel_KillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+
+	dal, _ := (&DownAction{KillGrace: 100 * time.Millisecond}).NewDownActionLoop(ctx)
+	child := startWithChild(ctx, t, dal, "")
+
+	cancel()
+	dal.cmdWG.Wait()
+
+	assert.Eventually(t, func() bool {
+		return processGone(child)
+	}, time.Second, time.Millisecond, "canceling must terminate the whole group")
+
+	history := dal.Status().History
+	require.Len(t, history, 1)
+	assert.True(t, history[0].Killed)
+}
+
+func Test_killCurrentCmd_GraceForWholeGroup(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "terminated")
+	child := filepath.Join(dir, "child.sh")
+	require.NoError(t, os.WriteFile(child,
+		[]byte(`trap "sleep 0.2; touch `+marker+`; exit 0" TERM; sleep 30 & wait`+"\n"), 0o600))
+
+	dal, _ := (&DownAction{KillGrace: 10 * time.Second}).NewDownActionLoop(t.Context())
+	// The output of the child is redirected, so that the command is done as
+	// soon as the shell exits.
+	require.NoError(t, dal.Execute(t.Context(), "sh -c 'sh "+child+" > /dev/null 2>&1 & wait'"))
+	time.Sleep(100 * time.Millisecond)
+
+	dal.killCurrentCmd()
+	dal.cmdWG.Wait()
+
+	assert.FileExists(t, marker, "the children get the grace period too")
+}
+
+func Test_Stop_ReapsLeftovers(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+
+	dal, _ := (&DownAction{}).NewDownActionLoop(t.Context())
+	// The output of the child is redirected, so that the command is done as
+	// soon as it exits.
+	require.NoError(t, dal.Execute(t.Context(),
+		"sh -c 'sleep 30 > /dev/null 2>&1 & echo $! > "+pidFile+"'"))
+	dal.cmdWG.Wait()
+
+	data, err := os.ReadFile(pidFile)
+	require.NoError(t, err)
+	child, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	require.NoError(t, err)
+	require.False(t, processGone(child), "the command exited, leaving its child running")
+
+	dal.Stop(t.Context())
+
+	assert.Eventually(t, func() bool {
+		return processGone(child)
+	}, time.Second, time.Millisecond, "stopping must reap what commands left behind")
+
+	history := dal.Status().History
+	require.Len(t, history, 1)
+	assert.False(t, history[0].Killed, "the command itself exited on its own")
+}
@@ -0,0 +1,103 @@
+package logic
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RateLimitWindow is the rolling window of DownAction.MaxPerDay.
+const RateLimitWindow = 24 * time.Hour
+
+// executionLog remembers when down actions ran, across outages, to enforce
+// DownAction.MaxPerDay and DownAction.MinInterval. Thread-safe.
+type executionLog struct {
+	mu    sync.Mutex
+	times []time.Time
+}
+
+// rateLimit is the outcome of a rate limit check.
+type rateLimit struct {
+	// reason is "" when the action may run.
+	reason string
+	// next is when the action may run again.
+	next time.Time
+	// recent is the number of executions within RateLimitWindow.
+	recent int
+}
+
+// check reports whether an action may run at now under the limits of da.
+func (e *executionLog) check(da *DownAction, now time.Time) rateLimit {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.prune(now)
+
+	recent := e.recent(now)
+	limit := rateLimit{recent: len(recent)}
+
+	if da.MaxPerDay > 0 && len(recent) >= da.MaxPerDay {
+		limit.reason = fmt.Sprintf("%d executions in the last %s", len(recent), RateLimitWindow)
+		limit.next = recent[len(recent)-da.MaxPerDay].Add(RateLimitWindow)
+	}
+
+	if da.MinInterval > 0 && len(e.times) > 0 {
+		if next := e.times[len(e.times)-1].Add(da.MinInterval); next.After(now) && next.After(limit.next) {
+			limit.reason = fmt.Sprintf("less than %s since the last execution", da.MinInterval)
+			limit.next = next
+		}
+	}
+
+	return limit
+}
+
+// record notes an execution at t.
+func (e *executionLog) record(t time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.times = append(e.times, t)
+	e.prune(t)
+}
+
+// recent returns the executions within RateLimitWindow of now. Must be
+// called with the lock held.
+func (e *executionLog) recent(now time.Time) []time.Time {
+	idx, _ := slices.BinarySearchFunc(e.times, now.Add(-RateLimitWindow), time.Time.Compare)
+
+	return e.times[idx:]
+}
+
+// prune drops the executions outside RateLimitWindow, but keeps the last one
+// for MinInterval. Must be called with the lock held.
+func (e *executionLog) prune(now time.Time) {
+	old := min(len(e.times)-len(e.recent(now)), len(e.times)-1)
+	if old > 0 {
+		e.times = slices.Delete(e.times, 0, old)
+	}
+}
+
+// snapshot returns the executions that still matter at now.
+func (e *executionLog) snapshot(now time.Time) []time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.prune(now)
+
+	return slices.Clone(e.times)
+}
+
+// restore loads saved executions unless some were already recorded.
+func (e *executionLog) restore(times []time.Time, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.times) > 0 || len(times) == 0 {
+		return
+	}
+
+	e.times = slices.Clone(times)
+	slices.SortFunc(e.times, time.Time.Compare)
+	e.prune(now)
+}
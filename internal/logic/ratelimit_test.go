@@ -0,0 +1,110 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_executionLog_NoLimits(t *testing.T) {
+	log := &executionLog{}
+	now := time.Now()
+
+	for range 10 {
+		log.record(now)
+	}
+
+	limit := log.check(&DownAction{}, now)
+	assert.Empty(t, limit.reason)
+	assert.Equal(t, 10, limit.recent)
+}
+
+func Test_executionLog_MaxPerDay(t *testing.T) {
+	log := &executionLog{}
+	da := &DownAction{MaxPerDay: 2}
+	now := time.Now()
+
+	log.record(now.Add(-25 * time.Hour))
+	log.record(now.Add(-10 * time.Hour))
+	assert.Empty(t, log.check(da, now).reason, "executions outside the window do not count")
+
+	log.record(now.Add(-time.Hour))
+
+	limit := log.check(da, now)
+	assert.Contains(t, limit.reason, "2 executions")
+	assert.Equal(t, now.Add(14*time.Hour), limit.next)
+	assert.Equal(t, 2, limit.recent)
+
+	assert.Empty(t, log.check(da, now.Add(14*time.Hour+time.Second)).reason)
+}
+
+func Test_executionLog_MinInterval(t *testing.T) {
+	log := &executionLog{}
+	da := &DownAction{MinInterval: 48 * time.Hour}
+	now := time.Now()
+
+	log.record(now.Add(-30 * time.Hour))
+
+	limit := log.check(da, now)
+	assert.Contains(t, limit.reason, "since the last execution")
+	assert.Equal(t, now.Add(18*time.Hour), limit.next)
+	assert.Zero(t, limit.recent, "the last execution is kept beyond the window")
+}
+
+func Test_executionLog_Prune(t *testing.T) {
+	log := &executionLog{}
+	now := time.Now()
+
+	for i := range 5 {
+		log.record(now.Add(time.Duration(i-50) * time.Hour))
+	}
+
+	log.record(now)
+	require.Len(t, log.times, 1)
+}
+
+func Test_RateLimit_SkipsAction(t *testing.T) {
+	da := &DownAction{
+		After:     time.Millisecond,
+		Every:     time.Millisecond,
+		Exec:      testTrue,
+		MaxPerDay: 2,
+	}
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return dal.Status().Skipped > 0
+	}, time.Second, time.Millisecond, "actions over the limit should be skipped")
+
+	dal.Stop(t.Context())
+
+	st := dal.Status()
+	assert.Equal(t, 2, st.Executions24h)
+	assert.Contains(t, st.RateLimited, "2 executions")
+	require.NotNil(t, st.NextAllowedAt)
+	assert.Len(t, st.History, 2)
+}
+
+func Test_RateLimit_SharedAcrossOutages(t *testing.T) {
+	loop := NewLoop()
+	da := &DownAction{After: time.Millisecond, Exec: testTrue, MinInterval: time.Hour}
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+
+	first := da.Start(t.Context(), nil)
+	require.Eventually(t, func() bool {
+		return first.ExecutedStage() != ""
+	}, time.Second, time.Millisecond)
+	first.Stop(t.Context())
+
+	second := da.Start(t.Context(), nil)
+	require.Eventually(t, func() bool {
+		return second.Status().Skipped == 1
+	}, time.Second, time.Millisecond, "the next outage is within MinInterval")
+	second.Stop(t.Context())
+
+	assert.Empty(t, second.ExecutedStage())
+}
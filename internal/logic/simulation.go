@@ -0,0 +1,114 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+)
+
+var (
+	// ErrNoDownAction is returned when simulating an outage without a down
+	// action to run.
+	ErrNoDownAction = errors.New("no down action configured")
+	// ErrConnectionDown is returned when simulating an outage while the
+	// connection is actually down.
+	ErrConnectionDown = errors.New("the connection is down")
+	// ErrNotDryRun is returned when simulating an outage with a down action
+	// that would really run.
+	ErrNotDryRun = errors.New("outages are only simulated with dry runs")
+)
+
+// SimulateOutage runs the down action for duration as if the connection were
+// down, then its stop action, without changing the connection status or the
+// statistics. A duration of 0 ends the simulated outage now, as does a real
+// outage. Only dry runs are simulated: it shows what a down action would do.
+// The loop must be running.
+func (l *Loop) SimulateOutage(ctx context.Context, duration time.Duration) error {
+	var err error
+
+	reloadErr := l.Reload(ctx, func() {
+		err = l.simulateOutage(ctx, duration)
+	})
+	if reloadErr != nil {
+		return reloadErr
+	}
+
+	return err
+}
+
+func (l *Loop) simulateOutage(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		l.endSimulation(ctx)
+		l.pushStatus()
+
+		return nil
+	}
+
+	switch {
+	case l.downAction == nil:
+		return ErrNoDownAction
+	case !l.downAction.DryRun:
+		return ErrNotDryRun
+	case !l.status.Up && l.simulation == nil:
+		return ErrConnectionDown
+	}
+
+	if l.simulation == nil {
+		logger.Loop().Info("simulating outage", "for", duration, "dryRun", l.downAction.DryRun)
+
+		// The request may come with a short-lived context: the down action
+		// lasts until the simulation ends or the loop stops.
+		if err := l.DownActionStart(context.WithoutCancel(ctx)); err != nil {
+			return err
+		}
+	} else {
+		l.simulation.Stop()
+		logger.Loop().Info("extending simulated outage", "for", duration)
+	}
+
+	l.simulation = time.NewTimer(duration)
+	l.simulatedUntil = time.Now().Add(duration)
+	l.pushStatus()
+
+	return nil
+}
+
+// simulationEnd returns the channel of the end of the simulated outage, nil
+// when none is in progress.
+func (l *Loop) simulationEnd() <-chan time.Time {
+	if l.simulation == nil {
+		return nil
+	}
+
+	return l.simulation.C
+}
+
+// endSimulation ends the simulated outage, if any, and stops its down action.
+func (l *Loop) endSimulation(ctx context.Context) {
+	if l.simulation == nil {
+		return
+	}
+
+	logger.Loop().Info("simulated outage over")
+	l.clearSimulation()
+
+	l.downActionMu.Lock()
+	dal := l.downActionLoop
+	l.downActionLoop = nil
+	l.downActionMu.Unlock()
+
+	if dal != nil {
+		// Async: StopExec can take up to StopExecTimeout and must not block
+		// the check loop.
+		go dal.Stop(ctx)
+	}
+}
+
+func (l *Loop) clearSimulation() {
+	if l.simulation != nil {
+		l.simulation.Stop()
+		l.simulation = nil
+	}
+}
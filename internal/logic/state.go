@@ -0,0 +1,112 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateMaxOverdue is how late a restored outage may be on its schedule. A
+// saved outage whose next run is overdue by more is stale: upd was stopped
+// too long to know whether the connection came back meanwhile.
+const StateMaxOverdue = time.Hour
+
+// stateFileMode keeps the state file private to the upd user.
+const stateFileMode = 0o600
+
+// State is the down action state kept across restarts and reloads.
+type State struct {
+	// Outage is the outage in progress, nil when the connection is up.
+	Outage *OutageState `json:"outage,omitempty"`
+	// Executions are the recent down action runs, for the rate limits.
+	Executions []time.Time `json:"executions,omitempty"`
+	SavedAt    time.Time   `json:"savedAt"`
+}
+
+// OutageState is the schedule of the down action of an outage in progress.
+type OutageState struct {
+	Start time.Time `json:"start"`
+	// Stage is the 1-based current stage.
+	Stage     int    `json:"stage"`
+	Iteration uint32 `json:"iteration"`
+	// SleepTime is the current backoff delay, in nanoseconds.
+	SleepTime     time.Duration `json:"sleepTime"`
+	BackoffCapped bool          `json:"backoffCapped"`
+	// Executed is the 1-based last stage that ran, 0 if none did.
+	Executed  int       `json:"executed"`
+	NextRunAt time.Time `json:"nextRunAt,omitzero"`
+	// Done is set once every stage has run.
+	Done bool `json:"done,omitempty"`
+}
+
+// StateFile stores the State as JSON. Writes replace the file atomically.
+type StateFile struct {
+	path string
+}
+
+// NewStateFile creates a StateFile at path.
+func NewStateFile(path string) *StateFile {
+	return &StateFile{path: path}
+}
+
+// Load reads the state. A missing file is an empty state.
+func (f *StateFile) Load() (State, error) {
+	var st State
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+
+	if err != nil {
+		return st, fmt.Errorf("reading state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &st); err != nil {
+		return State{}, fmt.Errorf("parsing state file %s: %w", f.path, err)
+	}
+
+	return st, nil
+}
+
+// Save writes the state.
+func (f *StateFile) Save(st State) error {
+	st.SavedAt = time.Now()
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("creating state file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // gone after a successful rename
+
+	if err := tmp.Chmod(stateFileMode); err != nil {
+		_ = tmp.Close()
+
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("replacing state file: %w", err)
+	}
+
+	return nil
+}
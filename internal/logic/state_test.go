@@ -0,0 +1,201 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStateFile(t *testing.T) *StateFile {
+	t.Helper()
+
+	return NewStateFile(filepath.Join(t.TempDir(), "state.json"))
+}
+
+func TestStateFile_RoundTrip(t *testing.T) {
+	file := newTestStateFile(t)
+	start := time.Now().Add(-time.Hour).Round(0)
+
+	st, err := file.Load()
+	require.NoError(t, err, "a missing file is an empty state")
+	assert.Nil(t, st.Outage)
+
+	require.NoError(t, file.Save(State{
+		Outage:     &OutageState{Start: start, Stage: 2, Iteration: 3, SleepTime: time.Minute},
+		Executions: []time.Time{start},
+	}))
+
+	info, err := os.Stat(file.path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(stateFileMode), info.Mode().Perm())
+
+	st, err = file.Load()
+	require.NoError(t, err)
+	require.NotNil(t, st.Outage)
+	assert.True(t, start.Equal(st.Outage.Start))
+	assert.Equal(t, 2, st.Outage.Stage)
+	assert.Equal(t, uint32(3), st.Outage.Iteration)
+	assert.Equal(t, time.Minute, st.Outage.SleepTime)
+	assert.Len(t, st.Executions, 1)
+	assert.False(t, st.SavedAt.IsZero())
+}
+
+func TestStateFile_Corrupt(t *testing.T) {
+	file := newTestStateFile(t)
+	require.NoError(t, os.WriteFile(file.path, []byte("{"), stateFileMode))
+
+	_, err := file.Load()
+	require.Error(t, err)
+}
+
+func Test_Restore_ResumesSchedule(t *testing.T) {
+	file := newTestStateFile(t)
+	start := time.Now().Add(-time.Hour)
+	next := time.Now().Add(time.Hour)
+	require.NoError(t, file.Save(State{Outage: &OutageState{
+		Start:         start,
+		Stage:         1,
+		Iteration:     4,
+		SleepTime:     30 * time.Minute,
+		BackoffCapped: true,
+		Executed:      1,
+		NextRunAt:     next,
+	}}))
+
+	da := &DownAction{After: time.Millisecond, Every: time.Minute, Exec: testTrue, State: file}
+	dal, _ := da.NewDownActionLoop(t.Context())
+
+	st := dal.Status()
+	assert.Equal(t, uint32(4), st.Iteration)
+	assert.True(t, st.BackoffCapped)
+	assert.Equal(t, status.ReadableDuration(30*time.Minute), st.SleepTime)
+	assert.True(t, start.Equal(dal.started))
+	assert.True(t, next.Equal(dal.resumeAt))
+	assert.Equal(t, "stage 1", dal.ExecutedStage())
+}
+
+func Test_Restore_IgnoresStaleOrMismatchedState(t *testing.T) {
+	tests := []struct {
+		name   string
+		outage OutageState
+	}{
+		{"overdue", OutageState{Stage: 1, NextRunAt: time.Now().Add(-2 * StateMaxOverdue)}},
+		{"stages changed", OutageState{Stage: 3, NextRunAt: time.Now()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := newTestStateFile(t)
+			tt.outage.Iteration = 7
+			require.NoError(t, file.Save(State{Outage: &tt.outage}))
+
+			da := &DownAction{Exec: testTrue, State: file}
+			dal, _ := da.NewDownActionLoop(t.Context())
+			assert.Zero(t, dal.Status().Iteration)
+			assert.True(t, dal.resumeAt.IsZero())
+		})
+	}
+}
+
+func Test_SuspendKeepsStateAndStopClearsIt(t *testing.T) {
+	file := newTestStateFile(t)
+	da := &DownAction{After: time.Millisecond, Every: time.Hour, Exec: testTrue, State: file}
+
+	dal := da.Start(t.Context(), nil)
+	require.Eventually(t, func() bool {
+		return dal.ExecutedStage() != ""
+	}, time.Second, time.Millisecond)
+	dal.Suspend(t.Context())
+
+	st, err := file.Load()
+	require.NoError(t, err)
+	require.NotNil(t, st.Outage)
+	assert.Equal(t, uint32(1), st.Outage.Iteration)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), st.Outage.NextRunAt, time.Minute)
+	assert.Len(t, st.Executions, 1)
+
+	resumed := da.Start(t.Context(), nil)
+	assert.Equal(t, uint32(1), resumed.Status().Iteration)
+	assert.Equal(t, 1, resumed.Status().Executions24h, "executions are restored")
+	resumed.Stop(t.Context())
+
+	st, err = file.Load()
+	require.NoError(t, err)
+	assert.Nil(t, st.Outage, "stopping ends the outage")
+	assert.Len(t, st.Executions, 1, "executions are kept for the rate limits")
+}
+
+func Test_Restore_CompletedScheduleDoesNotRerun(t *testing.T) {
+	file := newTestStateFile(t)
+	da := &DownAction{After: time.Millisecond, Exec: testTrue, State: file}
+
+	dal := da.Start(t.Context(), nil)
+	dal.runWG.Wait()
+	dal.Suspend(t.Context())
+
+	st, err := file.Load()
+	require.NoError(t, err)
+	require.NotNil(t, st.Outage)
+	assert.True(t, st.Outage.Done)
+
+	resumed := da.Start(t.Context(), nil)
+	resumed.runWG.Wait()
+	assert.Empty(t, resumed.Status().History, "the one-shot action already ran")
+	resumed.Suspend(t.Context())
+}
+
+func Test_Loop_SuspendsAndResumesWithStateFile(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "stopped")
+	da := &DownAction{
+		After:    time.Hour,
+		Exec:     testTrue,
+		StopExec: "touch " + marker,
+		State:    newTestStateFile(t),
+	}
+
+	loop := NewLoop()
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+	loop.ProcessCheck(t.Context(), false)
+	require.NotNil(t, loop.currentDownActionLoop())
+
+	loop.Stop(t.Context())
+	assert.Nil(t, loop.currentDownActionLoop())
+	assert.NoFileExists(t, marker, "the outage is not over: no stop action")
+
+	// After a reload the connection is still down: the down action resumes.
+	loop.ProcessCheck(t.Context(), false)
+	require.NotNil(t, loop.currentDownActionLoop())
+
+	loop.Stop(t.Context())
+}
+
+func Test_Loop_UpOnStartupDiscardsSavedOutage(t *testing.T) {
+	file := newTestStateFile(t)
+	executed := time.Now().Add(-time.Minute)
+	require.NoError(t, file.Save(State{
+		Outage:     &OutageState{Stage: 1, Iteration: 5, NextRunAt: time.Now().Add(time.Minute)},
+		Executions: []time.Time{executed},
+	}))
+
+	da := &DownAction{After: time.Hour, Exec: testTrue, State: file}
+	loop := NewLoop()
+	loop.Configure(nil, Delays{}, da, status.BucketConfig{})
+	loop.ProcessCheck(t.Context(), true)
+
+	st, err := file.Load()
+	require.NoError(t, err)
+	assert.Nil(t, st.Outage, "the outage ended while upd was not running")
+	assert.Len(t, st.Executions, 1, "executions are kept for the rate limits")
+
+	loop.ProcessCheck(t.Context(), false)
+	dal := loop.currentDownActionLoop()
+	require.NotNil(t, dal)
+	assert.Zero(t, dal.Status().Iteration, "the next outage starts afresh")
+
+	loop.Stop(t.Context())
+}
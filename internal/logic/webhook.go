@@ -0,0 +1,143 @@
+package logic
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+	"github.com/hugoh/upd/internal/notify"
+)
+
+// DefaultWebhookTimeout bounds a webhook request when no timeout is set.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// ErrWebhookStatusCode is returned for success codes outside 100-599.
+var ErrWebhookStatusCode = errors.New("must be between 100 and 599")
+
+// Webhook is an HTTP request sent as a down or up action, an alternative to
+// running a command.
+type Webhook struct {
+	// Method defaults to POST when a body is set, GET otherwise.
+	Method  string
+	URL     string
+	Headers map[string]string
+	// Body is a text/template rendered with WebhookData.
+	Body    string
+	Timeout time.Duration
+	// SuccessCodes are the status codes that count as success. Any 2xx
+	// status does when empty.
+	SuccessCodes []int
+}
+
+// WebhookData is the data available to webhook body templates.
+type WebhookData struct {
+	// Event is EventDown or EventStop.
+	Event     string
+	Iteration uint32
+	Stage     int
+	// OutageStart is when the connection went down.
+	OutageStart time.Time
+	// DownFor is how long the connection has been down.
+	DownFor time.Duration
+}
+
+// Validate checks that the webhook can be sent.
+func (w *Webhook) Validate() error {
+	if err := notify.ValidateWebhookURL(w.URL); err != nil {
+		return err
+	}
+
+	if _, err := template.New("body").Parse(w.Body); err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+
+	for _, code := range w.SuccessCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("successCodes: %d %w", code, ErrWebhookStatusCode)
+		}
+	}
+
+	return nil
+}
+
+// Send renders the body and performs the request, returning an error unless
+// the response status counts as a success.
+func (w *Webhook) Send(ctx context.Context, data WebhookData) error {
+	body, err := w.render(data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(w.Timeout, DefaultWebhookTimeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, w.method(), w.URL, body)
+	if err != nil {
+		return fmt.Errorf("error building webhook request: %w", err)
+	}
+
+	for key, value := range w.Headers {
+		req.Header.Set(key, value)
+	}
+
+	logURL := notify.RedactURL(w.URL)
+
+	logger.DownAction().Info("sending webhook",
+		"method", req.Method, "url", logURL, "event", data.Event, "iteration", data.Iteration)
+
+	code, err := notify.DoWebhook(req, w.succeeded)
+	if err != nil {
+		return err //nolint:wrapcheck // already describes the webhook
+	}
+
+	logger.DownAction().Debug("webhook succeeded", "url", logURL, "status", code)
+
+	return nil
+}
+
+func (w *Webhook) method() string {
+	if w.Method != "" {
+		return strings.ToUpper(w.Method)
+	}
+
+	if w.Body != "" {
+		return http.MethodPost
+	}
+
+	return http.MethodGet
+}
+
+func (w *Webhook) render(data WebhookData) (io.Reader, error) {
+	if w.Body == "" {
+		return http.NoBody, nil
+	}
+
+	tmpl, err := template.New("body").Parse(w.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook body template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("rendering webhook body: %w", err)
+	}
+
+	return &buf, nil
+}
+
+func (w *Webhook) succeeded(code int) bool {
+	if len(w.SuccessCodes) == 0 {
+		return notify.StatusOK(code)
+	}
+
+	return slices.Contains(w.SuccessCodes, code)
+}
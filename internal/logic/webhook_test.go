@@ -0,0 +1,155 @@
+package logic
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type webhookRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// webhookRecorder is a test server recording every request it receives and
+// answering with status.
+type webhookRecorder struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []webhookRequest
+	status   int
+}
+
+func newWebhookRecorder(t *testing.T, status int) *webhookRecorder {
+	t.Helper()
+
+	rec := &webhookRecorder{status: status}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rec.mu.Lock()
+		rec.requests = append(rec.requests, webhookRequest{
+			method: r.Method,
+			header: r.Header,
+			body:   string(body),
+		})
+		rec.mu.Unlock()
+
+		w.WriteHeader(rec.status)
+	}))
+	t.Cleanup(rec.Close)
+
+	return rec
+}
+
+func (r *webhookRecorder) received() []webhookRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]webhookRequest(nil), r.requests...)
+}
+
+func TestWebhook_Send(t *testing.T) {
+	rec := newWebhookRecorder(t, http.StatusNoContent)
+	wh := &Webhook{
+		URL:     rec.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Body:    `{"event":"{{.Event}}","iteration":{{.Iteration}},"down":"{{.DownFor}}"}`,
+	}
+
+	err := wh.Send(t.Context(), WebhookData{
+		Event:     EventDown,
+		Iteration: 3,
+		DownFor:   90 * time.Second,
+	})
+	require.NoError(t, err)
+
+	reqs := rec.received()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, http.MethodPost, reqs[0].method)
+	assert.Equal(t, "Bearer token", reqs[0].header.Get("Authorization"))
+	assert.Equal(t, `{"event":"down","iteration":3,"down":"1m30s"}`, reqs[0].body)
+}
+
+func TestWebhook_SendWithoutBodyUsesGet(t *testing.T) {
+	rec := newWebhookRecorder(t, http.StatusOK)
+
+	require.NoError(t, (&Webhook{URL: rec.URL}).Send(t.Context(), WebhookData{}))
+
+	reqs := rec.received()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, http.MethodGet, reqs[0].method)
+}
+
+func TestWebhook_SendStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		codes   []int
+		wantErr bool
+	}{
+		{"2xx by default", http.StatusAccepted, nil, false},
+		{"5xx fails", http.StatusBadGateway, nil, true},
+		{"3xx fails by default", http.StatusNotModified, nil, true},
+		{"custom success", http.StatusNotModified, []int{http.StatusNotModified}, false},
+		{"custom excludes 200", http.StatusOK, []int{http.StatusCreated}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := newWebhookRecorder(t, tt.status)
+			wh := &Webhook{Method: "put", URL: rec.URL, SuccessCodes: tt.codes}
+
+			err := wh.Send(t.Context(), WebhookData{})
+			if tt.wantErr {
+				require.ErrorIs(t, err, notify.ErrWebhookStatus)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, http.MethodPut, rec.received()[0].method)
+		})
+	}
+}
+
+func TestWebhook_Validate(t *testing.T) {
+	require.NoError(t, (&Webhook{URL: "https://example.com/hook", Body: "{{.Stage}}"}).Validate())
+	require.ErrorIs(t, (&Webhook{URL: "ftp://example.com/"}).Validate(), notify.ErrWebhookURL)
+	require.ErrorIs(t, (&Webhook{URL: "/relative"}).Validate(), notify.ErrWebhookURL)
+	require.Error(t, (&Webhook{URL: "http://example.com/", Body: "{{.Stage"}).Validate())
+	require.ErrorIs(t,
+		(&Webhook{URL: "http://example.com/", SuccessCodes: []int{42}}).Validate(),
+		ErrWebhookStatusCode)
+}
+
+func Test_DownActionLoop_Webhooks(t *testing.T) {
+	rec := newWebhookRecorder(t, http.StatusOK)
+	da := &DownAction{
+		After:       time.Millisecond,
+		Webhook:     &Webhook{URL: rec.URL, Body: "{{.Event}} {{.Stage}}"},
+		StopWebhook: &Webhook{URL: rec.URL, Body: "{{.Event}}"},
+	}
+
+	dal := da.Start(t.Context(), nil)
+
+	require.Eventually(t, func() bool {
+		return len(rec.received()) == 1
+	}, time.Second, time.Millisecond, "down webhook should be sent")
+
+	dal.Stop(t.Context())
+
+	reqs := rec.received()
+	require.Len(t, reqs, 2)
+	assert.Equal(t, "down 1", reqs[0].body)
+	assert.Equal(t, "stop", reqs[1].body)
+	assert.Equal(t, "stage 1", dal.ExecutedStage())
+}
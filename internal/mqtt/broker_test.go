@@ -0,0 +1,203 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBroker is a minimal MQTT broker keeping what its clients send.
+type testBroker struct {
+	t        *testing.T
+	listener net.Listener
+	// connackCode is the return code of CONNACK.
+	connackCode byte
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	connects []packet
+	received []Message
+	subs     []string
+	retained map[string]string
+	closed   int
+	wg       sync.WaitGroup
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &testBroker{t: t, listener: listener, retained: make(map[string]string)}
+
+	b.wg.Go(b.accept)
+	t.Cleanup(b.stop)
+
+	return b
+}
+
+func (b *testBroker) url() string {
+	return "mqtt://" + b.listener.Addr().String()
+}
+
+func (b *testBroker) stop() {
+	_ = b.listener.Close()
+	b.dropClients()
+	b.wg.Wait()
+}
+
+// dropClients closes the client connections, as a broker restart would.
+func (b *testBroker) dropClients() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, conn := range b.conns {
+		_ = conn.Close()
+	}
+}
+
+func (b *testBroker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		b.mu.Lock()
+		b.conns = append(b.conns, conn)
+		b.mu.Unlock()
+
+		b.wg.Go(func() { b.serve(conn) })
+	}
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	connect, err := readPacket(reader)
+	if err != nil || connect.kind != packetConnect {
+		return
+	}
+
+	b.mu.Lock()
+	b.connects = append(b.connects, connect)
+	b.mu.Unlock()
+
+	if !b.send(conn, packet{kind: packetConnack, body: []byte{0, b.connackCode}}) || b.connackCode != 0 {
+		return
+	}
+
+	for {
+		p, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+
+		switch p.kind {
+		case packetPublish:
+			msg, _, err := parsePublish(p)
+			assert.NoError(b.t, err)
+
+			b.mu.Lock()
+			b.received = append(b.received, msg)
+			if msg.Retain {
+				b.retained[msg.Topic] = string(msg.Payload)
+			}
+			b.mu.Unlock()
+		case packetSubscribe:
+			topic, _, err := readString(p.body[2:])
+			assert.NoError(b.t, err)
+
+			b.mu.Lock()
+			b.subs = append(b.subs, topic)
+			b.mu.Unlock()
+
+			b.send(conn, packet{kind: packetSuback, body: append(p.body[:2:2], 0)})
+		case packetPingreq:
+			b.send(conn, packet{kind: packetPingresp})
+		case packetDisconnect:
+			b.mu.Lock()
+			b.closed++
+			b.mu.Unlock()
+
+			return
+		}
+	}
+}
+
+func (b *testBroker) send(conn net.Conn, p packet) bool {
+	data, err := p.encode()
+	assert.NoError(b.t, err)
+
+	_, err = conn.Write(data)
+
+	return err == nil
+}
+
+// publish sends msg to the latest client, at QoS 1 with packet id 7 when qos
+// is set.
+func (b *testBroker) publish(msg Message, qos bool) {
+	p := publishPacket(msg)
+	if qos {
+		body := appendString(nil, msg.Topic)
+		body = binary.BigEndian.AppendUint16(body, 7)
+		p = packet{kind: packetPublish, flags: 0x02, body: append(body, msg.Payload...)}
+	}
+
+	b.mu.Lock()
+	conn := b.conns[len(b.conns)-1]
+	b.mu.Unlock()
+
+	b.send(conn, p)
+}
+
+func (b *testBroker) retainedValue(topic string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	value, ok := b.retained[topic]
+
+	return value, ok
+}
+
+func (b *testBroker) messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]Message(nil), b.received...)
+}
+
+func (b *testBroker) connections() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.connects)
+}
+
+func (b *testBroker) subscriptions() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), b.subs...)
+}
+
+func (b *testBroker) disconnects() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.closed
+}
+
+func (b *testBroker) waitFor(cond func() bool) {
+	b.t.Helper()
+	require.Eventually(b.t, cond, 2*time.Second, time.Millisecond)
+}
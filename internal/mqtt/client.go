@@ -0,0 +1,401 @@
+package mqtt
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultKeepAlive is how often the connection is checked when the
+	// options set no interval.
+	DefaultKeepAlive = 30 * time.Second
+	// MaxKeepAlive is the longest interval MQTT can encode.
+	MaxKeepAlive = 65535 * time.Second
+	// DefaultPort and DefaultTLSPort are the broker ports when the broker URL
+	// has none.
+	DefaultPort    = "1883"
+	DefaultTLSPort = "8883"
+	// writeTimeout bounds the write of one packet.
+	writeTimeout = 10 * time.Second
+	// maxStringLen is the longest string MQTT can encode.
+	maxStringLen = 65535
+	// incomingSize is how many received messages may wait to be read.
+	incomingSize = 16
+)
+
+// Connection refused return codes of CONNACK.
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+var (
+	// ErrBrokerURL is returned for a broker that is not an mqtt, mqtts, tcp,
+	// ssl or tls URL with a host.
+	ErrBrokerURL = errors.New("must be an mqtt://, mqtts://, tcp://, ssl:// or tls:// URL")
+	// ErrConnectionRefused is returned when the broker refuses the connection.
+	ErrConnectionRefused = errors.New("connection refused by the broker")
+	// ErrKeepAliveTooLong is returned for a keep alive over MaxKeepAlive.
+	ErrKeepAliveTooLong = errors.New("must be at most 65535s")
+	// ErrPasswordWithoutUsername is returned for a password set without a
+	// username, which MQTT 3.1.1 does not allow.
+	ErrPasswordWithoutUsername = errors.New("requires a username")
+	// ErrStringTooLong is returned for a topic, client ID or credential
+	// longer than MQTT allows.
+	ErrStringTooLong = errors.New("too long for MQTT")
+	// ErrSubscriptionRefused is returned when the broker refuses a
+	// subscription.
+	ErrSubscriptionRefused = errors.New("subscription refused by the broker")
+)
+
+// Message is an application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	// Retain makes the broker keep the message for future subscribers.
+	Retain bool
+}
+
+// Options are the settings of a connection.
+type Options struct {
+	// Broker is the broker URL, such as mqtt://localhost:1883, or
+	// mqtts://broker.example.com for TLS.
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is how often the connection is checked; DefaultKeepAlive
+	// when 0.
+	KeepAlive time.Duration
+	// Will is published by the broker when the connection is lost.
+	Will *Message
+	// TLS configures TLS connections; the default configuration when nil.
+	TLS *tls.Config
+}
+
+func (o Options) keepAlive() time.Duration {
+	return cmp.Or(o.KeepAlive, DefaultKeepAlive)
+}
+
+// address returns the broker address and whether it uses TLS.
+func (o Options) address() (string, bool, error) {
+	broker, err := url.Parse(o.Broker)
+	if err != nil || broker.Hostname() == "" {
+		return "", false, ErrBrokerURL
+	}
+
+	var secure bool
+
+	switch strings.ToLower(broker.Scheme) {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl", "tls":
+		secure = true
+	default:
+		return "", false, ErrBrokerURL
+	}
+
+	port := broker.Port()
+	if port == "" {
+		port = DefaultPort
+		if secure {
+			port = DefaultTLSPort
+		}
+	}
+
+	return net.JoinHostPort(broker.Hostname(), port), secure, nil
+}
+
+// Validate checks that a connection can be attempted with the options.
+func (o Options) Validate() error {
+	if _, _, err := o.address(); err != nil {
+		return fmt.Errorf("broker: %w", err)
+	}
+
+	for name, s := range map[string]string{
+		"clientID": o.ClientID,
+		"username": o.Username,
+		"password": o.Password,
+	} {
+		if len(s) > maxStringLen {
+			return fmt.Errorf("%s: %w", name, ErrStringTooLong)
+		}
+	}
+
+	if o.Password != "" && o.Username == "" {
+		return fmt.Errorf("password: %w", ErrPasswordWithoutUsername)
+	}
+
+	if o.keepAlive() > MaxKeepAlive {
+		return fmt.Errorf("keepAlive: %w", ErrKeepAliveTooLong)
+	}
+
+	if o.Will != nil {
+		return validateTopic(o.Will.Topic)
+	}
+
+	return nil
+}
+
+func validateTopic(topic string) error {
+	if len(topic) > maxStringLen {
+		return fmt.Errorf("topic: %w", ErrStringTooLong)
+	}
+
+	return nil
+}
+
+// Conn is a connection to a broker, publishing and subscribing at QoS 0.
+// Its methods are safe for concurrent use.
+type Conn struct {
+	conn      net.Conn
+	keepAlive time.Duration
+	writeMu   sync.Mutex
+	// nextID numbers subscriptions; guarded by writeMu.
+	nextID   uint16
+	incoming chan Message
+	done     chan struct{}
+	closing  sync.Once
+	// err is why the connection ended, set before incoming is closed.
+	err error
+}
+
+// Dial connects to the broker of opts, returning once the broker accepted
+// the connection.
+func Dial(ctx context.Context, opts Options) (*Conn, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	addr, secure, _ := opts.address()
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if secure {
+		dialer := &tls.Dialer{Config: opts.TLS}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+
+	c := &Conn{
+		conn:      conn,
+		keepAlive: opts.keepAlive(),
+		incoming:  make(chan Message, incomingSize),
+		done:      make(chan struct{}),
+	}
+
+	reader := bufio.NewReader(conn)
+	if err := c.handshake(ctx, reader, opts); err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	go c.read(reader)
+	go c.ping()
+
+	return c, nil
+}
+
+func (c *Conn) handshake(ctx context.Context, reader *bufio.Reader, opts Options) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(c.keepAlive)
+	}
+
+	_ = c.conn.SetDeadline(deadline)
+	defer func() { _ = c.conn.SetDeadline(time.Time{}) }()
+
+	if err := c.write(connectPacket(opts)); err != nil {
+		return err
+	}
+
+	ack, err := readPacket(reader)
+	if err != nil {
+		return err
+	}
+
+	if ack.kind != packetConnack || len(ack.body) != 2 {
+		return ErrMalformedPacket
+	}
+
+	if code := ack.body[1]; code != 0 {
+		return fmt.Errorf("%w: %s", ErrConnectionRefused,
+			cmp.Or(connackErrors[code], fmt.Sprintf("code %d", code)))
+	}
+
+	return nil
+}
+
+// Publish sends msg at QoS 0.
+func (c *Conn) Publish(msg Message) error {
+	if err := validateTopic(msg.Topic); err != nil {
+		return err
+	}
+
+	return c.write(publishPacket(msg))
+}
+
+// Subscribe subscribes to topic at QoS 0; its messages are then received
+// from Messages. A refused subscription ends the connection.
+func (c *Conn) Subscribe(topic string) error {
+	if err := validateTopic(topic); err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.writeMu.Unlock()
+
+	return c.write(subscribePacket(id, topic))
+}
+
+// Messages returns the messages received on subscribed topics. It is
+// closed when the connection ends, after which Err tells why.
+func (c *Conn) Messages() <-chan Message {
+	return c.incoming
+}
+
+// Err returns why the connection ended, once Messages is closed.
+func (c *Conn) Err() error {
+	return c.err
+}
+
+// Close disconnects from the broker: the will is not published.
+func (c *Conn) Close() error {
+	err := c.write(packet{kind: packetDisconnect})
+	c.shutdown()
+
+	return err
+}
+
+func (c *Conn) shutdown() {
+	c.closing.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
+
+func (c *Conn) write(p packet) error {
+	data, err := p.encode()
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	if _, err := c.conn.Write(data); err != nil {
+		c.shutdown()
+
+		return fmt.Errorf("writing MQTT packet: %w", err)
+	}
+
+	return nil
+}
+
+// read receives packets until the connection ends. The broker answers the
+// pings, so a connection silent for longer than the keep-alive is dead.
+func (c *Conn) read(reader *bufio.Reader) {
+	defer close(c.incoming)
+	defer c.shutdown()
+
+	for {
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+
+		p, err := readPacket(reader)
+		if err != nil {
+			c.setErr(err)
+
+			return
+		}
+
+		if err := c.handle(p); err != nil {
+			c.setErr(err)
+
+			return
+		}
+	}
+}
+
+func (c *Conn) setErr(err error) {
+	select {
+	case <-c.done:
+		// Closed on purpose.
+	default:
+		c.err = err
+	}
+}
+
+func (c *Conn) handle(p packet) error {
+	switch p.kind {
+	case packetPublish:
+		msg, id, err := parsePublish(p)
+		if err != nil {
+			return err
+		}
+
+		if id != 0 {
+			if err := c.write(pubackPacket(id)); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case c.incoming <- msg:
+		case <-c.done:
+		}
+	case packetSuback:
+		if len(p.body) < 3 {
+			return ErrMalformedPacket
+		}
+
+		if p.body[2] == subackError {
+			return ErrSubscriptionRefused
+		}
+	case packetPingresp:
+	default:
+		return fmt.Errorf("%w: unexpected type %d", ErrMalformedPacket, p.kind)
+	}
+
+	return nil
+}
+
+func (c *Conn) ping() {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write(packet{kind: packetPingreq}); err != nil {
+				return
+			}
+		}
+	}
+}
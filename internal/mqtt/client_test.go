@@ -0,0 +1,163 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacket_RemainingLength(t *testing.T) {
+	for _, length := range []int{0, 127, 128, 16383, 16384, 2_097_152} {
+		p := packet{kind: packetPublish, flags: flagRetain, body: bytes.Repeat([]byte{'x'}, length)}
+
+		data, err := p.encode()
+		require.NoError(t, err)
+
+		decoded, err := readPacket(bufio.NewReader(bytes.NewReader(data)))
+		require.NoError(t, err)
+		assert.Equal(t, p, decoded, "length %d", length)
+	}
+}
+
+func TestPacket_MalformedLength(t *testing.T) {
+	_, err := readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01})))
+	require.ErrorIs(t, err, ErrMalformedPacket)
+}
+
+func TestPacket_Connect(t *testing.T) {
+	p := connectPacket(Options{
+		ClientID:  "upd",
+		Username:  "user",
+		Password:  "secret",
+		KeepAlive: time.Minute,
+		Will:      &Message{Topic: "upd/status", Payload: []byte("offline"), Retain: true},
+	})
+
+	name, rest, err := readString(p.body)
+	require.NoError(t, err)
+	assert.Equal(t, "MQTT", name)
+	assert.Equal(t, protocolLevel, rest[0])
+	assert.Equal(t, flagUsername|flagPassword|flagWillRetain|flagWill|flagCleanSession, rest[1])
+	assert.Equal(t, []byte{0, 60}, rest[2:4])
+
+	var fields []string
+
+	for rest = rest[4:]; len(rest) > 0; {
+		var field string
+
+		field, rest, err = readString(rest)
+		require.NoError(t, err)
+
+		fields = append(fields, field)
+	}
+
+	assert.Equal(t, []string{"upd", "upd/status", "offline", "user", "secret"}, fields)
+}
+
+func TestOptions_Validate(t *testing.T) {
+	valid := []string{"mqtt://localhost", "tcp://broker:1884", "mqtts://broker", "ssl://[::1]:8883"}
+	for _, broker := range valid {
+		require.NoError(t, Options{Broker: broker}.Validate(), broker)
+	}
+
+	invalid := []string{"", "localhost:1883", "http://broker", "mqtt://", "mqtt://%"}
+	for _, broker := range invalid {
+		require.ErrorIs(t, Options{Broker: broker}.Validate(), ErrBrokerURL, broker)
+	}
+
+	err := Options{Broker: "mqtt://localhost", ClientID: strings.Repeat("x", maxStringLen+1)}.Validate()
+	require.ErrorIs(t, err, ErrStringTooLong)
+
+	err = Options{Broker: "mqtt://localhost", Password: "secret"}.Validate()
+	require.ErrorIs(t, err, ErrPasswordWithoutUsername)
+
+	require.NoError(t, Options{Broker: "mqtt://localhost", KeepAlive: MaxKeepAlive}.Validate())
+
+	err = Options{Broker: "mqtt://localhost", KeepAlive: MaxKeepAlive + time.Second}.Validate()
+	require.ErrorIs(t, err, ErrKeepAliveTooLong)
+}
+
+func TestOptions_DefaultPorts(t *testing.T) {
+	addr, secure, err := Options{Broker: "mqtt://broker"}.address()
+	require.NoError(t, err)
+	assert.Equal(t, "broker:1883", addr)
+	assert.False(t, secure)
+
+	addr, secure, err = Options{Broker: "mqtts://broker"}.address()
+	require.NoError(t, err)
+	assert.Equal(t, "broker:8883", addr)
+	assert.True(t, secure)
+}
+
+func TestDial_PublishAndSubscribe(t *testing.T) {
+	broker := newTestBroker(t)
+
+	conn, err := Dial(t.Context(), Options{Broker: broker.url(), ClientID: "test"})
+	require.NoError(t, err)
+
+	require.NoError(t, conn.Publish(Message{Topic: "upd/connection", Payload: []byte("up"), Retain: true}))
+	require.NoError(t, conn.Subscribe("upd/check"))
+	broker.waitFor(func() bool { return len(broker.subscriptions()) == 1 })
+
+	broker.publish(Message{Topic: "upd/check", Payload: []byte("check")}, false)
+	broker.publish(Message{Topic: "upd/check", Payload: []byte("again")}, true)
+
+	assert.Equal(t, Message{Topic: "upd/check", Payload: []byte("check")}, <-conn.Messages())
+	assert.Equal(t, Message{Topic: "upd/check", Payload: []byte("again")}, <-conn.Messages())
+
+	require.NoError(t, conn.Close())
+	broker.waitFor(func() bool { return broker.disconnects() == 1 })
+
+	value, ok := broker.retainedValue("upd/connection")
+	assert.True(t, ok)
+	assert.Equal(t, "up", value)
+
+	_, open := <-conn.Messages()
+	assert.False(t, open)
+	require.NoError(t, conn.Err(), "closing is not an error")
+}
+
+func TestDial_Refused(t *testing.T) {
+	broker := newTestBroker(t)
+	broker.connackCode = 4
+
+	_, err := Dial(t.Context(), Options{Broker: broker.url()})
+	require.ErrorIs(t, err, ErrConnectionRefused)
+	assert.Contains(t, err.Error(), "bad user name or password")
+}
+
+func TestDial_ConnectionLost(t *testing.T) {
+	broker := newTestBroker(t)
+
+	conn, err := Dial(t.Context(), Options{Broker: broker.url()})
+	require.NoError(t, err)
+
+	broker.dropClients()
+
+	_, open := <-conn.Messages()
+	assert.False(t, open)
+	require.Error(t, conn.Err())
+	_ = conn.Close()
+}
+
+func TestDial_KeepAlive(t *testing.T) {
+	broker := newTestBroker(t)
+
+	conn, err := Dial(t.Context(), Options{Broker: broker.url(), KeepAlive: 20 * time.Millisecond})
+	require.NoError(t, err)
+
+	// The broker answers the pings, so the connection outlives the read
+	// deadline.
+	select {
+	case <-conn.Messages():
+		t.Fatal("connection ended:", conn.Err())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, conn.Close())
+}
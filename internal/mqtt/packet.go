@@ -0,0 +1,222 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types of MQTT 3.1.1.
+const (
+	packetConnect     byte = 1
+	packetConnack     byte = 2
+	packetPublish     byte = 3
+	packetPuback      byte = 4
+	packetSubscribe   byte = 8
+	packetSuback      byte = 9
+	packetPingreq     byte = 12
+	packetPingresp    byte = 13
+	packetDisconnect  byte = 14
+	protocolName           = "MQTT"
+	protocolLevel     byte = 4
+	maxRemainingBytes      = 4
+	maxRemainingLen        = 268_435_455
+)
+
+// Connect flags.
+const (
+	flagCleanSession byte = 0x02
+	flagWill         byte = 0x04
+	flagWillRetain   byte = 0x20
+	flagPassword     byte = 0x40
+	flagUsername     byte = 0x80
+)
+
+// Publish flags.
+const (
+	flagRetain  byte = 0x01
+	maskQoS     byte = 0x06
+	subackError byte = 0x80
+)
+
+var (
+	// ErrMalformedPacket is returned when the broker sends an invalid packet.
+	ErrMalformedPacket = errors.New("malformed MQTT packet")
+	// ErrPacketTooLarge is returned for a packet MQTT cannot carry.
+	ErrPacketTooLarge = errors.New("MQTT packet too large")
+)
+
+// packet is a control packet: its type, the flags of its fixed header, and
+// the rest of it.
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// readPacket reads a control packet.
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, fmt.Errorf("reading MQTT packet: %w", err)
+	}
+
+	length, multiplier := 0, 1
+
+	for i := 0; ; i++ {
+		if i == maxRemainingBytes {
+			return packet{}, ErrMalformedPacket
+		}
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, fmt.Errorf("reading MQTT packet: %w", err)
+		}
+
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, fmt.Errorf("reading MQTT packet: %w", err)
+	}
+
+	return packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// encode returns the packet with its fixed header.
+func (p packet) encode() ([]byte, error) {
+	length := len(p.body)
+	if length > maxRemainingLen {
+		return nil, ErrPacketTooLarge
+	}
+
+	buf := make([]byte, 0, 1+maxRemainingBytes+length)
+	buf = append(buf, p.kind<<4|p.flags)
+
+	for {
+		b := byte(length % 128)
+		length /= 128
+
+		if length > 0 {
+			b |= 0x80
+		}
+
+		buf = append(buf, b)
+
+		if length == 0 {
+			break
+		}
+	}
+
+	return append(buf, p.body...), nil
+}
+
+// appendString appends s with its length, as MQTT encodes strings and binary
+// data.
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s))) //nolint:gosec // lengths checked by validate
+
+	return append(buf, s...)
+}
+
+// readString reads a length-prefixed string from body, returning the rest.
+func readString(body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, ErrMalformedPacket
+	}
+
+	length := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+
+	if len(body) < length {
+		return "", nil, ErrMalformedPacket
+	}
+
+	return string(body[:length]), body[length:], nil
+}
+
+func connectPacket(opts Options) packet {
+	flags := flagCleanSession
+	body := appendString(nil, protocolName)
+	body = append(body, protocolLevel, 0)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.keepAlive().Seconds()))
+	body = appendString(body, opts.ClientID)
+
+	if opts.Will != nil {
+		flags |= flagWill
+		if opts.Will.Retain {
+			flags |= flagWillRetain
+		}
+
+		body = appendString(body, opts.Will.Topic)
+		body = appendString(body, string(opts.Will.Payload))
+	}
+
+	if opts.Username != "" {
+		flags |= flagUsername
+		body = appendString(body, opts.Username)
+	}
+
+	if opts.Password != "" {
+		flags |= flagPassword
+		body = appendString(body, opts.Password)
+	}
+
+	// The flags follow the protocol name and level.
+	body[len(protocolName)+3] = flags
+
+	return packet{kind: packetConnect, body: body}
+}
+
+func publishPacket(msg Message) packet {
+	var flags byte
+	if msg.Retain {
+		flags = flagRetain
+	}
+
+	body := appendString(nil, msg.Topic)
+
+	return packet{kind: packetPublish, flags: flags, body: append(body, msg.Payload...)}
+}
+
+// parsePublish returns the message of a PUBLISH packet, and its packet
+// identifier when it must be acknowledged.
+func parsePublish(p packet) (Message, uint16, error) {
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return Message{}, 0, err
+	}
+
+	var id uint16
+
+	if p.flags&maskQoS != 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, ErrMalformedPacket
+		}
+
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+
+	return Message{Topic: topic, Payload: rest, Retain: p.flags&flagRetain != 0}, id, nil
+}
+
+func subscribePacket(id uint16, topic string) packet {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, topic)
+
+	// SUBSCRIBE has reserved flags 0010; the topic is subscribed at QoS 0.
+	return packet{kind: packetSubscribe, flags: 0x02, body: append(body, 0)}
+}
+
+func pubackPacket(id uint16) packet {
+	return packet{kind: packetPuback, body: binary.BigEndian.AppendUint16(nil, id)}
+}
@@ -0,0 +1,406 @@
+package mqtt
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+	"github.com/hugoh/upd/internal/status"
+	"github.com/hugoh/upd/internal/version"
+)
+
+const (
+	// DefaultTopic prefixes the state topics when the configuration sets
+	// none.
+	DefaultTopic = "upd"
+	// DefaultClientID identifies upd to the broker when the configuration
+	// sets no client ID.
+	DefaultClientID = "upd"
+	// DefaultDiscoveryPrefix is the Home Assistant discovery prefix.
+	DefaultDiscoveryPrefix = "homeassistant"
+	// RetryMin and RetryMax bound the delay between connection attempts.
+	RetryMin = time.Second
+	RetryMax = 5 * time.Minute
+
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+	payloadUp      = "up"
+	payloadDown    = "down"
+	payloadCheck   = "check"
+)
+
+// Config holds the broker connection and the topics of a Publisher.
+type Config struct {
+	Options
+	// Topic prefixes the state topics; DefaultTopic when empty.
+	Topic string
+	// Discovery publishes Home Assistant discovery payloads under
+	// DiscoveryPrefix, DefaultDiscoveryPrefix when empty.
+	Discovery       bool
+	DiscoveryPrefix string
+	// CommandTopic, when set, is subscribed to: any message on it triggers a
+	// check.
+	CommandTopic string
+	// Name is the device name shown in Home Assistant.
+	Name string
+	// Reports are the report periods whose availability is published.
+	Reports []time.Duration
+}
+
+// State is the monitoring state published.
+type State struct {
+	Up bool
+	// Availability is the availability percentage of each report period.
+	Availability []PeriodAvailability
+	// Latency is the median probe latency of the first report period, 0 when
+	// unknown.
+	Latency time.Duration
+	// Iteration counts the down action runs of the current outage.
+	Iteration uint32
+}
+
+// PeriodAvailability is the availability of a report period.
+type PeriodAvailability struct {
+	Period  time.Duration
+	Percent float64
+}
+
+// StateOf returns the state published for report.
+func StateOf(report *status.Report) State {
+	state := State{Up: report.Up}
+
+	for _, stats := range report.Stats {
+		if stats.Availability < 0 {
+			continue
+		}
+
+		state.Availability = append(state.Availability, PeriodAvailability{
+			Period:  time.Duration(stats.Period),
+			Percent: float64(stats.Availability) * status.PercentMultiplier,
+		})
+	}
+
+	if len(report.Stats) > 0 && report.Stats[0].Latency != nil {
+		state.Latency = time.Duration(report.Stats[0].Latency.P50)
+	}
+
+	if report.DownAction != nil {
+		state.Iteration = report.DownAction.Iteration
+	}
+
+	return state
+}
+
+// Publisher keeps the state published on an MQTT broker, with a will
+// marking upd offline. It reconnects as needed.
+type Publisher struct {
+	config  Config
+	recheck func()
+	updates chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+	// mu guards state, the latest one to publish.
+	mu    sync.Mutex
+	state *State
+}
+
+// Start connects to the broker of config in the background. Messages on the
+// command topic call recheck. Stop ends the publisher.
+func Start(config Config, recheck func()) *Publisher {
+	config.Topic = strings.TrimSuffix(cmp.Or(config.Topic, DefaultTopic), "/")
+	config.ClientID = cmp.Or(config.ClientID, DefaultClientID)
+	config.DiscoveryPrefix = strings.TrimSuffix(cmp.Or(config.DiscoveryPrefix, DefaultDiscoveryPrefix), "/")
+	config.Will = &Message{Topic: config.statusTopic(), Payload: []byte(payloadOffline), Retain: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Publisher{
+		config:  config,
+		recheck: recheck,
+		updates: make(chan struct{}, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	go p.run(ctx)
+
+	return p
+}
+
+// Config returns the configuration of the publisher.
+func (p *Publisher) Config() Config {
+	return p.config
+}
+
+// Update publishes state, or once connected. Safe on a nil Publisher.
+func (p *Publisher) Update(state State) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.state = &state
+	p.mu.Unlock()
+
+	select {
+	case p.updates <- struct{}{}:
+	default:
+	}
+}
+
+// Stop marks upd offline and disconnects. Safe on a nil Publisher.
+func (p *Publisher) Stop() {
+	if p == nil {
+		return
+	}
+
+	p.cancel()
+	<-p.done
+}
+
+func (p *Publisher) run(ctx context.Context) {
+	defer close(p.done)
+
+	delay := RetryMin
+
+	for {
+		conn, err := Dial(ctx, p.config.Options)
+		if err == nil {
+			logger.MQTT().Info("connected to the MQTT broker", "broker", p.config.Broker)
+
+			delay = RetryMin
+			err = p.session(ctx, conn)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.MQTT().Warn("MQTT connection failed: will retry",
+			"broker", p.config.Broker, "retryIn", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, RetryMax)
+	}
+}
+
+// session publishes the state on conn until it ends or ctx is canceled.
+func (p *Publisher) session(ctx context.Context, conn *Conn) error {
+	published := make(map[string]string)
+
+	err := p.publishRetained(conn, published, p.config.statusTopic(), payloadOnline)
+	if err == nil && p.config.Discovery {
+		err = p.publishDiscovery(conn)
+	}
+
+	if err == nil && p.config.CommandTopic != "" {
+		err = conn.Subscribe(p.config.CommandTopic)
+	}
+
+	if err == nil {
+		err = p.publishState(conn, published)
+	}
+
+	for err == nil {
+		select {
+		case <-ctx.Done():
+			_ = conn.Publish(Message{
+				Topic: p.config.statusTopic(), Payload: []byte(payloadOffline), Retain: true,
+			})
+			_ = conn.Close()
+
+			return nil
+		case <-p.updates:
+			err = p.publishState(conn, published)
+		case msg, ok := <-conn.Messages():
+			if !ok {
+				return conn.Err()
+			}
+
+			if msg.Topic == p.config.CommandTopic {
+				logger.MQTT().Info("check requested over MQTT")
+				p.recheck()
+			}
+		}
+	}
+
+	_ = conn.Close()
+
+	return err
+}
+
+// publishState publishes the values of the state that changed since they
+// were last published on conn.
+func (p *Publisher) publishState(conn *Conn, published map[string]string) error {
+	p.mu.Lock()
+	state := p.state
+	p.mu.Unlock()
+
+	if state == nil {
+		return nil
+	}
+
+	values := map[string]string{
+		p.config.topic("connection"):           payloadDown,
+		p.config.topic("downaction/iteration"): strconv.FormatUint(uint64(state.Iteration), 10),
+	}
+
+	if state.Up {
+		values[p.config.topic("connection")] = payloadUp
+	}
+
+	if state.Latency > 0 {
+		values[p.config.topic("latency")] = strconv.FormatFloat(
+			float64(state.Latency)/float64(time.Millisecond), 'f', 1, 64)
+	}
+
+	for _, a := range state.Availability {
+		values[p.config.availabilityTopic(a.Period)] = strconv.FormatFloat(a.Percent, 'f', 2, 64)
+	}
+
+	for topic, value := range values {
+		if err := p.publishRetained(conn, published, topic, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publishRetained publishes value on topic unless it was already.
+func (p *Publisher) publishRetained(conn *Conn, published map[string]string, topic, value string) error {
+	if last, ok := published[topic]; ok && last == value {
+		return nil
+	}
+
+	if err := conn.Publish(Message{Topic: topic, Payload: []byte(value), Retain: true}); err != nil {
+		return err
+	}
+
+	published[topic] = value
+
+	return nil
+}
+
+// entity is a Home Assistant MQTT discovery payload.
+type entity struct {
+	component string
+	objectID  string
+	config    map[string]any
+}
+
+// publishDiscovery publishes the Home Assistant discovery payloads, so that
+// the entities appear without configuration.
+func (p *Publisher) publishDiscovery(conn *Conn) error {
+	for _, e := range p.config.entities() {
+		e.config["unique_id"] = p.config.nodeID() + "_" + e.objectID
+		e.config["availability_topic"] = p.config.statusTopic()
+		e.config["device"] = map[string]any{
+			"identifiers":  []string{p.config.nodeID()},
+			"name":         cmp.Or(p.config.Name, "upd"),
+			"manufacturer": "upd",
+			"sw_version":   version.Version(),
+		}
+
+		payload, err := json.Marshal(e.config)
+		if err != nil {
+			return fmt.Errorf("encoding discovery payload: %w", err)
+		}
+
+		topic := strings.Join([]string{
+			p.config.DiscoveryPrefix, e.component, p.config.nodeID(), e.objectID, "config",
+		}, "/")
+
+		if err := conn.Publish(Message{Topic: topic, Payload: payload, Retain: true}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c Config) entities() []entity {
+	entities := []entity{
+		{component: "binary_sensor", objectID: "connection", config: map[string]any{
+			"name":         "Connection",
+			"device_class": "connectivity",
+			"state_topic":  c.topic("connection"),
+			"payload_on":   payloadUp,
+			"payload_off":  payloadDown,
+		}},
+		{component: "sensor", objectID: "latency", config: map[string]any{
+			"name":                "Latency",
+			"device_class":        "duration",
+			"unit_of_measurement": "ms",
+			"state_class":         "measurement",
+			"state_topic":         c.topic("latency"),
+		}},
+		{component: "sensor", objectID: "downaction_iteration", config: map[string]any{
+			"name":        "Down action iteration",
+			"icon":        "mdi:restart",
+			"state_class": "measurement",
+			"state_topic": c.topic("downaction/iteration"),
+		}},
+	}
+
+	for _, period := range c.Reports {
+		label := status.ReadableDuration(period).String()
+		entities = append(entities, entity{
+			component: "sensor",
+			objectID:  "availability_" + label,
+			config: map[string]any{
+				"name":                "Availability " + label,
+				"icon":                "mdi:percent",
+				"unit_of_measurement": "%",
+				"state_class":         "measurement",
+				"state_topic":         c.availabilityTopic(period),
+			},
+		})
+	}
+
+	if c.CommandTopic != "" {
+		entities = append(entities, entity{component: "button", objectID: "check", config: map[string]any{
+			"name":          "Check now",
+			"icon":          "mdi:refresh",
+			"command_topic": c.CommandTopic,
+			"payload_press": payloadCheck,
+		}})
+	}
+
+	return entities
+}
+
+func (c Config) topic(name string) string {
+	return c.Topic + "/" + name
+}
+
+func (c Config) statusTopic() string {
+	return c.topic("status")
+}
+
+func (c Config) availabilityTopic(period time.Duration) string {
+	return c.topic("availability/" + status.ReadableDuration(period).String())
+}
+
+// nodeID identifies upd in discovery topics and unique IDs, which only
+// allow letters, digits, - and _.
+func (c Config) nodeID() string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, c.ClientID)
+}
@@ -0,0 +1,199 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hugoh/upd/internal/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateOf(t *testing.T) {
+	report := &status.Report{
+		Up: true,
+		Stats: []status.ReportByPeriod{
+			{
+				Period:       status.ReadableDuration(time.Hour),
+				Availability: 0.995,
+				Latency:      &status.LatencyReport{P50: status.ReadableLatency(12 * time.Millisecond)},
+			},
+			{Period: status.ReadableDuration(24 * time.Hour), Availability: -1},
+		},
+		DownAction: &status.DownActionStatus{Iteration: 3},
+	}
+
+	state := StateOf(report)
+	assert.True(t, state.Up)
+	require.Len(t, state.Availability, 1, "availability not computed yet is skipped")
+	assert.Equal(t, time.Hour, state.Availability[0].Period)
+	assert.InDelta(t, 99.5, state.Availability[0].Percent, 0.001)
+	assert.Equal(t, 12*time.Millisecond, state.Latency)
+	assert.Equal(t, uint32(3), state.Iteration)
+}
+
+func startPublisher(t *testing.T, broker *testBroker, config Config, recheck func()) *Publisher {
+	t.Helper()
+
+	config.Broker = broker.url()
+	p := Start(config, recheck)
+	t.Cleanup(p.Stop)
+
+	return p
+}
+
+func TestPublisher_PublishesState(t *testing.T) {
+	broker := newTestBroker(t)
+	p := startPublisher(t, broker, Config{Topic: "home/upd/"}, func() {})
+
+	p.Update(State{
+		Availability: []PeriodAvailability{{Period: time.Hour, Percent: 99.5}},
+		Latency:      12500 * time.Microsecond,
+		Iteration:    2,
+	})
+
+	broker.waitFor(func() bool {
+		value, _ := broker.retainedValue("home/upd/downaction/iteration")
+
+		return value == "2"
+	})
+
+	for topic, want := range map[string]string{
+		"home/upd/status":               "online",
+		"home/upd/connection":           "down",
+		"home/upd/latency":              "12.5",
+		"home/upd/availability/1h":      "99.50",
+		"home/upd/downaction/iteration": "2",
+	} {
+		value, ok := broker.retainedValue(topic)
+		assert.True(t, ok, topic)
+		assert.Equal(t, want, value, topic)
+	}
+
+	published := len(broker.messages())
+
+	p.Update(State{
+		Up:           true,
+		Availability: []PeriodAvailability{{Period: time.Hour, Percent: 99.5}},
+		Latency:      12500 * time.Microsecond,
+		Iteration:    2,
+	})
+	broker.waitFor(func() bool {
+		value, _ := broker.retainedValue("home/upd/connection")
+
+		return value == "up"
+	})
+
+	assert.Len(t, broker.messages(), published+1, "only changed values are published")
+
+	p.Stop()
+	broker.waitFor(func() bool { return broker.disconnects() == 1 })
+
+	value, _ := broker.retainedValue("home/upd/status")
+	assert.Equal(t, "offline", value)
+}
+
+func TestPublisher_Will(t *testing.T) {
+	broker := newTestBroker(t)
+	startPublisher(t, broker, Config{Options: Options{ClientID: "lab"}}, func() {})
+
+	broker.waitFor(func() bool { return broker.connections() == 1 })
+
+	broker.mu.Lock()
+	connect := broker.connects[0]
+	broker.mu.Unlock()
+
+	assert.Equal(t, connectPacket(Options{
+		ClientID: "lab",
+		Will:     &Message{Topic: "upd/status", Payload: []byte("offline"), Retain: true},
+	}), connect)
+}
+
+func TestPublisher_Discovery(t *testing.T) {
+	broker := newTestBroker(t)
+	startPublisher(t, broker, Config{
+		Options:      Options{ClientID: "upd.lab"},
+		Discovery:    true,
+		CommandTopic: "upd/check",
+		Name:         "lab",
+		Reports:      []time.Duration{time.Hour, 24 * time.Hour},
+	}, func() {})
+
+	configs := make(map[string]map[string]any)
+
+	broker.waitFor(func() bool {
+		for _, msg := range broker.messages() {
+			var config map[string]any
+			if json.Unmarshal(msg.Payload, &config) == nil {
+				assert.True(t, msg.Retain, msg.Topic)
+				configs[msg.Topic] = config
+			}
+		}
+
+		return len(configs) == 6
+	})
+
+	connection := configs["homeassistant/binary_sensor/upd_lab/connection/config"]
+	require.NotNil(t, connection)
+	assert.Equal(t, "connectivity", connection["device_class"])
+	assert.Equal(t, "upd/connection", connection["state_topic"])
+	assert.Equal(t, "upd/status", connection["availability_topic"])
+	assert.Equal(t, "upd_lab_connection", connection["unique_id"])
+	assert.Equal(t, "lab", connection["device"].(map[string]any)["name"])
+
+	for _, topic := range []string{
+		"homeassistant/sensor/upd_lab/latency/config",
+		"homeassistant/sensor/upd_lab/downaction_iteration/config",
+		"homeassistant/sensor/upd_lab/availability_1h/config",
+		"homeassistant/sensor/upd_lab/availability_24h/config",
+	} {
+		assert.Contains(t, configs, topic)
+	}
+
+	button := configs["homeassistant/button/upd_lab/check/config"]
+	require.NotNil(t, button)
+	assert.Equal(t, "upd/check", button["command_topic"])
+}
+
+func TestPublisher_CommandTopic(t *testing.T) {
+	broker := newTestBroker(t)
+
+	var checks atomic.Int32
+
+	startPublisher(t, broker, Config{CommandTopic: "upd/check"}, func() { checks.Add(1) })
+
+	broker.waitFor(func() bool { return len(broker.subscriptions()) == 1 })
+	assert.Equal(t, []string{"upd/check"}, broker.subscriptions())
+
+	broker.publish(Message{Topic: "upd/check", Payload: []byte("check")}, false)
+	broker.waitFor(func() bool { return checks.Load() == 1 })
+}
+
+func TestPublisher_Reconnects(t *testing.T) {
+	broker := newTestBroker(t)
+	p := startPublisher(t, broker, Config{}, func() {})
+
+	p.Update(State{Up: true})
+	broker.waitFor(func() bool {
+		value, _ := broker.retainedValue("upd/connection")
+
+		return value == "up"
+	})
+
+	broker.dropClients()
+	broker.waitFor(func() bool { return broker.connections() == 2 })
+
+	broker.waitFor(func() bool {
+		count := 0
+
+		for _, msg := range broker.messages() {
+			if msg.Topic == "upd/connection" {
+				count++
+			}
+		}
+
+		return count == 2
+	})
+}
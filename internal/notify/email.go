@@ -0,0 +1,261 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP connection security of email sinks.
+const (
+	// SecurityStartTLS upgrades the connection with STARTTLS, which the
+	// server must support.
+	SecurityStartTLS = "starttls"
+	// SecurityTLS connects with TLS, usually on port 465.
+	SecurityTLS = "tls"
+	// SecurityNone sends in clear text; credentials are then only sent to
+	// localhost.
+	SecurityNone = "none"
+)
+
+var (
+	// ErrEmailServer is returned when an email server is not a host:port
+	// address.
+	ErrEmailServer = errors.New("must be a host:port address")
+	// ErrEmailSecurity is returned for an unknown connection security.
+	ErrEmailSecurity = errors.New("must be one of: starttls, tls, none")
+	// ErrEmailAddress is returned for an invalid sender or recipient.
+	ErrEmailAddress = errors.New("must be an email address")
+	// ErrNoRecipient is returned when an email sink has no recipient.
+	ErrNoRecipient = errors.New("must list at least one recipient")
+	// ErrStartTLSUnsupported is returned when the server cannot upgrade the
+	// connection.
+	ErrStartTLSUnsupported = errors.New("server does not support STARTTLS")
+)
+
+// EmailSink sends the message by email through an SMTP server, with the
+// rendered subject.
+type EmailSink struct {
+	// Server is the host:port of the SMTP server.
+	Server string
+	// Security is SecurityStartTLS when empty.
+	Security string
+	// Username and Password authenticate with PLAIN authentication, when
+	// set.
+	Username string
+	Password string
+	From     string
+	To       []string
+	// TLS configures TLS connections; the default configuration for the
+	// server name when nil.
+	TLS *tls.Config
+}
+
+// Validate checks that messages can be sent.
+func (e *EmailSink) Validate() error {
+	if _, _, err := net.SplitHostPort(e.Server); err != nil {
+		return fmt.Errorf("server: %w", ErrEmailServer)
+	}
+
+	switch e.Security {
+	case "", SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return fmt.Errorf("security: %w", ErrEmailSecurity)
+	}
+
+	if _, err := mail.ParseAddress(e.From); err != nil {
+		return fmt.Errorf("from: %w", ErrEmailAddress)
+	}
+
+	if len(e.To) == 0 {
+		return fmt.Errorf("to: %w", ErrNoRecipient)
+	}
+
+	for i, to := range e.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("to[%d]: %w", i, ErrEmailAddress)
+		}
+	}
+
+	return nil
+}
+
+// Send sends the message to every recipient.
+func (e *EmailSink) Send(ctx context.Context, msg Message) error {
+	data, err := e.compose(msg)
+	if err != nil {
+		return err
+	}
+
+	client, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := e.deliver(client, data); err != nil {
+		return fmt.Errorf("sending email via %s: %w", e.Server, err)
+	}
+
+	return nil
+}
+
+func (e *EmailSink) tlsConfig(host string) *tls.Config {
+	if e.TLS != nil {
+		return e.TLS
+	}
+
+	return &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+}
+
+// dial connects to the server with the security of the sink. The whole
+// exchange is bounded by the deadline of ctx.
+func (e *EmailSink) dial(ctx context.Context) (*smtp.Client, error) {
+	host, _, err := net.SplitHostPort(e.Server)
+	if err != nil {
+		return nil, fmt.Errorf("server: %w", ErrEmailServer)
+	}
+
+	var conn net.Conn
+
+	if e.Security == SecurityTLS {
+		dialer := &tls.Dialer{Config: e.tlsConfig(host)}
+		conn, err = dialer.DialContext(ctx, "tcp", e.Server)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", e.Server)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", e.Server, err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("connecting to %s: %w", e.Server, err)
+	}
+
+	if e.Security == "" || e.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			_ = client.Close()
+
+			return nil, fmt.Errorf("%s: %w", e.Server, ErrStartTLSUnsupported)
+		}
+
+		if err := client.StartTLS(e.tlsConfig(host)); err != nil {
+			_ = client.Close()
+
+			return nil, fmt.Errorf("%s: starting TLS: %w", e.Server, err)
+		}
+	}
+
+	return client, nil
+}
+
+func (e *EmailSink) deliver(client *smtp.Client, data []byte) error {
+	if e.Username != "" {
+		host, _, _ := net.SplitHostPort(e.Server)
+		if err := client.Auth(smtp.PlainAuth("", e.Username, e.Password, host)); err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	if err := client.Mail(address(e.From)); err != nil {
+		return fmt.Errorf("sender: %w", err)
+	}
+
+	for _, to := range e.To {
+		if err := client.Rcpt(address(to)); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("starting message: %w", err)
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("sending message: %w", err)
+	}
+
+	if err := client.Quit(); err != nil {
+		return fmt.Errorf("closing session: %w", err)
+	}
+
+	return nil
+}
+
+// compose returns the message as a plain text email, with the body quoted
+// printable so that long lines and non-ASCII text survive relays.
+func (e *EmailSink) compose(msg Message) ([]byte, error) {
+	date := msg.Event.Time
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+
+	var buf bytes.Buffer
+
+	headers := [][2]string{
+		{"From", e.From},
+		{"To", strings.Join(e.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"Message-ID", "<" + hex.EncodeToString(id) + "@upd>"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+
+	buf.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(msg.Body)); err != nil {
+		return nil, fmt.Errorf("encoding email: %w", err)
+	}
+
+	if err := body.Close(); err != nil {
+		return nil, fmt.Errorf("encoding email: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// address returns the bare address of an address such as
+// "upd <upd@example.com>".
+func address(s string) string {
+	parsed, err := mail.ParseAddress(s)
+	if err != nil {
+		return s
+	}
+
+	return parsed.Address
+}
@@ -0,0 +1,262 @@
+package notify
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpServer is a minimal SMTP server keeping the mail it receives.
+type smtpServer struct {
+	listener net.Listener
+	// tls is the certificate of STARTTLS and TLS connections.
+	tls *tls.Config
+	// implicitTLS accepts TLS connections; startTLS advertises STARTTLS.
+	implicitTLS bool
+	startTLS    bool
+
+	mu     sync.Mutex
+	auth   string
+	from   string
+	to     []string
+	data   string
+	secure bool
+	wg     sync.WaitGroup
+}
+
+// newSMTPServer starts a server, and returns it with the TLS configuration
+// trusting its certificate.
+func newSMTPServer(t *testing.T, implicitTLS, startTLS bool) (*smtpServer, *tls.Config) {
+	t.Helper()
+
+	certServer := httptest.NewTLSServer(nil)
+	certServer.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certServer.Certificate())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &smtpServer{
+		listener:    listener,
+		tls:         &tls.Config{Certificates: certServer.TLS.Certificates, MinVersion: tls.VersionTLS12},
+		implicitTLS: implicitTLS,
+		startTLS:    startTLS,
+		secure:      implicitTLS,
+	}
+
+	s.wg.Go(s.serve)
+	t.Cleanup(func() {
+		_ = listener.Close()
+		s.wg.Wait()
+	})
+
+	return s, &tls.Config{RootCAs: roots, ServerName: "127.0.0.1", MinVersion: tls.VersionTLS12}
+}
+
+func (s *smtpServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tls)
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	reply := func(lines ...string) { _, _ = io.WriteString(conn, strings.Join(lines, "\r\n")+"\r\n") }
+
+	reply("220 test ESMTP")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+
+		s.mu.Lock()
+
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			if s.startTLS && !s.secure {
+				reply("250-test", "250-AUTH PLAIN", "250 STARTTLS")
+			} else {
+				reply("250-test", "250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			reply("220 ready")
+
+			conn = tls.Server(conn, s.tls)
+			reader = bufio.NewReader(conn)
+			s.secure = true
+		case "AUTH":
+			s.auth = arg
+			reply("235 ok")
+		case "MAIL":
+			s.from = arg
+			reply("250 ok")
+		case "RCPT":
+			s.to = append(s.to, arg)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+
+			var data strings.Builder
+
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+
+				data.WriteString(line)
+			}
+
+			s.data = data.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			s.mu.Unlock()
+
+			return
+		default:
+			reply("500 unknown")
+		}
+
+		s.mu.Unlock()
+	}
+}
+
+func (s *smtpServer) received() (string, string, []string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.auth, s.from, s.to, s.data
+}
+
+func (s *smtpServer) tlsUsed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.secure
+}
+
+func TestEmailSink_StartTLS(t *testing.T) {
+	server, tlsConfig := newSMTPServer(t, false, true)
+
+	sink := &EmailSink{
+		Server:   server.listener.Addr().String(),
+		Username: "upd",
+		Password: "secret",
+		From:     "upd <upd@example.com>",
+		To:       []string{"ops@example.com", "Admin <admin@example.com>"},
+		TLS:      tlsConfig,
+	}
+	require.NoError(t, sink.Validate())
+
+	err := sink.Send(t.Context(), Message{
+		Event:   Event{Type: EventUp, Time: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)},
+		Subject: "upd: connection back up — cabin",
+		Body:    "Outage: 10m\nActions: none\n",
+	})
+	require.NoError(t, err)
+
+	auth, from, to, data := server.received()
+	assert.True(t, server.tlsUsed())
+	assert.Equal(t, "PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00upd\x00secret")), auth)
+	assert.Equal(t, "FROM:<upd@example.com>", from)
+	assert.Equal(t, []string{"TO:<ops@example.com>", "TO:<admin@example.com>"}, to)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(data))
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "upd: connection back up — cabin", subject)
+	assert.Equal(t, "Sun, 01 Mar 2026 10:00:00 +0000", parsed.Header.Get("Date"))
+	assert.Equal(t, "ops@example.com, Admin <admin@example.com>", parsed.Header.Get("To"))
+
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "Outage: 10m\r\nActions: none\r\n", string(body))
+}
+
+func TestEmailSink_TLS(t *testing.T) {
+	server, tlsConfig := newSMTPServer(t, true, false)
+
+	sink := &EmailSink{
+		Server:   server.listener.Addr().String(),
+		Security: SecurityTLS,
+		From:     "upd@example.com",
+		To:       []string{"ops@example.com"},
+		TLS:      tlsConfig,
+	}
+
+	require.NoError(t, sink.Send(t.Context(), Message{Subject: "test", Body: "test"}))
+
+	auth, _, to, _ := server.received()
+	assert.Empty(t, auth, "no credentials, no authentication")
+	assert.Equal(t, []string{"TO:<ops@example.com>"}, to)
+}
+
+func TestEmailSink_StartTLSRequired(t *testing.T) {
+	server, tlsConfig := newSMTPServer(t, false, false)
+
+	sink := &EmailSink{
+		Server: server.listener.Addr().String(),
+		From:   "upd@example.com",
+		To:     []string{"ops@example.com"},
+		TLS:    tlsConfig,
+	}
+
+	err := sink.Send(t.Context(), Message{Subject: "test", Body: "test"})
+	require.ErrorIs(t, err, ErrStartTLSUnsupported)
+
+	_, from, _, _ := server.received()
+	assert.Empty(t, from, "nothing is sent in clear text")
+}
+
+func TestEmailSink_Validate(t *testing.T) {
+	valid := EmailSink{Server: "mail:587", From: "upd@example.com", To: []string{"ops@example.com"}}
+	require.NoError(t, valid.Validate())
+
+	tests := []struct {
+		name   string
+		modify func(*EmailSink)
+		want   error
+	}{
+		{"server", func(e *EmailSink) { e.Server = "mail" }, ErrEmailServer},
+		{"security", func(e *EmailSink) { e.Security = "ssl" }, ErrEmailSecurity},
+		{"from", func(e *EmailSink) { e.From = "upd" }, ErrEmailAddress},
+		{"no recipient", func(e *EmailSink) { e.To = nil }, ErrNoRecipient},
+		{"recipient", func(e *EmailSink) { e.To = []string{"ops@example.com\r\nBcc: x@example.com"} }, ErrEmailAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := valid
+			tt.modify(&sink)
+			require.ErrorIs(t, sink.Validate(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,517 @@
+// Package notify sends notifications of connection and down action events to
+// pluggable sinks.
+//
+// A Notifier routes each Event to the sinks whose filter accepts its type,
+// rendering the message for each sink with its own templates. Messages are
+// sent in the background, in event order for each sink, so that a slow sink
+// neither blocks the check loop nor delays the other sinks.
+//
+// Messages that cannot be delivered, typically because the connection is
+// down, are kept in a Queue, on disk when it has a directory, and retried
+// with exponential backoff, then as soon as the connection is back up.
+//
+// Example - Posting outages to a chat webhook:
+//
+//	notifier, err := notify.New(notify.Queue{Dir: "/var/lib/upd/notify"}, notify.Route{
+//		Name:     "chat",
+//		Sink:     &notify.WebhookSink{URL: "https://chat.example.com/hook"},
+//		Events:   []notify.EventType{notify.EventDown, notify.EventUp},
+//		Template: `{"text": {{json .Summary}}}`,
+//	})
+//	notifier.Notify(notify.Event{Type: notify.EventDown, Time: time.Now()})
+//	notifier.Close()
+package notify
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+	"github.com/hugoh/upd/internal/status"
+)
+
+// EventType is the kind of event notified.
+type EventType string
+
+const (
+	// EventDown is sent when the connection goes down.
+	EventDown EventType = "down"
+	// EventUp is sent when the connection comes back up after an outage.
+	EventUp EventType = "up"
+	// EventActionExecuted is sent when a down or stop action succeeded.
+	EventActionExecuted EventType = "actionExecuted"
+	// EventActionFailed is sent when a down or stop action failed.
+	EventActionFailed EventType = "actionFailed"
+	// EventConfigReloaded is sent when the configuration was reloaded.
+	EventConfigReloaded EventType = "configReloaded"
+	// EventDigest is sent on schedule with a summary of the past period.
+	EventDigest EventType = "digest"
+)
+
+const (
+	// DefaultTemplate renders message bodies when a route sets none.
+	DefaultTemplate = "{{.Summary}}{{with .Details}}\n\n{{.}}{{end}}"
+	// DefaultSubject renders message subjects when a route sets none.
+	DefaultSubject = "upd: {{.Summary}}"
+	// DefaultTimeout bounds the delivery of one message when a route sets
+	// none.
+	DefaultTimeout = 30 * time.Second
+	// QueueSize is how many events may wait for a sink before new ones are
+	// dropped.
+	QueueSize = 32
+)
+
+// ErrUnknownEvent is returned for an event type that does not exist.
+var ErrUnknownEvent = errors.New(
+	"must be one of: down, up, actionExecuted, actionFailed, configReloaded, digest")
+
+// ParseEventType returns the event type named s.
+func ParseEventType(s string) (EventType, error) {
+	switch t := EventType(s); t {
+	case EventDown, EventUp, EventActionExecuted, EventActionFailed, EventConfigReloaded, EventDigest:
+		return t, nil
+	default:
+		return "", fmt.Errorf("%q: %w", s, ErrUnknownEvent)
+	}
+}
+
+// Event is a structured notification, also available to message templates.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Name is the configured group or host name.
+	Name string `json:"name,omitempty"`
+	// Maintenance is the maintenance window in effect, if any.
+	Maintenance string `json:"maintenance,omitempty"`
+	// Failure is the most frequent failure class of the outage.
+	Failure string `json:"failure,omitempty"`
+	// Diagnosis is the network layer the outage was attributed to, once
+	// diagnosed.
+	Diagnosis string `json:"diagnosis,omitempty"`
+	// OutageStart is when the connection went down, for EventUp; Time is
+	// when it came back.
+	OutageStart time.Time `json:"outageStart,omitzero"`
+	// Duration is how long the connection was down, for EventUp.
+	Duration time.Duration `json:"duration,omitempty"`
+	// FixedBy is the last down action stage that ran before EventUp, if any.
+	FixedBy string `json:"fixedBy,omitempty"`
+	// Actions are the down actions run during the outage, for EventUp.
+	Actions []Action `json:"actions,omitempty"`
+	// FailedProbes are the probe targets that failed during the outage, for
+	// EventDown and EventUp.
+	FailedProbes []Probe `json:"failedProbes,omitempty"`
+	// Availability is the availability of each report period, for EventUp
+	// and EventDigest.
+	Availability []Availability `json:"availability,omitempty"`
+	// Period is how far back EventDigest looks, and Outages the outages
+	// within it, newest first. OutagesTruncated is set when older outages of
+	// the period are no longer recorded.
+	Period           time.Duration `json:"period,omitempty"`
+	Outages          []Outage      `json:"outages,omitempty"`
+	OutagesTruncated bool          `json:"outagesTruncated,omitempty"`
+	// Trigger is the down action event of action events: down or stop.
+	Trigger string `json:"trigger,omitempty"`
+	// Action is the command, webhook or power cycle of action events.
+	Action    string `json:"action,omitempty"`
+	Stage     int    `json:"stage,omitempty"`
+	Iteration uint32 `json:"iteration,omitempty"`
+	ExitCode  int    `json:"exitCode,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// DryRun marks actions that were only logged.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// Action is a down action run during an outage.
+type Action struct {
+	Time   time.Time `json:"time"`
+	Stage  int       `json:"stage"`
+	Action string    `json:"action"`
+	// Error is set when the action failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Probe is a probe target that failed, with its latest error.
+type Probe struct {
+	Target string `json:"target"`
+	Error  string `json:"error"`
+}
+
+// Availability is the availability of a report period, in percent.
+type Availability struct {
+	Period  time.Duration `json:"period"`
+	Percent float64       `json:"percent"`
+}
+
+// Outage is a past outage. End is zero while it is in progress.
+type Outage struct {
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end,omitzero"`
+	Duration  time.Duration `json:"duration"`
+	FixedBy   string        `json:"fixedBy,omitempty"`
+	Diagnosis string        `json:"diagnosis,omitempty"`
+}
+
+// Summary describes the event in one line.
+func (e Event) Summary() string {
+	var summary string
+
+	switch e.Type {
+	case EventDown:
+		summary = "connection down"
+		if e.Failure != "" {
+			summary += " (" + e.Failure + ")"
+		}
+	case EventUp:
+		summary = "connection back up after " + e.Duration.Round(time.Second).String()
+		if e.FixedBy != "" {
+			summary += ", fixed by " + e.FixedBy
+		}
+	case EventActionExecuted:
+		summary = e.Trigger + " action ran: " + e.Action
+	case EventActionFailed:
+		summary = e.Trigger + " action failed: " + e.Action
+		if e.Error != "" {
+			summary += ": " + e.Error
+		} else {
+			summary += fmt.Sprintf(": exit code %d", e.ExitCode)
+		}
+	case EventConfigReloaded:
+		summary = "configuration reloaded"
+	case EventDigest:
+		outages := countOutages(len(e.Outages))
+		if e.OutagesTruncated {
+			outages = "at least " + outages
+		}
+
+		summary = fmt.Sprintf("digest of the last %s: %s", status.ReadableDuration(e.Period), outages)
+	default:
+		summary = string(e.Type)
+	}
+
+	if e.DryRun {
+		summary += " (dry run)"
+	}
+
+	if e.Name != "" {
+		summary = e.Name + ": " + summary
+	}
+
+	return summary
+}
+
+// Details describes the event over several lines: for EventUp, when the
+// outage started and ended, its diagnosis, the probes that failed, the
+// actions taken and the availability; for EventDigest, the availability and
+// the outages. It is empty for other events.
+func (e Event) Details() string {
+	var details strings.Builder
+
+	switch {
+	case e.Type == EventUp && !e.OutageStart.IsZero():
+		fmt.Fprintf(&details, "Outage: %s to %s (%s)\n",
+			e.OutageStart.Format(time.RFC3339), e.Time.Format(time.RFC3339),
+			e.Duration.Round(time.Second))
+
+		if e.Diagnosis != "" {
+			fmt.Fprintf(&details, "Diagnosis: %s\n", e.Diagnosis)
+		}
+
+		e.writeFailedProbes(&details)
+		e.writeActions(&details)
+		e.writeAvailability(&details)
+	case e.Type == EventDigest:
+		e.writeAvailability(&details)
+		e.writeOutages(&details)
+	}
+
+	return details.String()
+}
+
+func (e Event) writeFailedProbes(details *strings.Builder) {
+	if len(e.FailedProbes) == 0 {
+		return
+	}
+
+	details.WriteString("Failed probes:\n")
+
+	for _, p := range e.FailedProbes {
+		fmt.Fprintf(details, "- %s: %s\n", p.Target, p.Error)
+	}
+}
+
+func (e Event) writeActions(details *strings.Builder) {
+	if len(e.Actions) == 0 {
+		details.WriteString("Actions: none\n")
+
+		return
+	}
+
+	details.WriteString("Actions:\n")
+
+	for _, a := range e.Actions {
+		fmt.Fprintf(details, "- %s stage %d: %s", a.Time.Format(time.RFC3339), a.Stage, a.Action)
+
+		if a.Error != "" {
+			fmt.Fprintf(details, " (failed: %s)", a.Error)
+		}
+
+		details.WriteString("\n")
+	}
+}
+
+func (e Event) writeAvailability(details *strings.Builder) {
+	if len(e.Availability) == 0 {
+		return
+	}
+
+	details.WriteString("Availability:\n")
+
+	for _, a := range e.Availability {
+		fmt.Fprintf(details, "- %s: %.2f%%\n", status.ReadableDuration(a.Period), a.Percent)
+	}
+}
+
+func (e Event) writeOutages(details *strings.Builder) {
+	if len(e.Outages) == 0 {
+		details.WriteString("Outages: none\n")
+
+		return
+	}
+
+	details.WriteString("Outages:\n")
+
+	if e.OutagesTruncated {
+		details.WriteString("(older outages are no longer recorded)\n")
+	}
+
+	for _, o := range e.Outages {
+		end := "ongoing"
+		if !o.End.IsZero() {
+			end = o.End.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(details, "- %s to %s (%s)", o.Start.Format(time.RFC3339), end, o.Duration.Round(time.Second))
+
+		if o.Diagnosis != "" {
+			fmt.Fprintf(details, ", %s", o.Diagnosis)
+		}
+
+		if o.FixedBy != "" {
+			fmt.Fprintf(details, ", fixed by %s", o.FixedBy)
+		}
+
+		details.WriteString("\n")
+	}
+}
+
+func countOutages(n int) string {
+	switch n {
+	case 0:
+		return "no outage"
+	case 1:
+		return "1 outage"
+	default:
+		return fmt.Sprintf("%d outages", n)
+	}
+}
+
+// Message is a rendered notification.
+type Message struct {
+	Event   Event  `json:"event"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
+}
+
+// Sink delivers messages, such as to a chat webhook or a command.
+type Sink interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Route sends the events it accepts to a sink.
+type Route struct {
+	// Name identifies the sink in logs.
+	Name string
+	Sink Sink
+	// Events are the event types sent to the sink, all when empty.
+	Events []EventType
+	// Template is a text/template rendering the message body with the
+	// Event; DefaultTemplate when empty.
+	Template string
+	// Subject is a text/template rendering the message subject, for sinks
+	// that have one; DefaultSubject when empty.
+	Subject string
+	// Timeout bounds the delivery of one message; DefaultTimeout when 0.
+	Timeout time.Duration
+}
+
+type route struct {
+	Route
+
+	body    *template.Template
+	subject *template.Template
+	queue   chan Event
+	pending *pendingQueue
+}
+
+// Notifier routes events to sinks.
+type Notifier struct {
+	routes []*route
+	// mu guards closed, so that no event is queued once the queues are
+	// closed.
+	mu      sync.RWMutex
+	closed  bool
+	senders sync.WaitGroup
+}
+
+// ParseTemplate parses a message template. Besides the Event fields and
+// Summary and Details, templates can use json to quote a value for JSON
+// documents.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{"json": toJSON}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+func toJSON(v any) (string, error) {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encoding JSON: %w", err)
+	}
+
+	return string(doc), nil
+}
+
+// New parses the templates of the routes and starts sending to their sinks,
+// with the messages that could not be delivered kept in queue. Close stops
+// the notifier.
+func New(queue Queue, routes ...Route) (*Notifier, error) {
+	parsed := make([]*route, 0, len(routes))
+
+	for _, r := range routes {
+		body, err := ParseTemplate("body", cmp.Or(r.Template, DefaultTemplate))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+
+		subject, err := ParseTemplate("subject", cmp.Or(r.Subject, DefaultSubject))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+
+		pending, err := queue.open(r.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+
+		parsed = append(parsed, &route{
+			Route:   r,
+			body:    body,
+			subject: subject,
+			queue:   make(chan Event, QueueSize),
+			pending: pending,
+		})
+	}
+
+	n := &Notifier{routes: parsed}
+
+	for _, r := range n.routes {
+		n.senders.Go(r.run)
+	}
+
+	return n, nil
+}
+
+// Notify queues ev for the sinks that accept it. EventUp also retries the
+// pending messages of every sink. Safe on a nil Notifier.
+func (n *Notifier) Notify(ev Event) {
+	if n == nil {
+		return
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.closed {
+		return
+	}
+
+	for _, r := range n.routes {
+		// Every route sees EventUp, to retry its pending messages.
+		if !r.accepts(ev.Type) && ev.Type != EventUp {
+			continue
+		}
+
+		select {
+		case r.queue <- ev:
+		default:
+			logger.Notify().Warn("notification queue full: dropping event",
+				"sink", r.Name, "event", ev.Type)
+		}
+	}
+}
+
+// Close tries to send the queued events, then stops the notifier; messages
+// still pending are delivered after a restart when the queue has a
+// directory. Safe on a nil Notifier.
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+
+		for _, r := range n.routes {
+			close(r.queue)
+		}
+	}
+	n.mu.Unlock()
+
+	n.senders.Wait()
+}
+
+func (r *route) accepts(t EventType) bool {
+	return len(r.Events) == 0 || slices.Contains(r.Events, t)
+}
+
+func (r *route) send(msg Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(r.Timeout, DefaultTimeout))
+	defer cancel()
+
+	if err := r.Sink.Send(ctx, msg); err != nil {
+		return fmt.Errorf("sending notification: %w", err)
+	}
+
+	return nil
+}
+
+func (r *route) render(ev Event) (Message, error) {
+	var body, subject bytes.Buffer
+
+	if err := r.body.Execute(&body, ev); err != nil {
+		return Message{}, fmt.Errorf("rendering body: %w", err)
+	}
+
+	if err := r.subject.Execute(&subject, ev); err != nil {
+		return Message{}, fmt.Errorf("rendering subject: %w", err)
+	}
+
+	return Message{
+		Event:   ev,
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    body.String(),
+	}, nil
+}
@@ -0,0 +1,289 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errSinkDown = errors.New("sink down")
+
+// recordingSink keeps the messages it receives, after failing the first
+// failures ones.
+type recordingSink struct {
+	mu       sync.Mutex
+	messages []Message
+	failures int
+	block    chan struct{}
+}
+
+func (s *recordingSink) Send(ctx context.Context, msg Message) error {
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+
+		return errSinkDown
+	}
+
+	s.messages = append(s.messages, msg)
+
+	return nil
+}
+
+func (s *recordingSink) setFailures(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = n
+}
+
+func (s *recordingSink) received() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+func TestParseEventType(t *testing.T) {
+	for _, name := range []string{"down", "up", "actionExecuted", "actionFailed", "configReloaded"} {
+		typ, err := ParseEventType(name)
+		require.NoError(t, err)
+		assert.Equal(t, EventType(name), typ)
+	}
+
+	_, err := ParseEventType("sideways")
+	require.ErrorIs(t, err, ErrUnknownEvent)
+}
+
+func TestEvent_Summary(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{Type: EventDown, Name: "home", Failure: "dns"}, "home: connection down (dns)"},
+		{Event{Type: EventUp, Duration: 90*time.Second + 300*time.Millisecond, FixedBy: "stage 1"},
+			"connection back up after 1m30s, fixed by stage 1"},
+		{Event{Type: EventActionExecuted, Trigger: "down", Action: "reboot", DryRun: true},
+			"down action ran: reboot (dry run)"},
+		{Event{Type: EventActionFailed, Trigger: "stop", Action: "notify-up", ExitCode: 2},
+			"stop action failed: notify-up: exit code 2"},
+		{Event{Type: EventActionFailed, Trigger: "down", Action: "GET http://plug", Error: "timeout"},
+			"down action failed: GET http://plug: timeout"},
+		{Event{Type: EventConfigReloaded}, "configuration reloaded"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.event.Summary())
+	}
+}
+
+func TestEvent_Details(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	ev := Event{
+		Type:        EventUp,
+		Time:        start.Add(10 * time.Minute),
+		OutageStart: start,
+		Duration:    10 * time.Minute,
+		Diagnosis:   "isp",
+		FailedProbes: []Probe{
+			{Target: "1.1.1.1:53", Error: "i/o timeout"},
+		},
+		Actions: []Action{
+			{Time: start.Add(time.Minute), Stage: 1, Action: "reboot-modem"},
+			{Time: start.Add(6 * time.Minute), Stage: 2, Action: "GET http://plug", Error: "timeout"},
+		},
+		Availability: []Availability{
+			{Period: time.Hour, Percent: 83.333},
+			{Period: 24 * time.Hour, Percent: 99.3},
+		},
+	}
+
+	assert.Equal(t, `Outage: 2026-03-01T10:00:00Z to 2026-03-01T10:10:00Z (10m0s)
+Diagnosis: isp
+Failed probes:
+- 1.1.1.1:53: i/o timeout
+Actions:
+- 2026-03-01T10:01:00Z stage 1: reboot-modem
+- 2026-03-01T10:06:00Z stage 2: GET http://plug (failed: timeout)
+Availability:
+- 1h: 83.33%
+- 24h: 99.30%
+`, ev.Details())
+
+	ev.Actions = nil
+	assert.Contains(t, ev.Details(), "Actions: none")
+
+	assert.Empty(t, Event{Type: EventDown, OutageStart: start}.Details())
+}
+
+func TestEvent_Digest(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	ev := Event{
+		Type:         EventDigest,
+		Name:         "cabin",
+		Period:       7 * 24 * time.Hour,
+		Availability: []Availability{{Period: 24 * time.Hour, Percent: 100}},
+		Outages: []Outage{
+			{Start: start.Add(time.Hour), Duration: 5 * time.Minute},
+			{
+				Start: start, End: start.Add(10 * time.Minute), Duration: 10 * time.Minute,
+				FixedBy: "stage 1", Diagnosis: "isp",
+			},
+		},
+	}
+
+	assert.Equal(t, "cabin: digest of the last 168h: 2 outages", ev.Summary())
+	assert.Equal(t, `Availability:
+- 24h: 100.00%
+Outages:
+- 2026-03-01T11:00:00Z to ongoing (5m0s)
+- 2026-03-01T10:00:00Z to 2026-03-01T10:10:00Z (10m0s), isp, fixed by stage 1
+`, ev.Details())
+
+	ev.OutagesTruncated = true
+	assert.Equal(t, "cabin: digest of the last 168h: at least 2 outages", ev.Summary())
+	assert.Contains(t, ev.Details(), "Outages:\n(older outages are no longer recorded)\n- 2026-03-01T11:00:00Z")
+
+	ev.Outages, ev.OutagesTruncated = nil, false
+	assert.Equal(t, "cabin: digest of the last 168h: no outage", ev.Summary())
+	assert.Contains(t, ev.Details(), "Outages: none")
+}
+
+func TestNotifier_RoutesByEventType(t *testing.T) {
+	all := &recordingSink{}
+	outages := &recordingSink{}
+
+	notifier, err := New(
+		Queue{},
+		Route{Name: "all", Sink: all},
+		Route{Name: "outages", Sink: outages, Events: []EventType{EventDown, EventUp}},
+	)
+	require.NoError(t, err)
+
+	notifier.Notify(Event{Type: EventDown})
+	notifier.Notify(Event{Type: EventConfigReloaded})
+	notifier.Notify(Event{Type: EventUp})
+	notifier.Close()
+
+	var allTypes, outageTypes []EventType
+	for _, msg := range all.received() {
+		allTypes = append(allTypes, msg.Event.Type)
+	}
+
+	for _, msg := range outages.received() {
+		outageTypes = append(outageTypes, msg.Event.Type)
+	}
+
+	assert.Equal(t, []EventType{EventDown, EventConfigReloaded, EventUp}, allTypes, "in event order")
+	assert.Equal(t, []EventType{EventDown, EventUp}, outageTypes)
+}
+
+func TestNotifier_Templates(t *testing.T) {
+	sink := &recordingSink{}
+
+	notifier, err := New(
+		Queue{},
+		Route{Name: "default", Sink: sink},
+		Route{
+			Name:     "custom",
+			Sink:     sink,
+			Template: `{"text": {{json .Summary}}, "type": "{{.Type}}"}`,
+			Subject:  "[{{.Name}}] {{.Type}}",
+		},
+	)
+	require.NoError(t, err)
+
+	notifier.Notify(Event{Type: EventDown, Name: `the "lab"`})
+	notifier.Close()
+
+	messages := sink.received()
+	require.Len(t, messages, 2)
+
+	bodies := map[string]string{}
+	for _, msg := range messages {
+		bodies[msg.Subject] = msg.Body
+	}
+
+	assert.Equal(t, `the "lab": connection down`, bodies[`upd: the "lab": connection down`])
+	assert.JSONEq(t, `{"text": "the \"lab\": connection down", "type": "down"}`,
+		bodies[`[the "lab"] down`])
+}
+
+func TestNew_InvalidTemplate(t *testing.T) {
+	_, err := New(Queue{}, Route{Name: "broken", Sink: &recordingSink{}, Template: "{{.Summary"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken: invalid template")
+}
+
+func TestNotifier_SlowSinkDoesNotBlock(t *testing.T) {
+	slow := &recordingSink{block: make(chan struct{})}
+	fast := &recordingSink{}
+
+	notifier, err := New(
+		Queue{},
+		Route{Name: "slow", Sink: slow},
+		Route{Name: "fast", Sink: fast},
+	)
+	require.NoError(t, err)
+
+	notifier.Notify(Event{Type: EventDown})
+	notifier.Notify(Event{Type: EventUp})
+
+	require.Eventually(t, func() bool {
+		return len(fast.received()) == 2
+	}, time.Second, time.Millisecond, "the fast sink should not wait for the slow one")
+
+	close(slow.block)
+	notifier.Close()
+
+	assert.Len(t, slow.received(), 2)
+}
+
+func TestNotifier_DropsWhenQueueFull(t *testing.T) {
+	slow := &recordingSink{block: make(chan struct{})}
+
+	notifier, err := New(Queue{}, Route{Name: "slow", Sink: slow})
+	require.NoError(t, err)
+
+	for range QueueSize + 5 {
+		notifier.Notify(Event{Type: EventDown})
+	}
+
+	close(slow.block)
+	notifier.Close()
+
+	// One event being sent, plus a full queue.
+	assert.LessOrEqual(t, len(slow.received()), QueueSize+1)
+	assert.GreaterOrEqual(t, len(slow.received()), QueueSize)
+}
+
+func TestNotifier_NilAndClosed(t *testing.T) {
+	var nilNotifier *Notifier
+	nilNotifier.Notify(Event{Type: EventDown})
+	nilNotifier.Close()
+
+	sink := &recordingSink{}
+	notifier, err := New(Queue{}, Route{Name: "sink", Sink: sink})
+	require.NoError(t, err)
+
+	notifier.Close()
+	notifier.Close()
+	notifier.Notify(Event{Type: EventDown})
+
+	assert.Empty(t, sink.received())
+}
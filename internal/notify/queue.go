@@ -0,0 +1,325 @@
+package notify
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hugoh/upd/internal/logger"
+)
+
+const (
+	// DefaultMaxAge is how long undelivered messages are retried when the
+	// queue sets no limit.
+	DefaultMaxAge = 7 * 24 * time.Hour
+	// DefaultRetryMin is the first retry delay when the queue sets none.
+	DefaultRetryMin = 30 * time.Second
+	// DefaultRetryMax caps the retry delay when the queue sets no cap.
+	DefaultRetryMax = 30 * time.Minute
+	// DefaultMaxPending is how many undelivered messages are kept per sink
+	// when the queue sets no limit; the oldest ones are dropped first.
+	DefaultMaxPending = 1000
+
+	pendingExt = ".json"
+)
+
+// Queue keeps the messages that could not be delivered until they can be.
+type Queue struct {
+	// Dir stores the pending messages of each sink in a subdirectory, so
+	// that they survive restarts. They are only kept in memory when empty.
+	Dir string
+	// MaxAge is how long messages are retried; DefaultMaxAge when 0.
+	MaxAge time.Duration
+	// RetryMin is the first retry delay, doubled after each failure up to
+	// RetryMax; DefaultRetryMin and DefaultRetryMax when 0.
+	RetryMin time.Duration
+	RetryMax time.Duration
+	// MaxPending caps the pending messages of each sink; DefaultMaxPending
+	// when 0.
+	MaxPending int
+}
+
+// pendingMessage is a message waiting to be delivered, as stored on disk.
+type pendingMessage struct {
+	Message  Message   `json:"message"`
+	Queued   time.Time `json:"queued"`
+	Attempts int       `json:"attempts"`
+	file     string
+}
+
+// pendingQueue holds the pending messages of a sink, oldest first. Only used
+// by the goroutine of the route.
+type pendingQueue struct {
+	Queue
+
+	// dir is the directory of the sink, empty when kept in memory.
+	dir      string
+	messages []*pendingMessage
+	seq      uint64
+}
+
+// open returns the pending messages of the sink name, loading those stored
+// by a previous run.
+func (q Queue) open(name string) (*pendingQueue, error) {
+	pending := &pendingQueue{Queue: q}
+	if q.Dir == "" {
+		return pending, nil
+	}
+
+	pending.dir = filepath.Join(q.Dir, fileName(name))
+
+	if err := os.MkdirAll(pending.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating queue directory: %w", err)
+	}
+
+	if err := pending.load(); err != nil {
+		return nil, err
+	}
+
+	if len(pending.messages) > 0 {
+		logger.Notify().Info("undelivered notifications found",
+			"sink", name, "count", len(pending.messages))
+	}
+
+	return pending, nil
+}
+
+// fileName turns a sink name into a directory name.
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+func (p *pendingQueue) load() error {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return fmt.Errorf("reading queue directory: %w", err)
+	}
+
+	// Names start with the time they were queued.
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != pendingExt {
+			continue
+		}
+
+		file := filepath.Join(p.dir, entry.Name())
+
+		msg, err := readPending(file)
+		if err != nil {
+			logger.Notify().Warn("dropping unreadable notification", "file", file, "error", err)
+			_ = os.Remove(file)
+
+			continue
+		}
+
+		p.messages = append(p.messages, msg)
+	}
+
+	return nil
+}
+
+func readPending(file string) (*pendingMessage, error) {
+	data, err := os.ReadFile(file) // #nosec G304 -- file in the queue directory
+	if err != nil {
+		return nil, fmt.Errorf("reading notification: %w", err)
+	}
+
+	var msg pendingMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("decoding notification: %w", err)
+	}
+
+	msg.file = file
+
+	return &msg, nil
+}
+
+// push adds a message, dropping the oldest one when the queue is full.
+func (p *pendingQueue) push(msg Message, now time.Time) {
+	if len(p.messages) >= cmp.Or(p.MaxPending, DefaultMaxPending) {
+		logger.Notify().Warn("too many undelivered notifications: dropping the oldest",
+			"event", p.messages[0].Message.Event.Type)
+		p.pop()
+	}
+
+	pending := &pendingMessage{Message: msg, Queued: now}
+
+	if p.dir != "" {
+		p.seq++
+		pending.file = filepath.Join(p.dir,
+			fmt.Sprintf("%020d-%06d%s", now.UnixNano(), p.seq%1_000_000, pendingExt))
+		p.save(pending)
+	}
+
+	p.messages = append(p.messages, pending)
+}
+
+// front returns the oldest message, nil when none is pending.
+func (p *pendingQueue) front() *pendingMessage {
+	if len(p.messages) == 0 {
+		return nil
+	}
+
+	return p.messages[0]
+}
+
+// pop removes the oldest message.
+func (p *pendingQueue) pop() {
+	msg := p.messages[0]
+	p.messages = slices.Delete(p.messages, 0, 1)
+
+	if msg.file != "" {
+		if err := os.Remove(msg.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Notify().Warn("cannot remove delivered notification", "file", msg.file, "error", err)
+		}
+	}
+}
+
+// failed records a failed delivery of msg and returns when to retry.
+func (p *pendingQueue) failed(msg *pendingMessage) time.Duration {
+	msg.Attempts++
+	p.save(msg)
+
+	delay := cmp.Or(p.RetryMin, DefaultRetryMin)
+	limit := cmp.Or(p.RetryMax, DefaultRetryMax)
+
+	for range msg.Attempts - 1 {
+		if delay >= limit/2 {
+			return limit
+		}
+
+		delay *= 2
+	}
+
+	return min(delay, limit)
+}
+
+// expired reports whether msg is too old to be delivered.
+func (p *pendingQueue) expired(msg *pendingMessage, now time.Time) bool {
+	return now.Sub(msg.Queued) > cmp.Or(p.MaxAge, DefaultMaxAge)
+}
+
+// save writes msg to its file, if any. Failures are logged: the message is
+// still delivered, unless upd restarts first.
+func (p *pendingQueue) save(msg *pendingMessage) {
+	if msg.file == "" {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err == nil {
+		tmp := msg.file + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, msg.file)
+		}
+	}
+
+	if err != nil {
+		logger.Notify().Warn("cannot store notification", "file", msg.file, "error", err)
+	}
+}
+
+// run delivers the events of the route in order. Once a delivery fails, the
+// following messages wait for it to succeed, on retry or once the connection
+// is back up.
+func (r *route) run() {
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+
+	for {
+		select {
+		case ev, ok := <-r.queue:
+			if !ok {
+				r.stop()
+
+				return
+			}
+
+			backlog := r.pending.front() != nil
+
+			if r.accepts(ev.Type) {
+				r.queueEvent(ev)
+			}
+
+			// The connection coming back is the time to retry.
+			if !backlog || ev.Type == EventUp {
+				r.deliver(retry)
+			}
+		case <-retry.C:
+			r.deliver(retry)
+		}
+	}
+}
+
+// queueEvent renders ev and adds it to the pending messages.
+func (r *route) queueEvent(ev Event) {
+	msg, err := r.render(ev)
+	if err != nil {
+		logger.Notify().Error("cannot render notification",
+			"sink", r.Name, "event", ev.Type, "error", err)
+
+		return
+	}
+
+	r.pending.push(msg, time.Now())
+}
+
+// deliver sends the pending messages until one fails, which is retried after
+// a backoff delay.
+func (r *route) deliver(retry *time.Timer) {
+	for msg := r.pending.front(); msg != nil; msg = r.pending.front() {
+		if r.pending.expired(msg, time.Now()) {
+			logger.Notify().Warn("notification expired: dropping it",
+				"sink", r.Name, "event", msg.Message.Event.Type, "queued", msg.Queued)
+			r.pending.pop()
+
+			continue
+		}
+
+		if err := r.send(msg.Message); err != nil {
+			delay := r.pending.failed(msg)
+			retry.Reset(delay)
+
+			logger.Notify().Warn("cannot send notification: will retry",
+				"sink", r.Name, "event", msg.Message.Event.Type,
+				"attempts", msg.Attempts, "retryIn", delay, "error", err)
+
+			return
+		}
+
+		if msg.Attempts > 0 {
+			logger.Notify().Info("delayed notification sent",
+				"sink", r.Name, "event", msg.Message.Event.Type, "queued", msg.Queued)
+		} else {
+			logger.Notify().Debug("notification sent", "sink", r.Name, "event", msg.Message.Event.Type)
+		}
+
+		r.pending.pop()
+	}
+}
+
+// stop reports the messages that will not be delivered.
+func (r *route) stop() {
+	count := len(r.pending.messages)
+
+	switch {
+	case count == 0:
+	case r.pending.dir != "":
+		logger.Notify().Info("undelivered notifications kept for the next run",
+			"sink", r.Name, "count", count)
+	default:
+		logger.Notify().Warn("dropping undelivered notifications", "sink", r.Name, "count", count)
+	}
+}
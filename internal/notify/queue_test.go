@@ -0,0 +1,177 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func eventTypes(messages []Message) []EventType {
+	types := make([]EventType, 0, len(messages))
+	for _, msg := range messages {
+		types = append(types, msg.Event.Type)
+	}
+
+	return types
+}
+
+func pendingFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*"+pendingExt))
+	require.NoError(t, err)
+
+	return files
+}
+
+func TestQueue_RetriesInOrder(t *testing.T) {
+	sink := &recordingSink{failures: 2}
+
+	notifier, err := New(Queue{RetryMin: time.Millisecond}, Route{Name: "flaky", Sink: sink})
+	require.NoError(t, err)
+
+	notifier.Notify(Event{Type: EventDown})
+	notifier.Notify(Event{Type: EventActionExecuted})
+
+	require.Eventually(t, func() bool {
+		return len(sink.received()) == 2
+	}, time.Second, time.Millisecond)
+	notifier.Close()
+
+	assert.Equal(t, []EventType{EventDown, EventActionExecuted}, eventTypes(sink.received()))
+}
+
+func TestQueue_UpFlushes(t *testing.T) {
+	sink := &recordingSink{failures: 1}
+	outages := &recordingSink{failures: 1}
+
+	notifier, err := New(
+		Queue{RetryMin: time.Hour},
+		Route{Name: "down only", Sink: sink, Events: []EventType{EventDown}},
+		Route{Name: "outages", Sink: outages},
+	)
+	require.NoError(t, err)
+
+	notifier.Notify(Event{Type: EventDown})
+	notifier.Notify(Event{Type: EventUp})
+
+	require.Eventually(t, func() bool {
+		return len(sink.received()) == 1 && len(outages.received()) == 2
+	}, time.Second, time.Millisecond, "the connection coming back should retry now")
+	notifier.Close()
+
+	assert.Equal(t, []EventType{EventDown, EventUp}, eventTypes(outages.received()))
+}
+
+func TestQueue_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	queue := Queue{Dir: dir, RetryMin: time.Hour}
+	down := &recordingSink{failures: 1}
+
+	notifier, err := New(queue, Route{Name: "chat/ops", Sink: down})
+	require.NoError(t, err)
+
+	notifier.Notify(Event{Type: EventDown})
+	notifier.Notify(Event{Type: EventActionFailed})
+	notifier.Close()
+
+	assert.Empty(t, down.received())
+	require.Len(t, pendingFiles(t, dir), 2)
+	assert.DirExists(t, filepath.Join(dir, "chat_ops"))
+
+	up := &recordingSink{}
+
+	notifier, err = New(queue, Route{Name: "chat/ops", Sink: up})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(up.received()) == 2
+	}, time.Second, time.Millisecond, "stored messages should be sent on start")
+	notifier.Close()
+
+	assert.Equal(t, []EventType{EventDown, EventActionFailed}, eventTypes(up.received()))
+	assert.Empty(t, pendingFiles(t, dir))
+}
+
+func TestQueue_DropsExpired(t *testing.T) {
+	dir := t.TempDir()
+	queue := Queue{Dir: dir, RetryMin: time.Hour}
+
+	notifier, err := New(queue, Route{Name: "chat", Sink: &recordingSink{failures: 1}})
+	require.NoError(t, err)
+	notifier.Notify(Event{Type: EventDown})
+	notifier.Close()
+	require.Len(t, pendingFiles(t, dir), 1)
+
+	time.Sleep(5 * time.Millisecond)
+
+	sink := &recordingSink{}
+	queue.MaxAge = time.Millisecond
+
+	notifier, err = New(queue, Route{Name: "chat", Sink: sink})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(pendingFiles(t, dir)) == 0
+	}, time.Second, time.Millisecond)
+	notifier.Close()
+
+	assert.Empty(t, sink.received())
+}
+
+func TestQueue_MaxPending(t *testing.T) {
+	dir := t.TempDir()
+	sink := &recordingSink{failures: 1}
+
+	notifier, err := New(Queue{Dir: dir, RetryMin: time.Hour, MaxPending: 2}, Route{Name: "chat", Sink: sink})
+	require.NoError(t, err)
+
+	notifier.Notify(Event{Type: EventDown})
+	notifier.Notify(Event{Type: EventActionExecuted})
+	notifier.Notify(Event{Type: EventActionFailed})
+	notifier.Close()
+
+	files := pendingFiles(t, dir)
+	require.Len(t, files, 2)
+
+	msg, err := readPending(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, EventActionExecuted, msg.Message.Event.Type, "the oldest message is dropped")
+}
+
+func TestQueue_UnreadableFile(t *testing.T) {
+	dir := t.TempDir()
+	sinkDir := filepath.Join(dir, "chat")
+	require.NoError(t, os.MkdirAll(sinkDir, 0o700))
+
+	broken := filepath.Join(sinkDir, "1-1"+pendingExt)
+	require.NoError(t, os.WriteFile(broken, []byte("{"), 0o600))
+
+	notifier, err := New(Queue{Dir: dir}, Route{Name: "chat", Sink: &recordingSink{}})
+	require.NoError(t, err)
+	notifier.Close()
+
+	assert.NoFileExists(t, broken)
+}
+
+func TestPendingQueue_Backoff(t *testing.T) {
+	pending := &pendingQueue{Queue: Queue{RetryMin: time.Second, RetryMax: 5 * time.Second}}
+	msg := &pendingMessage{}
+
+	var delays []time.Duration
+	for range 5 {
+		delays = append(delays, pending.failed(msg))
+	}
+
+	assert.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second,
+	}, delays)
+	assert.Equal(t, 5, msg.Attempts)
+
+	msg.Attempts = 1000
+	assert.Equal(t, DefaultRetryMax, (&pendingQueue{}).failed(msg))
+}
@@ -0,0 +1,211 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/hugoh/upd/internal/check"
+	"github.com/hugoh/upd/internal/version"
+)
+
+// MaxResponseDrain caps how much of a webhook response is read before the
+// connection is released.
+const MaxResponseDrain = 4096
+
+var (
+	// ErrWebhookStatus is returned when a webhook answers with a status code
+	// that is not considered a success.
+	ErrWebhookStatus = errors.New("unexpected webhook status")
+	// ErrWebhookURL is returned when a webhook URL is not an absolute HTTP(S)
+	// URL.
+	ErrWebhookURL = errors.New("must be an absolute http or https URL")
+	// ErrEmptyCommand is returned when an exec sink has no command.
+	ErrEmptyCommand = errors.New("must not be empty")
+)
+
+// HTTPClient is shared by the webhooks of notifications and down actions,
+// and by power cycles.
+//
+//nolint:gochecknoglobals // shared client for connection pooling
+var HTTPClient = &http.Client{}
+
+// ValidateWebhookURL checks that rawURL is an absolute HTTP(S) URL.
+func ValidateWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !parsed.IsAbs() || (parsed.Scheme != check.HTTP && parsed.Scheme != check.HTTPS) {
+		return fmt.Errorf("url: %w", ErrWebhookURL)
+	}
+
+	return nil
+}
+
+// DoWebhook sends req through HTTPClient, with the upd User-Agent unless
+// one is set, and releases the connection. It returns the response status
+// code, with an ErrWebhookStatus error when success does not accept it.
+func DoWebhook(req *http.Request, success func(code int) bool) (int, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", check.UserAgentPrefix+version.Version())
+	}
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = &url.Error{Op: urlErr.Op, URL: RedactURL(urlErr.URL), Err: urlErr.Err}
+		}
+
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+
+	_, _ = io.CopyN(io.Discard, resp.Body, MaxResponseDrain)
+	_ = resp.Body.Close()
+
+	if !success(resp.StatusCode) {
+		return resp.StatusCode, fmt.Errorf("%w: %s", ErrWebhookStatus, resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// RedactURL hides the user info and the query values of a webhook URL, which
+// commonly hold tokens, so that it can be logged.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "[redacted]"
+	}
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query.Set(key, "xxxxx")
+		}
+
+		u.RawQuery = query.Encode()
+	}
+
+	return u.Redacted()
+}
+
+// StatusOK tells whether code is a 2xx status.
+func StatusOK(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// WebhookSink sends the message body in an HTTP request, such as to a chat
+// service's incoming webhook.
+type WebhookSink struct {
+	// Method defaults to POST.
+	Method string
+	URL    string
+	// Headers are added to the request. Content-Type defaults to plain
+	// text.
+	Headers map[string]string
+}
+
+// Validate checks that the webhook can be sent.
+func (w *WebhookSink) Validate() error {
+	return ValidateWebhookURL(w.URL)
+}
+
+// Send posts the message body, returning an error unless the response status
+// is 2xx.
+func (w *WebhookSink) Send(ctx context.Context, msg Message) error {
+	method := http.MethodPost
+	if w.Method != "" {
+		method = strings.ToUpper(w.Method)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, w.URL, strings.NewReader(msg.Body))
+	if err != nil {
+		return fmt.Errorf("error building webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	for key, value := range w.Headers {
+		req.Header.Set(key, value)
+	}
+
+	_, err = DoWebhook(req, StatusOK)
+
+	return err
+}
+
+// ExecSink runs a command with the message body on its standard input, and
+// the event type and subject in the UPD_EVENT and UPD_SUBJECT environment
+// variables.
+type ExecSink struct {
+	Command string
+	// Start sets up and starts the command, with env added to its
+	// environment, such as to run it with the user and environment of down
+	// action commands. The command inherits those of upd when nil.
+	Start func(cmd *exec.Cmd, env []string) error
+}
+
+// Validate checks that the command can be parsed.
+func (e *ExecSink) Validate() error {
+	_, err := e.args()
+
+	return err
+}
+
+// Send runs the command to completion.
+func (e *ExecSink) Send(ctx context.Context, msg Message) error {
+	args, err := e.args()
+	if err != nil {
+		return err
+	}
+
+	// #nosec G204 // the command comes from the configuration
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(msg.Body)
+
+	var out bytes.Buffer
+
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	env := []string{
+		"UPD_EVENT=" + string(msg.Event.Type),
+		"UPD_SUBJECT=" + msg.Subject,
+	}
+
+	if e.Start != nil {
+		err = e.Start(cmd, env)
+	} else {
+		cmd.Env = append(cmd.Environ(), env...)
+		err = cmd.Start()
+	}
+
+	if err == nil {
+		err = cmd.Wait()
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", e.Command, err, strings.TrimSpace(out.String()))
+	}
+
+	return nil
+}
+
+func (e *ExecSink) args() ([]string, error) {
+	args, err := shlex.Split(e.Command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command: %w", err)
+	}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("command: %w", ErrEmptyCommand)
+	}
+
+	return args, nil
+}
@@ -0,0 +1,217 @@
+// Package schedule describes recurring time windows, such as an ISP's
+// published maintenance window, in weekday and time-of-day form.
+//
+// A window repeats on the given weekdays, from Start to End in its time zone.
+// When End is not after Start, the window crosses midnight and ends on the
+// following day:
+//
+//	w := schedule.Window{
+//		Days:     []time.Weekday{time.Tuesday},
+//		Start:    2 * time.Hour,
+//		End:      5 * time.Hour,
+//		Location: paris,
+//	}
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// day is the length of a calendar day, ignoring daylight saving changes.
+const day = 24 * time.Hour
+
+var (
+	// ErrInvalidClock is returned for a time of day not in 15:04 form.
+	ErrInvalidClock = errors.New("must be a time of day such as 02:30")
+	// ErrInvalidWeekday is returned for an unknown weekday name.
+	ErrInvalidWeekday = errors.New("must be a weekday such as mon or tuesday")
+)
+
+// Window is a recurring time window.
+type Window struct {
+	Name string
+	// Days are the weekdays the window starts on; every day when empty.
+	Days []time.Weekday
+	// Start and End are offsets from midnight.
+	Start time.Duration
+	End   time.Duration
+	// Location is the time zone of Start and End; UTC when nil.
+	Location *time.Location
+	// ExcludeFromAvailability removes downtime within the window from the
+	// availability statistics.
+	ExcludeFromAvailability bool
+}
+
+// Schedule is a set of windows.
+type Schedule []Window
+
+// Active returns the first window containing t and when it ends, or nil.
+func (s Schedule) Active(t time.Time) (*Window, time.Time) {
+	for i := range s {
+		if end, ok := s[i].contains(t); ok {
+			return &s[i], end
+		}
+	}
+
+	return nil, time.Time{}
+}
+
+// Excluded returns how much of [from, to) falls within windows excluded
+// from availability. Overlapping windows are counted once.
+func (s Schedule) Excluded(from, to time.Time) time.Duration {
+	var spans []span
+
+	for i := range s {
+		if !s[i].ExcludeFromAvailability {
+			continue
+		}
+
+		for _, sp := range s[i].occurrences(from, to) {
+			spans = append(spans, span{start: latest(sp.start, from), end: earliest(sp.end, to)})
+		}
+	}
+
+	slices.SortFunc(spans, func(a, b span) int { return a.start.Compare(b.start) })
+
+	var (
+		total time.Duration
+		cur   span
+	)
+
+	for _, sp := range spans {
+		switch {
+		case cur.end.IsZero():
+			cur = sp
+		case !sp.start.After(cur.end):
+			if sp.end.After(cur.end) {
+				cur.end = sp.end
+			}
+		default:
+			total += cur.end.Sub(cur.start)
+			cur = sp
+		}
+	}
+
+	if !cur.end.IsZero() {
+		total += cur.end.Sub(cur.start)
+	}
+
+	return total
+}
+
+type span struct {
+	start time.Time
+	end   time.Time
+}
+
+// Next returns the start of the first occurrence of the window after t.
+func (w *Window) Next(t time.Time) time.Time {
+	// Occurrences start at most a week apart; the extra day covers daylight
+	// saving changes.
+	for _, occ := range w.occurrences(t, t.Add(8*day)) {
+		if occ.start.After(t) {
+			return occ.start
+		}
+	}
+
+	return time.Time{}
+}
+
+// contains reports whether t is within an occurrence of the window, and when
+// that occurrence ends.
+func (w *Window) contains(t time.Time) (time.Time, bool) {
+	for _, occ := range w.occurrences(t, t.Add(time.Nanosecond)) {
+		return occ.end, true
+	}
+
+	return time.Time{}, false
+}
+
+// occurrences returns the occurrences of the window overlapping [from, to).
+func (w *Window) occurrences(from, to time.Time) []span {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	length := w.End - w.Start
+	if length <= 0 {
+		length += day
+	}
+
+	// Start the day before from, whose occurrence may cross midnight.
+	first := from.In(loc).AddDate(0, 0, -1)
+	y, m, d := first.Date()
+
+	var spans []span
+
+	for i := 0; ; i++ {
+		midnight := time.Date(y, m, d+i, 0, 0, 0, 0, loc)
+		if !midnight.Before(to) {
+			break
+		}
+
+		if len(w.Days) > 0 && !slices.Contains(w.Days, midnight.Weekday()) {
+			continue
+		}
+
+		start := midnight.Add(w.Start)
+		end := start.Add(length)
+
+		if start.Before(to) && end.After(from) {
+			spans = append(spans, span{start: start, end: end})
+		}
+	}
+
+	return spans
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+
+	return b
+}
+
+// ParseClock parses a time of day in 15:04 form into an offset from midnight.
+// "24:00" is accepted as the end of the day.
+func ParseClock(s string) (time.Duration, error) {
+	if s == "24:00" {
+		return day, nil
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q: %w", s, ErrInvalidClock)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseWeekday parses a weekday name, full or abbreviated to three letters,
+// in any case.
+func ParseWeekday(s string) (time.Weekday, error) {
+	name := strings.ToLower(s)
+
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		full := strings.ToLower(wd.String())
+		if name == full || name == full[:3] {
+			return wd, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%q: %w", s, ErrInvalidWeekday)
+}
@@ -0,0 +1,144 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tuesdayNights(t *testing.T) Window {
+	t.Helper()
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	return Window{
+		Name:     "isp",
+		Days:     []time.Weekday{time.Tuesday},
+		Start:    2 * time.Hour,
+		End:      5 * time.Hour,
+		Location: paris,
+	}
+}
+
+func TestActive(t *testing.T) {
+	w := tuesdayNights(t)
+	s := Schedule{w}
+
+	// 2026-10-20 is a Tuesday.
+	inside := time.Date(2026, 10, 20, 3, 30, 0, 0, w.Location)
+	got, until := s.Active(inside)
+	require.NotNil(t, got)
+	assert.Equal(t, "isp", got.Name)
+	assert.True(t, until.Equal(time.Date(2026, 10, 20, 5, 0, 0, 0, w.Location)))
+
+	for _, outside := range []time.Time{
+		time.Date(2026, 10, 20, 1, 59, 0, 0, w.Location),
+		time.Date(2026, 10, 20, 5, 0, 0, 0, w.Location),
+		time.Date(2026, 10, 21, 3, 0, 0, 0, w.Location),
+	} {
+		got, _ := s.Active(outside)
+		assert.Nil(t, got, outside)
+	}
+}
+
+func TestActive_TimeZone(t *testing.T) {
+	s := Schedule{tuesdayNights(t)}
+
+	// 03:00 in Paris (CEST) is 01:00 UTC.
+	got, _ := s.Active(time.Date(2026, 10, 20, 1, 0, 0, 0, time.UTC))
+	assert.NotNil(t, got)
+
+	got, _ = s.Active(time.Date(2026, 10, 20, 3, 30, 0, 0, time.UTC))
+	assert.Nil(t, got)
+}
+
+func TestActive_CrossesMidnight(t *testing.T) {
+	s := Schedule{{
+		Days:  []time.Weekday{time.Saturday},
+		Start: 23 * time.Hour,
+		End:   time.Hour,
+	}}
+
+	// 2026-10-24 is a Saturday.
+	got, until := s.Active(time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC))
+	require.NotNil(t, got)
+	assert.True(t, until.Equal(time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC)))
+
+	got, _ = s.Active(time.Date(2026, 10, 24, 0, 30, 0, 0, time.UTC))
+	assert.Nil(t, got, "the window starts on Saturday, not Friday")
+}
+
+func TestActive_EveryDay(t *testing.T) {
+	s := Schedule{{Start: 12 * time.Hour, End: 13 * time.Hour}}
+
+	for d := range 7 {
+		got, _ := s.Active(time.Date(2026, 10, 19+d, 12, 30, 0, 0, time.UTC))
+		assert.NotNil(t, got)
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	w := tuesdayNights(t)
+	w.ExcludeFromAvailability = true
+
+	from := time.Date(2026, 10, 20, 4, 0, 0, 0, w.Location)
+	to := time.Date(2026, 10, 27, 4, 0, 0, 0, w.Location)
+
+	// The end of one Tuesday window and the start of the next.
+	assert.Equal(t, 3*time.Hour, Schedule{w}.Excluded(from, to))
+}
+
+func TestExcluded_MergesOverlaps(t *testing.T) {
+	s := Schedule{
+		{Start: time.Hour, End: 3 * time.Hour, ExcludeFromAvailability: true},
+		{Start: 2 * time.Hour, End: 4 * time.Hour, ExcludeFromAvailability: true},
+		{Start: 10 * time.Hour, End: 11 * time.Hour},
+	}
+
+	from := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	assert.Equal(t, 3*time.Hour, s.Excluded(from, to))
+}
+
+func TestNext(t *testing.T) {
+	w := tuesdayNights(t)
+
+	// 2026-10-20 is a Tuesday.
+	next := w.Next(time.Date(2026, 10, 20, 1, 0, 0, 0, w.Location))
+	assert.True(t, next.Equal(time.Date(2026, 10, 20, 2, 0, 0, 0, w.Location)), next)
+
+	next = w.Next(time.Date(2026, 10, 20, 2, 0, 0, 0, w.Location))
+	assert.True(t, next.Equal(time.Date(2026, 10, 27, 2, 0, 0, 0, w.Location)), "strictly after: %s", next)
+
+	daily := Window{Start: 8 * time.Hour, End: 8 * time.Hour}
+	next = daily.Next(time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC))
+	assert.True(t, next.Equal(time.Date(2026, 10, 21, 8, 0, 0, 0, time.UTC)), next)
+}
+
+func TestParseClock(t *testing.T) {
+	d, err := ParseClock("02:30")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour+30*time.Minute, d)
+
+	d, err = ParseClock("24:00")
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, d)
+
+	_, err = ParseClock("2am")
+	require.ErrorIs(t, err, ErrInvalidClock)
+}
+
+func TestParseWeekday(t *testing.T) {
+	for _, name := range []string{"tue", "Tuesday", "TUE"} {
+		wd, err := ParseWeekday(name)
+		require.NoError(t, err)
+		assert.Equal(t, time.Tuesday, wd)
+	}
+
+	_, err := ParseWeekday("tues")
+	require.ErrorIs(t, err, ErrInvalidWeekday)
+}
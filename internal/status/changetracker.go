@@ -15,8 +15,13 @@ type UptimeResult struct {
 	Availability float64
 	Downtime     time.Duration
 	Coverage     time.Duration
+	// Excluded is downtime left out of Availability and Downtime.
+	Excluded time.Duration
 }
 
+// ExcludeFunc returns how much of [from, to) is excluded from availability.
+type ExcludeFunc func(from, to time.Time) time.Duration
+
 // StateChange represents a single state transition in the tracker.
 type StateChange struct {
 	timestamp time.Time
@@ -33,6 +38,7 @@ type StateChangeTracker struct {
 	updateCount uint32
 	lastUpdated time.Time
 	started     time.Time
+	exclude     ExcludeFunc
 }
 
 // RecordChange adds a new state change to the tracker and prunes old entries.
@@ -156,6 +162,11 @@ func (tracker *StateChangeTracker) GenReports(currentState bool, end time.Time,
 			Downtime:     ReadableDuration(result.Downtime),
 		}
 
+		if result.Excluded > 0 {
+			e := ReadableDuration(result.Excluded)
+			rpt.Excluded = &e
+		}
+
 		if result.Coverage < period {
 			c := ReadableDuration(result.Coverage)
 			rpt.Coverage = &c
@@ -170,17 +181,18 @@ func (tracker *StateChangeTracker) GenReports(currentState bool, end time.Time,
 func (tracker *StateChangeTracker) uptimeCalculation(currentState bool,
 	last time.Duration, end time.Time,
 ) UptimeResult {
+	start := end.Add(-last)
+
 	if tracker.tail == nil {
 		// No records other than the current status
 		if currentState {
 			return UptimeResult{Availability: 1.0}
 		}
 
-		return UptimeResult{Downtime: last}
+		return tracker.result(0, tracker.excluded(start, end), last)
 	}
 
-	uptime := time.Duration(0)
-	start := end.Add(-last)
+	var uptime, excluded time.Duration
 
 	current := tracker.tail
 	endOfPeriod := end
@@ -200,6 +212,8 @@ func (tracker *StateChangeTracker) uptimeCalculation(currentState bool,
 		// Add duration if state was 'up'
 		if lastStateRecorded {
 			uptime += endOfPeriod.Sub(lastTimestampSeen)
+		} else {
+			excluded += tracker.excluded(lastTimestampSeen, endOfPeriod)
 		}
 
 		if lastTimestampSeen.Equal(start) {
@@ -214,11 +228,32 @@ func (tracker *StateChangeTracker) uptimeCalculation(currentState bool,
 		oldState := !lastStateRecorded
 		if oldState {
 			uptime += lastTimestampSeen.Sub(start)
+		} else {
+			excluded += tracker.excluded(start, lastTimestampSeen)
 		}
 	}
 
+	return tracker.result(uptime, excluded, last)
+}
+
+// result computes availability over the period minus the excluded downtime.
+func (tracker *StateChangeTracker) result(uptime, excluded, last time.Duration) UptimeResult {
+	counted := last - excluded
+	if counted <= 0 {
+		return UptimeResult{Availability: 1.0, Excluded: excluded}
+	}
+
 	return UptimeResult{
-		Availability: float64(uptime) / float64(last),
-		Downtime:     last - uptime,
+		Availability: float64(uptime) / float64(counted),
+		Downtime:     counted - uptime,
+		Excluded:     excluded,
 	}
 }
+
+func (tracker *StateChangeTracker) excluded(from, to time.Time) time.Duration {
+	if tracker.exclude == nil || !from.Before(to) {
+		return 0
+	}
+
+	return tracker.exclude(from, to)
+}
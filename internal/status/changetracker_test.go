@@ -279,3 +279,49 @@ func TestGenReports_ErrorPath_NotComputedDowntime(t *testing.T) {
 	assert.InDelta(t, float64(-1), float64(reports[0].Availability), 0.0001)
 	assert.Equal(t, NotComputedDuration, reports[0].Downtime)
 }
+
+func TestGenReports_ExcludesDowntime(t *testing.T) {
+	now := time.Now()
+	windowStart := now.Add(-90 * time.Minute)
+	windowEnd := now.Add(-30 * time.Minute)
+
+	tracker := GetTracker()
+	tracker.started = now.Add(-24 * time.Hour)
+	tracker.exclude = func(from, to time.Time) time.Duration {
+		if from.Before(windowStart) {
+			from = windowStart
+		}
+
+		if to.After(windowEnd) {
+			to = windowEnd
+		}
+
+		return max(to.Sub(from), 0)
+	}
+	tracker.RecordChange(now.Add(-2*time.Hour), false)
+	tracker.RecordChange(now.Add(-1*time.Hour), true)
+
+	reports := tracker.GenReports(true, now, []time.Duration{4 * time.Hour})
+	require.Len(t, reports, 1)
+
+	// 30 minutes of the outage fall within the window: they count neither
+	// as downtime nor as part of the period.
+	require.NotNil(t, reports[0].Excluded)
+	assert.Equal(t, ReadableDuration(30*time.Minute), *reports[0].Excluded)
+	assert.Equal(t, ReadableDuration(30*time.Minute), reports[0].Downtime)
+	assert.InDelta(t, 3.0/3.5, float64(reports[0].Availability), 1e-9)
+}
+
+func TestCalculateUptime_FullyExcluded(t *testing.T) {
+	now := time.Now()
+
+	tracker := GetTracker()
+	tracker.started = now.Add(-24 * time.Hour)
+	tracker.exclude = func(from, to time.Time) time.Duration { return to.Sub(from) }
+
+	result, err := tracker.CalculateUptime(false, time.Hour, now)
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, result.Availability, 1e-9)
+	assert.Equal(t, time.Duration(0), result.Downtime)
+	assert.Equal(t, time.Hour, result.Excluded)
+}
@@ -0,0 +1,107 @@
+package status
+
+import (
+	"math"
+	"time"
+)
+
+// latencyBins is the number of latency histogram bins: one for sub-ms
+// latencies, 32 half-octave bins from 1ms to ~65s, and one overflow bin.
+const latencyBins = 34
+
+// latencyHistogram counts probe latencies in logarithmic bins. Bin k (k >= 1)
+// holds latencies in [2^((k-1)/2), 2^(k/2)) ms, so a quantile read from it is
+// at most ~41% above the true value. Counts saturate instead of wrapping.
+type latencyHistogram [latencyBins]uint16
+
+// LatencyStats holds latency percentiles and the maximum. Each percentile is
+// the upper bound of the histogram bin it falls in, capped at the maximum.
+type LatencyStats struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+func latencyBin(d time.Duration) int {
+	if d < time.Millisecond {
+		return 0
+	}
+
+	idx := 1 + int(2*math.Log2(float64(d)/float64(time.Millisecond)))
+
+	return min(idx, latencyBins-1)
+}
+
+func latencyBinUpper(idx int) time.Duration {
+	return time.Duration(float64(time.Millisecond) * math.Pow(2, float64(idx)/2)) //nolint:mnd
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	idx := latencyBin(d)
+	if h[idx] < math.MaxUint16 {
+		h[idx]++
+	}
+}
+
+// maxLatency records the highest latency of a bucket in microseconds, which
+// keeps it at 4 bytes while covering latencies up to ~71 minutes.
+type maxLatency uint32
+
+func (m *maxLatency) add(d time.Duration) {
+	us := min(d.Microseconds(), math.MaxUint32)
+	if us > int64(*m) {
+		*m = maxLatency(us)
+	}
+}
+
+func (m maxLatency) duration() time.Duration {
+	return time.Duration(m) * time.Microsecond
+}
+
+// latencyCounts accumulates histograms without saturation.
+type latencyCounts struct {
+	bins [latencyBins]int
+	max  time.Duration
+}
+
+func (c *latencyCounts) merge(h *latencyHistogram, highest maxLatency) {
+	for i, n := range h {
+		c.bins[i] += int(n)
+	}
+
+	c.max = max(c.max, highest.duration())
+}
+
+func (c *latencyCounts) quantile(q float64) time.Duration {
+	var total int
+	for _, n := range c.bins {
+		total += n
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	rank := max(int(math.Ceil(q*float64(total))), 1)
+
+	var seen int
+
+	for i, n := range c.bins {
+		seen += n
+		if seen >= rank {
+			return min(latencyBinUpper(i), c.max)
+		}
+	}
+
+	return c.max
+}
+
+func (c *latencyCounts) stats() LatencyStats {
+	return LatencyStats{
+		P50: c.quantile(0.5),  //nolint:mnd
+		P90: c.quantile(0.9),  //nolint:mnd
+		P99: c.quantile(0.99), //nolint:mnd
+		Max: c.max,
+	}
+}
@@ -0,0 +1,102 @@
+package status
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyBin(t *testing.T) {
+	assert.Equal(t, 0, latencyBin(0))
+	assert.Equal(t, 0, latencyBin(999*time.Microsecond))
+	assert.Equal(t, 1, latencyBin(time.Millisecond))
+	assert.Equal(t, 2, latencyBin(1500*time.Microsecond))
+	assert.Equal(t, 3, latencyBin(2*time.Millisecond))
+	assert.Equal(t, latencyBins-1, latencyBin(time.Hour))
+}
+
+func TestLatencyBin_WithinUpperBound(t *testing.T) {
+	for _, d := range []time.Duration{
+		time.Millisecond, 7 * time.Millisecond, 100 * time.Millisecond, 3 * time.Second,
+	} {
+		idx := latencyBin(d)
+		assert.Less(t, d, latencyBinUpper(idx), "upper bound of bin %d", idx)
+		assert.GreaterOrEqual(t, d, latencyBinUpper(idx-1), "lower bound of bin %d", idx)
+	}
+}
+
+func TestLatencyHistogram_Saturates(t *testing.T) {
+	var h latencyHistogram
+
+	h[1] = math.MaxUint16
+	h.add(time.Millisecond)
+
+	assert.Equal(t, uint16(math.MaxUint16), h[1])
+}
+
+func TestLatencyCounts_Stats(t *testing.T) {
+	var (
+		h       latencyHistogram
+		highest maxLatency
+		counts  latencyCounts
+	)
+
+	for range 50 {
+		h.add(10 * time.Millisecond)
+	}
+
+	for range 40 {
+		h.add(100 * time.Millisecond)
+	}
+
+	for range 10 {
+		h.add(time.Second)
+	}
+
+	highest.add(time.Second)
+	counts.merge(&h, highest)
+	stats := counts.stats()
+
+	assert.Equal(t, latencyBinUpper(latencyBin(10*time.Millisecond)), stats.P50)
+	assert.Equal(t, latencyBinUpper(latencyBin(100*time.Millisecond)), stats.P90)
+	assert.Equal(t, time.Second, stats.P99, "percentiles are capped at the maximum")
+	assert.Equal(t, time.Second, stats.Max)
+}
+
+func TestMaxLatency(t *testing.T) {
+	var m maxLatency
+
+	m.add(10 * time.Millisecond)
+	m.add(5 * time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, m.duration())
+
+	m.add(100 * time.Hour)
+	assert.Equal(t, time.Duration(math.MaxUint32)*time.Microsecond, m.duration(), "saturates")
+}
+
+func TestLatencyCounts_MergeBuckets(t *testing.T) {
+	var (
+		fast, slow       latencyHistogram
+		fastMax, slowMax maxLatency
+		counts           latencyCounts
+	)
+
+	fast.add(time.Millisecond)
+	fastMax.add(time.Millisecond)
+	slow.add(time.Second)
+	slowMax.add(time.Second)
+
+	counts.merge(&fast, fastMax)
+	counts.merge(&slow, slowMax)
+
+	assert.Equal(t, time.Second, counts.stats().Max)
+	assert.Equal(t, latencyBinUpper(latencyBin(time.Millisecond)), counts.stats().P50)
+}
+
+func TestLatencyCounts_Empty(t *testing.T) {
+	var counts latencyCounts
+
+	assert.Equal(t, LatencyStats{}, counts.stats())
+}
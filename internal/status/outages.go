@@ -0,0 +1,117 @@
+package status
+
+import (
+	"slices"
+	"time"
+)
+
+// MaxOutages is the number of most recent outages kept in the history.
+const MaxOutages = 20
+
+type outage struct {
+	start     time.Time
+	end       time.Time
+	fixedBy   string
+	diagnosis *Diagnosis
+}
+
+// StartOutage records the start of an outage. It does nothing if an outage
+// is already in progress.
+func (s *Status) StartOutage(t time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.currentOutage() != nil {
+		return
+	}
+
+	if len(s.outages) >= MaxOutages {
+		dropped := len(s.outages) - MaxOutages + 1
+		s.droppedOutageEnd = s.outages[dropped-1].end
+		s.outages = slices.Delete(s.outages, 0, dropped)
+	}
+
+	s.outages = append(s.outages, outage{start: t})
+}
+
+// EndOutage records the end of the outage in progress, if any, and the down
+// action stage that fixed it ("" when none ran).
+func (s *Status) EndOutage(t time.Time, fixedBy string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if o := s.currentOutage(); o != nil {
+		o.end = t
+		o.fixedBy = fixedBy
+	}
+}
+
+// SetOutageDiagnosis attaches a diagnosis to the outage in progress, if any.
+func (s *Status) SetOutageDiagnosis(d Diagnosis) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if o := s.currentOutage(); o != nil {
+		o.diagnosis = &d
+	}
+}
+
+// OutagesSince returns the outages that ended at or after since, or are in
+// progress, newest first. complete is false when outages of the period were
+// dropped from the history, which keeps the last MaxOutages.
+func (s *Status) OutagesSince(since time.Time) ([]OutageReport, bool) {
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	reports := s.outageReports(now)
+	for i, o := range reports {
+		if o.End != nil && o.End.Before(since) {
+			reports = reports[:i]
+
+			break
+		}
+	}
+
+	return reports, s.droppedOutageEnd.Before(since)
+}
+
+// currentOutage returns the outage in progress. Must be called with the lock
+// held.
+func (s *Status) currentOutage() *outage {
+	if len(s.outages) == 0 || !s.outages[len(s.outages)-1].end.IsZero() {
+		return nil
+	}
+
+	return &s.outages[len(s.outages)-1]
+}
+
+// outageReports returns the outage history, newest first. Must be called
+// with the lock held.
+func (s *Status) outageReports(now time.Time) []OutageReport {
+	if len(s.outages) == 0 {
+		return nil
+	}
+
+	reports := make([]OutageReport, 0, len(s.outages))
+
+	for _, o := range slices.Backward(s.outages) {
+		rpt := OutageReport{
+			Start:     o.start,
+			Duration:  ReadableDuration(now.Sub(o.start)),
+			FixedBy:   o.fixedBy,
+			Diagnosis: o.diagnosis,
+		}
+
+		if !o.end.IsZero() {
+			end := o.end
+			rpt.End = &end
+			rpt.Duration = ReadableDuration(end.Sub(o.start))
+		}
+
+		reports = append(reports, rpt)
+	}
+
+	return reports
+}
@@ -0,0 +1,91 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutages_History(t *testing.T) {
+	s := NewStatus()
+	start := time.Now().Add(-time.Hour)
+
+	s.StartOutage(start)
+	s.SetOutageDiagnosis(Diagnosis{Layer: "dns"})
+	s.EndOutage(start.Add(5*time.Minute), "")
+	s.StartOutage(start.Add(30 * time.Minute))
+	// Already in progress: ignored.
+	s.StartOutage(start.Add(40 * time.Minute))
+
+	rpt := s.GenStatReport(nil)
+	require.Len(t, rpt.Outages, 2)
+
+	current := rpt.Outages[0]
+	assert.Equal(t, start.Add(30*time.Minute), current.Start)
+	assert.Nil(t, current.End)
+	assert.Nil(t, current.Diagnosis)
+	assert.GreaterOrEqual(t, time.Duration(current.Duration), 30*time.Minute)
+
+	past := rpt.Outages[1]
+	require.NotNil(t, past.End)
+	assert.Equal(t, ReadableDuration(5*time.Minute), past.Duration)
+	require.NotNil(t, past.Diagnosis)
+	assert.Equal(t, "dns", past.Diagnosis.Layer)
+}
+
+func TestOutages_DiagnosisIgnoredWhenNoneInProgress(t *testing.T) {
+	s := NewStatus()
+	now := time.Now()
+
+	s.SetOutageDiagnosis(Diagnosis{Layer: "lan"})
+	s.StartOutage(now)
+	s.EndOutage(now.Add(time.Minute), "")
+	s.SetOutageDiagnosis(Diagnosis{Layer: "lan"})
+
+	rpt := s.GenStatReport(nil)
+	require.Len(t, rpt.Outages, 1)
+	assert.Nil(t, rpt.Outages[0].Diagnosis)
+}
+
+func TestOutages_Bounded(t *testing.T) {
+	s := NewStatus()
+	start := time.Now().Add(-time.Hour)
+
+	for i := range MaxOutages + 5 {
+		at := start.Add(time.Duration(i) * time.Minute)
+		s.StartOutage(at)
+		s.EndOutage(at.Add(time.Second), "")
+	}
+
+	rpt := s.GenStatReport(nil)
+	require.Len(t, rpt.Outages, MaxOutages)
+	assert.Equal(t, start.Add((MaxOutages+4)*time.Minute), rpt.Outages[0].Start)
+	assert.Equal(t, start.Add(5*time.Minute), rpt.Outages[MaxOutages-1].Start)
+}
+
+func TestOutages_Since(t *testing.T) {
+	s := NewStatus()
+	start := time.Now().Add(-time.Hour)
+
+	for i := range MaxOutages + 1 {
+		at := start.Add(time.Duration(i) * time.Minute)
+		s.StartOutage(at)
+		s.EndOutage(at.Add(time.Second), "")
+	}
+
+	outages, complete := s.OutagesSince(start.Add(10 * time.Minute))
+	assert.True(t, complete, "the dropped outage ended before")
+	require.Len(t, outages, MaxOutages-9)
+	assert.Equal(t, start.Add(MaxOutages*time.Minute), outages[0].Start)
+	assert.Equal(t, start.Add(10*time.Minute), outages[len(outages)-1].Start)
+
+	outages, complete = s.OutagesSince(start)
+	assert.False(t, complete, "the first outage was dropped")
+	assert.Len(t, outages, MaxOutages)
+}
+
+func TestOutages_OmittedWhenEmpty(t *testing.T) {
+	assert.Nil(t, NewStatus().GenStatReport(nil).Outages)
+}
@@ -3,23 +3,64 @@ package status
 import (
 	"cmp"
 	"fmt"
+	"math"
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/hugoh/upd/internal/check"
 )
 
+// ProbeTarget identifies the probe a result comes from.
+type ProbeTarget struct {
+	Scheme string
+	Target string
+	// Name is the optional name configured for the probe.
+	Name string
+}
+
+// ProbeResult is the outcome of a single probe.
+type ProbeResult struct {
+	ProbeTarget
+
+	Failed bool
+	// Failure classifies why the probe failed, or the server error a
+	// successful probe was answered with.
+	Failure check.FailureClass
+	// Latency is only recorded for successful probes: a failed probe's
+	// elapsed time is usually its timeout.
+	Latency time.Duration
+}
+
 // ProbeStats holds the result of a probe stats query.
 type ProbeStats struct {
 	Total  int
 	Failed int
+	// Failures counts failed probes per failure class, and successful ones
+	// answered with a server error under FailureHTTPStatus.
+	Failures [check.FailureClassCount]int
+	Latency  LatencyStats
+	// Targets breaks the stats down per probe target. Only set for the
+	// aggregate stats, and only for targets probed within the period.
+	Targets []TargetStats
+}
+
+// TargetStats holds the probe stats of a single target.
+type TargetStats struct {
+	ProbeTarget
+	ProbeStats
 }
 
 // probeBucket counts probe results within one bucket interval. Bucket start
 // times are not stored: they are derived from the ring's lastTime and the
-// bucket's distance from the newest bucket, keeping rings at 8 bytes per
+// bucket's distance from the newest bucket, keeping rings at 96 bytes per
 // bucket.
 type probeBucket struct {
-	total  uint32
-	failed uint32
+	total      uint32
+	failed     uint32
+	failures   [check.FailureClassCount]uint16
+	latency    latencyHistogram
+	maxLatency maxLatency
 }
 
 const (
@@ -31,9 +72,13 @@ const (
 	DefaultBucketMaxSpan = 30 * time.Minute
 	// MinBucketInterval is the smallest bucket interval.
 	MinBucketInterval = time.Second
-	// MaxBucketsPerPeriod bounds the ring size for a single report period
-	// (~800 KiB at 8 bytes per bucket).
-	MaxBucketsPerPeriod = 100_000
+	// TargetBucketsPerPeriod is how many buckets, at most, the per-target
+	// rings split a report period into. They are coarser than the aggregate
+	// rings so that their memory does not grow with the bucket configuration.
+	TargetBucketsPerPeriod = 100
+	// MaxBuckets bounds the buckets of all rings, aggregate and per target,
+	// across report periods (~9.2 MiB at 96 bytes per bucket).
+	MaxBuckets = 100_000
 )
 
 // BucketConfig tunes probe-stat bucket granularity. Zero values mean
@@ -58,7 +103,29 @@ func (c BucketConfig) Interval(period time.Duration) time.Duration {
 
 // BucketCount returns the ring size needed to cover the given report period.
 func (c BucketConfig) BucketCount(period time.Duration) int {
-	return max(int(period/c.Interval(period))+1, 1)
+	return bucketCount(period, c.Interval(period))
+}
+
+// TargetInterval returns the bucket interval of the per-target rings for the
+// given report period: Interval, or period/TargetBucketsPerPeriod if coarser.
+func (c BucketConfig) TargetInterval(period time.Duration) time.Duration {
+	return max(c.Interval(period), period/TargetBucketsPerPeriod)
+}
+
+// TotalBuckets returns the number of buckets of the aggregate rings and of
+// the rings of the given number of probe targets, for all periods.
+func (c BucketConfig) TotalBuckets(periods []time.Duration, targets int) int {
+	var total int
+
+	for _, period := range periods {
+		total += c.BucketCount(period) + targets*bucketCount(period, c.TargetInterval(period))
+	}
+
+	return total
+}
+
+func bucketCount(period, interval time.Duration) int {
+	return max(int(period/interval)+1, 1)
 }
 
 // probeRing is a fixed-size ring of time-bucketed counters covering one
@@ -72,43 +139,66 @@ type probeRing struct {
 	lastTime time.Time // start time of the newest bucket
 }
 
-// RollingProbeTracker tracks probe success/failure rates per report period.
-// Each period gets its own ring of bucketed counters, so bucket granularity
-// is proportional to the period it serves instead of one global resolution
-// paying for the longest retention. Thread-safe.
+// RollingProbeTracker tracks probe success/failure rates and latencies per
+// report period, both in aggregate and per probe target. Each period gets its
+// own ring of bucketed counters, so bucket granularity is proportional to the
+// period it serves instead of one global resolution paying for the longest
+// retention. Per-target rings use the coarser TargetInterval. Thread-safe.
 type RollingProbeTracker struct {
-	mu    sync.Mutex
-	rings []*probeRing
+	mu      sync.Mutex
+	periods []time.Duration
+	cfg     BucketConfig
+	rings   []*probeRing
+	// targets holds one set of rings per probe target, allocated on the
+	// target's first result.
+	targets map[ProbeTarget][]*probeRing
 }
 
 // NewRollingProbeTracker creates a tracker with one ring per report period.
 func NewRollingProbeTracker(periods []time.Duration, cfg BucketConfig) *RollingProbeTracker {
+	return &RollingProbeTracker{
+		periods: periods,
+		cfg:     cfg,
+		rings:   newProbeRings(periods, cfg.Interval),
+		targets: make(map[ProbeTarget][]*probeRing),
+	}
+}
+
+// newProbeRings creates one ring per period, with buckets of the interval
+// returned for the period.
+func newProbeRings(periods []time.Duration, interval func(time.Duration) time.Duration) []*probeRing {
 	rings := make([]*probeRing, 0, len(periods))
 
 	for _, period := range periods {
 		rings = append(rings, &probeRing{
 			period:   period,
-			interval: cfg.Interval(period),
-			buckets:  make([]probeBucket, cfg.BucketCount(period)),
+			interval: interval(period),
+			buckets:  make([]probeBucket, bucketCount(period, interval(period))),
 		})
 	}
 
-	return &RollingProbeTracker{rings: rings}
+	return rings
 }
 
 // Record records a probe result.
-func (t *RollingProbeTracker) Record(failed bool) {
+func (t *RollingProbeTracker) Record(res ProbeResult) {
 	now := time.Now()
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	targetRings, ok := t.targets[res.ProbeTarget]
+	if !ok {
+		targetRings = newProbeRings(t.periods, t.cfg.TargetInterval)
+		t.targets[res.ProbeTarget] = targetRings
+	}
+
 	for _, ring := range t.rings {
-		ring.recordAt(now)
+		ring.record(now, res)
+	}
 
-		if failed {
-			ring.buckets[ring.newestIdx()].failed++
-		}
+	for _, ring := range targetRings {
+		ring.record(now, res)
 	}
 }
 
@@ -135,15 +225,59 @@ func (t *RollingProbeTracker) StatsAll(now time.Time) []ProbeStats {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	keys := make([]ProbeTarget, 0, len(t.targets))
+	for key := range t.targets {
+		keys = append(keys, key)
+	}
+
+	slices.SortFunc(keys, func(x, y ProbeTarget) int {
+		return cmp.Or(
+			cmp.Compare(x.Name, y.Name),
+			cmp.Compare(x.Scheme, y.Scheme),
+			cmp.Compare(x.Target, y.Target),
+		)
+	})
+
 	result := make([]ProbeStats, len(t.rings))
 
 	for i, ring := range t.rings {
-		result[i] = ring.statsSince(now.Add(-ring.period))
+		cutoff := now.Add(-ring.period)
+		result[i] = ring.statsSince(cutoff)
+
+		for _, key := range keys {
+			ts := t.targets[key][i].statsSince(cutoff)
+			if ts.Total > 0 {
+				result[i].Targets = append(result[i].Targets, TargetStats{
+					ProbeTarget: key,
+					ProbeStats:  ts,
+				})
+			}
+		}
 	}
 
 	return result
 }
 
+// record counts a probe result at the given time. Must be called with the
+// tracker lock held.
+func (r *probeRing) record(now time.Time, res ProbeResult) {
+	r.recordAt(now)
+
+	bucket := &r.buckets[r.newestIdx()]
+	if res.Failure != check.FailureNone {
+		if n := &bucket.failures[res.Failure]; *n < math.MaxUint16 {
+			*n++
+		}
+	}
+
+	if res.Failed {
+		bucket.failed++
+	} else {
+		bucket.latency.add(res.Latency)
+		bucket.maxLatency.add(res.Latency)
+	}
+}
+
 // newestIdx returns the ring index of the newest bucket. Must be called with
 // the tracker lock held and count > 0.
 func (r *probeRing) newestIdx() int {
@@ -229,13 +363,24 @@ func (r *probeRing) statsSince(cutoff time.Time) ProbeStats {
 		skip = min(int((diff+r.interval-1)/r.interval), r.count)
 	}
 
-	var result ProbeStats
+	var (
+		result  ProbeStats
+		latency latencyCounts
+	)
 
 	for i := skip; i < r.count; i++ {
-		bucket := r.buckets[(r.head+i)%len(r.buckets)]
+		bucket := &r.buckets[(r.head+i)%len(r.buckets)]
 		result.Total += int(bucket.total)
 		result.Failed += int(bucket.failed)
+
+		for class, n := range bucket.failures {
+			result.Failures[class] += int(n)
+		}
+
+		latency.merge(&bucket.latency, bucket.maxLatency)
 	}
 
+	result.Latency = latency.stats()
+
 	return result
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hugoh/upd/internal/check"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -59,12 +60,30 @@ func TestBucketConfig_BucketCount(t *testing.T) {
 	assert.Equal(t, 1, cfg.BucketCount(0), "degenerate period")
 }
 
+func TestBucketConfig_TargetInterval(t *testing.T) {
+	var cfg BucketConfig
+
+	assert.Equal(t, time.Second, cfg.TargetInterval(time.Minute), "as fine as the aggregate")
+	assert.Equal(t, 7200*time.Second, cfg.TargetInterval(200*time.Hour), "period/100")
+
+	cfg = BucketConfig{MaxSpan: time.Second}
+	assert.Equal(t, 36*time.Second, cfg.TargetInterval(time.Hour), "not finer than period/100")
+}
+
+func TestBucketConfig_TotalBuckets(t *testing.T) {
+	cfg := BucketConfig{MaxSpan: time.Second}
+	periods := []time.Duration{time.Hour, 24 * time.Hour}
+
+	assert.Equal(t, 3601+86401, cfg.TotalBuckets(periods, 0))
+	assert.Equal(t, 3601+86401+3*(101+101), cfg.TotalBuckets(periods, 3))
+}
+
 func TestRollingProbeTracker_Record(t *testing.T) {
 	now := startOfThisMinute()
 	tracker := newSingleRingTracker(time.Hour, time.Minute)
 
 	for range 3 {
-		tracker.Record(false)
+		tracker.Record(ProbeResult{})
 	}
 
 	ps := tracker.Stats(time.Hour, now.Add(time.Minute))
@@ -75,15 +94,27 @@ func TestRollingProbeTracker_Record(t *testing.T) {
 func TestRollingProbeTracker_RecordFailed(t *testing.T) {
 	tracker := newSingleRingTracker(time.Hour, time.Minute)
 
-	tracker.Record(false)
-	tracker.Record(true)
-	tracker.Record(false)
+	tracker.Record(ProbeResult{})
+	tracker.Record(ProbeResult{Failed: true})
+	tracker.Record(ProbeResult{})
 
 	ps := tracker.Stats(time.Hour, time.Now())
 	assert.Equal(t, 3, ps.Total)
 	assert.Equal(t, 1, ps.Failed)
 }
 
+func TestRollingProbeTracker_RecordHTTPStatus(t *testing.T) {
+	tracker := newSingleRingTracker(time.Hour, time.Minute)
+
+	tracker.Record(ProbeResult{Failure: check.FailureHTTPStatus, Latency: time.Millisecond})
+
+	ps := tracker.Stats(time.Hour, time.Now())
+	assert.Equal(t, 1, ps.Total)
+	assert.Equal(t, 0, ps.Failed, "a server error answer is a success")
+	assert.Equal(t, 1, ps.Failures[check.FailureHTTPStatus])
+	assert.Equal(t, time.Millisecond, ps.Latency.Max)
+}
+
 func TestRollingProbeTracker_Empty(t *testing.T) {
 	tracker := newSingleRingTracker(time.Hour, time.Minute)
 
@@ -95,7 +126,7 @@ func TestRollingProbeTracker_Empty(t *testing.T) {
 func TestRollingProbeTracker_UnknownPeriod_Panics(t *testing.T) {
 	tracker := newSingleRingTracker(time.Hour, time.Minute)
 
-	tracker.Record(false)
+	tracker.Record(ProbeResult{})
 
 	assert.Panics(t, func() { tracker.Stats(2*time.Hour, time.Now()) })
 }
@@ -103,7 +134,7 @@ func TestRollingProbeTracker_UnknownPeriod_Panics(t *testing.T) {
 func TestRollingProbeTracker_NoPeriods(t *testing.T) {
 	tracker := NewRollingProbeTracker(nil, BucketConfig{})
 
-	tracker.Record(false)
+	tracker.Record(ProbeResult{})
 
 	assert.Panics(t, func() { tracker.Stats(time.Hour, time.Now()) })
 }
@@ -208,7 +239,7 @@ func TestRollingProbeTracker_ConcurrentAccess(t *testing.T) {
 	for range 10 {
 		wg.Go(func() {
 			for range 100 {
-				tracker.Record(true)
+				tracker.Record(ProbeResult{Failed: true})
 			}
 		})
 	}
@@ -267,8 +298,8 @@ func TestRollingProbeTracker_StatsAll(t *testing.T) {
 		BucketConfig{},
 	)
 
-	tracker.Record(false)
-	tracker.Record(true)
+	tracker.Record(ProbeResult{})
+	tracker.Record(ProbeResult{Failed: true})
 
 	all := tracker.StatsAll(now.Add(time.Second))
 	require.Len(t, all, 2)
@@ -284,3 +315,55 @@ func TestRollingProbeTracker_StatsAll_Empty(t *testing.T) {
 	require.Len(t, all, 1)
 	assert.Equal(t, 0, all[0].Total)
 }
+
+func TestRollingProbeTracker_PerTarget(t *testing.T) {
+	tracker := NewRollingProbeTracker([]time.Duration{time.Minute, time.Hour}, BucketConfig{})
+	tcp := ProbeTarget{Scheme: "tcp", Target: "1.1.1.1:53"}
+	named := ProbeTarget{Scheme: "http", Target: "http://example.com/", Name: "example"}
+
+	tracker.Record(ProbeResult{ProbeTarget: tcp, Latency: 10 * time.Millisecond})
+	tracker.Record(ProbeResult{ProbeTarget: tcp, Failed: true, Latency: 2 * time.Second})
+	tracker.Record(ProbeResult{ProbeTarget: named, Latency: 100 * time.Millisecond})
+
+	all := tracker.StatsAll(time.Now().Add(time.Second))
+	require.Len(t, all, 2)
+
+	for _, ps := range all {
+		assert.Equal(t, 3, ps.Total)
+		assert.Equal(t, 1, ps.Failed)
+		require.Len(t, ps.Targets, 2)
+
+		assert.Equal(t, tcp, ps.Targets[0].ProbeTarget)
+		assert.Equal(t, 2, ps.Targets[0].Total)
+		assert.Equal(t, 1, ps.Targets[0].Failed)
+		assert.Equal(t, 10*time.Millisecond, ps.Targets[0].Latency.Max,
+			"failed probes must not count toward latency")
+
+		assert.Equal(t, named, ps.Targets[1].ProbeTarget)
+		assert.Equal(t, 1, ps.Targets[1].Total)
+		assert.Nil(t, ps.Targets[1].Targets)
+	}
+}
+
+func TestRollingProbeTracker_PerTarget_CoarseRings(t *testing.T) {
+	tracker := NewRollingProbeTracker([]time.Duration{time.Hour}, BucketConfig{MaxSpan: time.Second})
+	tracker.Record(ProbeResult{ProbeTarget: ProbeTarget{Scheme: "tcp", Target: "1.1.1.1:53"}})
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	assert.Len(t, tracker.rings[0].buckets, 3601)
+
+	for _, rings := range tracker.targets {
+		assert.Len(t, rings[0].buckets, TargetBucketsPerPeriod+1)
+	}
+}
+
+func TestRollingProbeTracker_PerTarget_OutsideWindow(t *testing.T) {
+	tracker := NewRollingProbeTracker([]time.Duration{time.Minute}, BucketConfig{})
+	tracker.Record(ProbeResult{ProbeTarget: ProbeTarget{Scheme: "tcp", Target: "old"}})
+
+	all := tracker.StatsAll(time.Now().Add(2 * time.Minute))
+	require.Len(t, all, 1)
+	assert.Empty(t, all[0].Targets, "targets without probes in the period are omitted")
+}
@@ -11,16 +11,107 @@ type ReportByPeriod struct {
 	Coverage     *ReadableDuration `json:"coverage,omitempty"`
 	Availability ReadablePercent   `json:"availability"`
 	Downtime     ReadableDuration  `json:"downTime"`
+	Excluded     *ReadableDuration `json:"excluded,omitempty"`
 	TotalProbes  int               `json:"totalProbes"`
 	FailedProbes int               `json:"failedProbes"`
 	FailureRate  ReadablePercent   `json:"failureRate"`
+	Failures     map[string]int    `json:"failures,omitempty"`
+	Latency      *LatencyReport    `json:"latency,omitempty"`
+	Probes       []ProbeReport     `json:"probes,omitempty"`
+}
+
+// ProbeReport contains the statistics of a single probe target for a report
+// period.
+type ProbeReport struct {
+	Scheme       string          `json:"scheme"`
+	Target       string          `json:"target"`
+	Name         string          `json:"name,omitempty"`
+	TotalProbes  int             `json:"totalProbes"`
+	FailedProbes int             `json:"failedProbes"`
+	FailureRate  ReadablePercent `json:"failureRate"`
+	Failures     map[string]int  `json:"failures,omitempty"`
+	Latency      *LatencyReport  `json:"latency,omitempty"`
+}
+
+// LatencyReport contains latency percentiles and the maximum latency of
+// successful probes.
+type LatencyReport struct {
+	P50 ReadableLatency `json:"p50"`
+	P90 ReadableLatency `json:"p90"`
+	P99 ReadableLatency `json:"p99"`
+	Max ReadableLatency `json:"max"`
 }
 
 // DownActionStatus contains the current state of the down action loop.
 type DownActionStatus struct {
+	Stage         int              `json:"stage,omitempty"`
+	StageName     string           `json:"stageName,omitempty"`
 	Iteration     uint32           `json:"iteration"`
 	SleepTime     ReadableDuration `json:"sleepTime"`
 	BackoffCapped bool             `json:"backoffCapped"`
+	Failures      int              `json:"failures,omitempty"`
+	GaveUp        string           `json:"gaveUp,omitempty"`
+	Executions24h int              `json:"executions24h,omitempty"`
+	Skipped       uint32           `json:"skipped,omitempty"`
+	Suppressed    uint32           `json:"suppressed,omitempty"`
+	RateLimited   string           `json:"rateLimited,omitempty"`
+	NextAllowedAt *time.Time       `json:"nextAllowedAt,omitempty"`
+	Upcoming      []time.Time      `json:"upcoming,omitempty"`
+	DryRun        bool             `json:"dryRun,omitempty"`
+	History       []CommandRecord  `json:"history,omitempty"`
+}
+
+// CommandRecord describes one executed down action command. Stdout and Stderr
+// are truncated; Killed is set when upd terminated the command, e.g. because
+// the next iteration started. Error is set when the command could not be
+// started or waited for.
+type CommandRecord struct {
+	Command   string          `json:"command"`
+	Event     string          `json:"event"`
+	Stage     int             `json:"stage"`
+	Iteration uint32          `json:"iteration"`
+	Start     time.Time       `json:"start"`
+	Duration  ReadableLatency `json:"duration"`
+	ExitCode  int             `json:"exitCode"`
+	Killed    bool            `json:"killed,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Stdout    string          `json:"stdout,omitempty"`
+	Stderr    string          `json:"stderr,omitempty"`
+	DryRun    bool            `json:"dryRun,omitempty"`
+}
+
+// ProbeBreakerStatus contains the circuit breaker state of one probe target.
+type ProbeBreakerStatus struct {
+	Scheme   string     `json:"scheme"`
+	Target   string     `json:"target"`
+	State    string     `json:"state"`
+	Failures int        `json:"consecutiveFailures"`
+	RetryAt  *time.Time `json:"retryAt,omitempty"`
+}
+
+// DiagnosisStep contains the outcome of one outage diagnosis step.
+type DiagnosisStep struct {
+	Name   string `json:"name"`
+	Target string `json:"target,omitempty"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Diagnosis contains the network layer an outage was attributed to and the
+// steps that led to it.
+type Diagnosis struct {
+	Layer string          `json:"layer"`
+	Steps []DiagnosisStep `json:"steps"`
+}
+
+// OutageReport describes one outage. End is nil while it is in progress.
+// FixedBy names the last down action stage that ran before recovery.
+type OutageReport struct {
+	Start     time.Time        `json:"start"`
+	End       *time.Time       `json:"end,omitempty"`
+	Duration  ReadableDuration `json:"duration"`
+	FixedBy   string           `json:"fixedBy,omitempty"`
+	Diagnosis *Diagnosis       `json:"diagnosis,omitempty"`
 }
 
 // LoopStatus contains the current state of the monitoring loop.
@@ -30,15 +121,25 @@ type LoopStatus struct {
 	Interval        ReadableDuration `json:"interval"`
 	TimeSinceUpdate ReadableDuration `json:"timeSinceLastUpdate"`
 	TotalChecksRun  uint32           `json:"totalChecksRun"`
+	Maintenance     *Maintenance     `json:"maintenance,omitempty"`
+	SimulatedUntil  *time.Time       `json:"simulatedOutageUntil,omitempty"`
+}
+
+// Maintenance describes the maintenance window currently in effect.
+type Maintenance struct {
+	Name  string    `json:"name,omitempty"`
+	Until time.Time `json:"until"`
 }
 
 // Report contains the full status report with statistics.
 type Report struct {
-	Up         bool              `json:"isUp"`
-	Stats      []ReportByPeriod  `json:"reports"`
-	Loop       *LoopStatus       `json:"loop"`
-	DownAction *DownActionStatus `json:"downAction,omitempty"`
-	Uptime     ReadableDuration  `json:"updUptime"`
-	Version    string            `json:"updVersion"`
-	Generated  time.Time         `json:"generatedAt"`
+	Up         bool                 `json:"isUp"`
+	Stats      []ReportByPeriod     `json:"reports"`
+	Loop       *LoopStatus          `json:"loop"`
+	DownAction *DownActionStatus    `json:"downAction,omitempty"`
+	Breakers   []ProbeBreakerStatus `json:"breakers,omitempty"`
+	Outages    []OutageReport       `json:"outages,omitempty"`
+	Uptime     ReadableDuration     `json:"updUptime"`
+	Version    string               `json:"updVersion"`
+	Generated  time.Time            `json:"generatedAt"`
 }
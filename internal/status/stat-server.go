@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/hugoh/upd/internal/logger"
@@ -22,6 +24,9 @@ const (
 	DefaultStatServerIdleTimeout = 3 * time.Second
 	// StatRoute is the HTTP route for the statistics endpoint.
 	StatRoute = "/stats.json"
+	// SimulateOutageRoute is the HTTP route starting (POST, with a "for"
+	// duration) or ending (DELETE) a simulated outage.
+	SimulateOutageRoute = "/simulate-outage"
 )
 
 // StatServerConfig holds configuration for the statistics HTTP server.
@@ -36,6 +41,8 @@ type StatServerConfig struct {
 
 // StatServer provides an HTTP endpoint for status statistics.
 type StatServer struct {
+	// mu guards config, whose reports can change while serving.
+	mu     sync.Mutex
 	config *StatServerConfig
 	server *http.Server
 	status *Status
@@ -62,6 +69,8 @@ func StartStatServer(status *Status, config *StatServerConfig) *StatServer {
 
 	mux := http.NewServeMux()
 	mux.Handle("GET "+StatRoute, &StatHandler{statServer: server})
+	mux.Handle("POST "+SimulateOutageRoute, &SimulateOutageHandler{status: status})
+	mux.Handle("DELETE "+SimulateOutageRoute, &SimulateOutageHandler{status: status})
 	server.server.Handler = serverHeader(mux)
 
 	go server.listenAndServe()
@@ -69,6 +78,35 @@ func StartStatServer(status *Status, config *StatServerConfig) *StatServer {
 	return server
 }
 
+// SameListener reports whether config would start this server with the same
+// port and timeouts, so that it can keep serving across a reload.
+func (s *StatServer) SameListener(config *StatServerConfig) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return config.Port == s.config.Port &&
+		config.ReadTimeout == s.config.ReadTimeout &&
+		config.WriteTimeout == s.config.WriteTimeout &&
+		config.IdleTimeout == s.config.IdleTimeout
+}
+
+// SetReports changes the report periods of the served statistics.
+func (s *StatServer) SetReports(reports []time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := *s.config
+	config.Reports = slices.Clone(reports)
+	s.config = &config
+}
+
+func (s *StatServer) reports() []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config.Reports
+}
+
 // Shutdown gracefully shuts down the statistics server.
 func (s *StatServer) Shutdown(ctx context.Context) {
 	if s.server == nil {
@@ -99,7 +137,7 @@ type StatHandler struct {
 
 // GenStatReport generates a statistics report from the server's status.
 func (h *StatHandler) GenStatReport() *Report {
-	return h.statServer.status.GenStatReport(h.statServer.config.Reports)
+	return h.statServer.status.GenStatReport(h.statServer.reports())
 }
 
 func (h *StatHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
@@ -108,6 +146,41 @@ func (h *StatHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
 	writeJSON(writer, h.GenStatReport())
 }
 
+// SimulateOutageHandler handles HTTP requests starting or ending simulated
+// outages.
+type SimulateOutageHandler struct {
+	status *Status
+}
+
+func (h *SimulateOutageHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	var duration time.Duration
+
+	if req.Method == http.MethodPost {
+		var err error
+
+		duration, err = time.ParseDuration(req.URL.Query().Get("for"))
+		if err != nil || duration <= 0 {
+			http.Error(writer, "invalid or missing duration in 'for'", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	logger.Stats().Info("outage simulation requested",
+		"requester", req.RemoteAddr, "method", req.Method, "for", duration)
+
+	err := h.status.SimulateOutage(req.Context(), duration)
+
+	switch {
+	case errors.Is(err, ErrSimulationDisabled):
+		http.Error(writer, err.Error(), http.StatusForbidden)
+	case err != nil:
+		http.Error(writer, err.Error(), http.StatusConflict)
+	default:
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
 func writeJSON(w http.ResponseWriter, data any) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -2,6 +2,7 @@ package status
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -189,3 +190,61 @@ func TestServerHeader_SetsHeaderOnMethodNotAllowed(t *testing.T) {
 	assert.Equal(t, "upd/"+version.Version(), rec.Header().Get("Server"))
 	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
 }
+
+func TestSimulateOutageHandler_Disabled(t *testing.T) {
+	handler := &SimulateOutageHandler{status: NewStatus()}
+
+	req := httptest.NewRequest(http.MethodPost, SimulateOutageRoute+"?for=1m", http.NoBody)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestSimulateOutageHandler(t *testing.T) {
+	var got []time.Duration
+
+	status := NewStatus()
+	status.SetOutageSimulator(func(_ context.Context, d time.Duration) error {
+		got = append(got, d)
+
+		return nil
+	})
+
+	handler := &SimulateOutageHandler{status: status}
+
+	tests := []struct {
+		method string
+		target string
+		code   int
+	}{
+		{http.MethodPost, SimulateOutageRoute + "?for=10m", http.StatusNoContent},
+		{http.MethodPost, SimulateOutageRoute, http.StatusBadRequest},
+		{http.MethodPost, SimulateOutageRoute + "?for=-1s", http.StatusBadRequest},
+		{http.MethodDelete, SimulateOutageRoute, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, http.NoBody))
+		assert.Equal(t, tt.code, rec.Code, tt.method+" "+tt.target)
+	}
+
+	assert.Equal(t, []time.Duration{10 * time.Minute, 0}, got)
+}
+
+func TestSimulateOutageHandler_Conflict(t *testing.T) {
+	status := NewStatus()
+	status.SetOutageSimulator(func(context.Context, time.Duration) error {
+		return errors.New("busy")
+	})
+
+	handler := &SimulateOutageHandler{status: status}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, SimulateOutageRoute+"?for=1m", http.NoBody))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "busy")
+}
@@ -82,12 +82,22 @@
 package status
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"time"
 
+	"github.com/hugoh/upd/internal/check"
 	"github.com/hugoh/upd/internal/version"
 )
 
+// ErrSimulationDisabled is returned when simulated outages are not enabled.
+var ErrSimulationDisabled = errors.New("outage simulation disabled")
+
+// OutageSimulator simulates an outage for duration, ending it when duration
+// is 0.
+type OutageSimulator func(ctx context.Context, duration time.Duration) error
+
 // Status tracks the current network connectivity state and history.
 type Status struct {
 	Up                 bool
@@ -95,8 +105,13 @@ type Status struct {
 	mutex              sync.Mutex
 	stateChangeTracker *StateChangeTracker
 	rollingTracker     *RollingProbeTracker
+	exclude            ExcludeFunc
+	simulator          OutageSimulator
 	downActionStatus   DownActionStatus
 	loopStatus         LoopStatus
+	breakers           []ProbeBreakerStatus
+	outages            []outage
+	droppedOutageEnd   time.Time
 	lastSuccessAt      time.Time
 	nextCheckAt        time.Time
 }
@@ -121,6 +136,7 @@ func (s *Status) SetRetention(retention time.Duration) {
 		s.stateChangeTracker = &StateChangeTracker{
 			retention: retention,
 			started:   time.Now(),
+			exclude:   s.exclude,
 		}
 	} else {
 		s.stateChangeTracker.retention = retention
@@ -128,6 +144,41 @@ func (s *Status) SetRetention(retention time.Duration) {
 	}
 }
 
+// SetExclusion sets the function reporting downtime excluded from
+// availability, such as time within maintenance windows. Nil excludes nothing.
+func (s *Status) SetExclusion(exclude ExcludeFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.exclude = exclude
+	if s.stateChangeTracker != nil {
+		s.stateChangeTracker.exclude = exclude
+	}
+}
+
+// SetOutageSimulator sets the function simulating outages on request of the
+// statistics server. Nil disables simulated outages.
+func (s *Status) SetOutageSimulator(simulator OutageSimulator) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.simulator = simulator
+}
+
+// SimulateOutage simulates an outage for duration, or ends the simulated
+// outage when duration is 0.
+func (s *Status) SimulateOutage(ctx context.Context, duration time.Duration) error {
+	s.mutex.Lock()
+	simulator := s.simulator
+	s.mutex.Unlock()
+
+	if simulator == nil {
+		return ErrSimulationDisabled
+	}
+
+	return simulator(ctx, duration)
+}
+
 // SetRollingTracker attaches a probe stats tracker for per-period reporting.
 func (s *Status) SetRollingTracker(t *RollingProbeTracker) {
 	s.mutex.Lock()
@@ -144,6 +195,14 @@ func (s *Status) SetDownActionStatus(das DownActionStatus) {
 	s.downActionStatus = das
 }
 
+// SetBreakerStatus stores a snapshot of the probe circuit breakers.
+func (s *Status) SetBreakerStatus(breakers []ProbeBreakerStatus) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.breakers = breakers
+}
+
 // SetLoopStatus stores a snapshot of the monitoring loop state.
 func (s *Status) SetLoopStatus(ls LoopStatus) {
 	s.mutex.Lock()
@@ -160,6 +219,15 @@ func (s *Status) SetLastSuccessAt(t time.Time) {
 	s.lastSuccessAt = t
 }
 
+// LastSuccessAt returns the timestamp of the last successful check, zero if
+// none succeeded yet.
+func (s *Status) LastSuccessAt() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.lastSuccessAt
+}
+
 // SetNextCheckAt stores the timestamp of the next scheduled check.
 func (s *Status) SetNextCheckAt(t time.Time) {
 	s.mutex.Lock()
@@ -218,9 +286,11 @@ func (s *Status) GenStatReport(periods []time.Duration) *Report {
 		Version:    version.Version(),
 		Loop:       &loopSt,
 		DownAction: nil,
+		Breakers:   s.breakers,
+		Outages:    s.outageReports(generated),
 	}
 
-	if das.Iteration > 0 || das.SleepTime > 0 {
+	if das.Iteration > 0 || das.SleepTime > 0 || len(das.History) > 0 {
 		rpt.DownAction = &das
 	}
 
@@ -249,11 +319,12 @@ func (s *Status) GenStatReport(periods []time.Duration) *Report {
 			ps := allStats[idx]
 			rpt.Stats[idx].TotalProbes = ps.Total
 			rpt.Stats[idx].FailedProbes = ps.Failed
+			rpt.Stats[idx].FailureRate = failureRate(ps)
+			rpt.Stats[idx].Failures = failureCounts(ps)
+			rpt.Stats[idx].Latency = latencyReport(ps)
 
-			if ps.Total > 0 {
-				rpt.Stats[idx].FailureRate = ReadablePercent(float64(ps.Failed) / float64(ps.Total))
-			} else {
-				rpt.Stats[idx].FailureRate = ReadablePercent(-1)
+			for _, ts := range ps.Targets {
+				rpt.Stats[idx].Probes = append(rpt.Stats[idx].Probes, probeReport(ts))
 			}
 		}
 	}
@@ -261,6 +332,77 @@ func (s *Status) GenStatReport(periods []time.Duration) *Report {
 	return rpt
 }
 
+// PeriodReports returns the availability of periods, without the probe
+// statistics of GenStatReport, which only covers the report periods.
+func (s *Status) PeriodReports(periods []time.Duration) []ReportByPeriod {
+	generated := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stateChangeTracker == nil {
+		return nil
+	}
+
+	return s.stateChangeTracker.GenReports(s.Up, generated, periods)
+}
+
+func failureRate(ps ProbeStats) ReadablePercent {
+	if ps.Total == 0 {
+		return ReadablePercent(-1)
+	}
+
+	return ReadablePercent(float64(ps.Failed) / float64(ps.Total))
+}
+
+func probeReport(ts TargetStats) ProbeReport {
+	return ProbeReport{
+		Scheme:       ts.Scheme,
+		Target:       ts.Target,
+		Name:         ts.Name,
+		TotalProbes:  ts.Total,
+		FailedProbes: ts.Failed,
+		FailureRate:  failureRate(ts.ProbeStats),
+		Failures:     failureCounts(ts.ProbeStats),
+		Latency:      latencyReport(ts.ProbeStats),
+	}
+}
+
+// failureCounts returns the number of probes per failure class name, or nil
+// when there were none.
+func failureCounts(ps ProbeStats) map[string]int {
+	var counts map[string]int
+
+	for class, n := range ps.Failures {
+		if n == 0 {
+			continue
+		}
+
+		if counts == nil {
+			counts = make(map[string]int)
+		}
+
+		counts[check.FailureClass(class).String()] = n
+	}
+
+	return counts
+}
+
+// latencyReport returns nil when no probe succeeded in the period, since
+// only successful probes have a meaningful latency.
+func latencyReport(ps ProbeStats) *LatencyReport {
+	if ps.Failed >= ps.Total {
+		return nil
+	}
+
+	return &LatencyReport{
+		P50: ReadableLatency(ps.Latency.P50),
+		P90: ReadableLatency(ps.Latency.P90),
+		P99: ReadableLatency(ps.Latency.P99),
+		Max: ReadableLatency(ps.Latency.Max),
+	}
+}
+
 func (s *Status) set(up bool) {
 	if !s.initialized {
 		s.initialized = true
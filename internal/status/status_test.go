@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hugoh/upd/internal/check"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -237,8 +238,8 @@ func TestGenStatReport_FailureRateNotComputed_WhenNoProbes(t *testing.T) {
 func TestGenStatReport_FailureRateComputed_WhenProbesExist(t *testing.T) {
 	s, tracker := newStatusWithTracker()
 
-	tracker.Record(false)
-	tracker.Record(true)
+	tracker.Record(ProbeResult{})
+	tracker.Record(ProbeResult{Failed: true})
 
 	rpt := s.GenStatReport([]time.Duration{time.Minute})
 	require.Len(t, rpt.Stats, 1)
@@ -246,3 +247,71 @@ func TestGenStatReport_FailureRateComputed_WhenProbesExist(t *testing.T) {
 	assert.Equal(t, 1, rpt.Stats[0].FailedProbes)
 	assert.InDelta(t, 0.5, float64(rpt.Stats[0].FailureRate), 0.0001)
 }
+
+func TestGenStatReport_Probes(t *testing.T) {
+	s, tracker := newStatusWithTracker()
+	target := ProbeTarget{Scheme: "tcp", Target: "1.1.1.1:53"}
+
+	tracker.Record(ProbeResult{ProbeTarget: target, Latency: 10 * time.Millisecond})
+	tracker.Record(ProbeResult{ProbeTarget: target, Failed: true})
+	tracker.Record(ProbeResult{
+		ProbeTarget: ProbeTarget{Scheme: "tcp", Target: "8.8.8.8:53"},
+		Failed:      true,
+	})
+
+	rpt := s.GenStatReport([]time.Duration{time.Minute})
+	require.Len(t, rpt.Stats, 1)
+	require.Len(t, rpt.Stats[0].Probes, 2)
+
+	probe := rpt.Stats[0].Probes[0]
+	assert.Equal(t, "tcp", probe.Scheme)
+	assert.Equal(t, "1.1.1.1:53", probe.Target)
+	assert.Equal(t, 2, probe.TotalProbes)
+	assert.Equal(t, 1, probe.FailedProbes)
+	assert.InDelta(t, 0.5, float64(probe.FailureRate), 0.0001)
+	require.NotNil(t, probe.Latency)
+	assert.Positive(t, time.Duration(probe.Latency.P50))
+
+	assert.Nil(t, rpt.Stats[0].Probes[1].Latency, "no latency without a successful probe")
+}
+
+func TestGenStatReport_Latency(t *testing.T) {
+	s, tracker := newStatusWithTracker()
+
+	rpt := s.GenStatReport([]time.Duration{time.Minute})
+	require.Len(t, rpt.Stats, 1)
+	assert.Nil(t, rpt.Stats[0].Latency, "no latency without probes")
+
+	for _, latency := range []time.Duration{
+		10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 250 * time.Millisecond,
+	} {
+		tracker.Record(ProbeResult{Latency: latency})
+	}
+
+	rpt = s.GenStatReport([]time.Duration{time.Minute})
+	require.NotNil(t, rpt.Stats[0].Latency)
+	assert.Equal(t, 250*time.Millisecond, time.Duration(rpt.Stats[0].Latency.Max))
+	assert.Equal(t, 250*time.Millisecond, time.Duration(rpt.Stats[0].Latency.P99))
+	assert.GreaterOrEqual(t, time.Duration(rpt.Stats[0].Latency.P50), 20*time.Millisecond)
+	assert.Less(t, time.Duration(rpt.Stats[0].Latency.P50), 30*time.Millisecond)
+}
+
+func TestGenStatReport_Failures(t *testing.T) {
+	s, tracker := newStatusWithTracker()
+	target := ProbeTarget{Scheme: "tcp", Target: "1.1.1.1:53"}
+
+	tracker.Record(ProbeResult{ProbeTarget: target})
+
+	rpt := s.GenStatReport([]time.Duration{time.Minute})
+	assert.Nil(t, rpt.Stats[0].Failures, "no failure classes without failures")
+
+	tracker.Record(ProbeResult{ProbeTarget: target, Failed: true, Failure: check.FailureTimeout})
+	tracker.Record(ProbeResult{ProbeTarget: target, Failed: true, Failure: check.FailureTimeout})
+	tracker.Record(ProbeResult{ProbeTarget: target, Failed: true, Failure: check.FailureDNS})
+
+	rpt = s.GenStatReport([]time.Duration{time.Minute})
+	require.Len(t, rpt.Stats, 1)
+	assert.Equal(t, map[string]int{"timeout": 2, "dns": 1}, rpt.Stats[0].Failures)
+	require.Len(t, rpt.Stats[0].Probes, 1)
+	assert.Equal(t, map[string]int{"timeout": 2, "dns": 1}, rpt.Stats[0].Probes[0].Failures)
+}
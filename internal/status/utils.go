@@ -12,6 +12,9 @@ type (
 	ReadablePercent float64
 	// ReadableDuration is a time.Duration formatted for human-readable JSON output.
 	ReadableDuration time.Duration
+	// ReadableLatency is a time.Duration formatted with millisecond precision
+	// for JSON output.
+	ReadableLatency time.Duration
 )
 
 const (
@@ -58,6 +61,15 @@ func formatDuration(d time.Duration) string {
 	return str
 }
 
+// String formats the duration as in JSON output, such as 1h or 24h.
+func (d ReadableDuration) String() string {
+	if d == NotComputedDuration {
+		return NotComputedMsg
+	}
+
+	return formatDuration(time.Duration(d))
+}
+
 // MarshalJSON formats the duration for JSON output.
 func (d ReadableDuration) MarshalJSON() ([]byte, error) {
 	if d == NotComputedDuration {
@@ -66,3 +78,15 @@ func (d ReadableDuration) MarshalJSON() ([]byte, error) {
 
 	return json.Marshal(formatDuration(time.Duration(d))) //nolint:wrapcheck
 }
+
+// MarshalJSON formats the latency for JSON output.
+func (l ReadableLatency) MarshalJSON() ([]byte, error) {
+	d := time.Duration(l)
+	if d >= time.Millisecond {
+		d = d.Round(time.Millisecond)
+	} else {
+		d = d.Round(time.Microsecond)
+	}
+
+	return json.Marshal(d.String()) //nolint:wrapcheck
+}
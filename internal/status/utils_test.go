@@ -24,6 +24,12 @@ func Test_FormatDuration(t *testing.T) {
 	assert.Equal(t, "1h1m1s", formatDuration(time.Hour+time.Minute+time.Second))
 }
 
+func TestReadableDuration_String(t *testing.T) {
+	assert.Equal(t, "24h", ReadableDuration(24*time.Hour).String())
+	assert.Equal(t, "1h30m", ReadableDuration(90*time.Minute).String())
+	assert.Equal(t, NotComputedMsg, NotComputedDuration.String())
+}
+
 func TestReadableTypes_MarshalJSON(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -39,6 +45,10 @@ func TestReadableTypes_MarshalJSON(t *testing.T) {
 		{"duration one minute", ReadableDuration(time.Minute), `"1m"`},
 		{"duration one hour", ReadableDuration(time.Hour), `"1h"`},
 		{"duration complex", ReadableDuration(time.Hour + time.Minute + time.Second), `"1h1m1s"`},
+		{"latency zero", ReadableLatency(0), `"0s"`},
+		{"latency sub-ms", ReadableLatency(123456 * time.Nanosecond), `"123µs"`},
+		{"latency ms", ReadableLatency(12345678 * time.Nanosecond), `"12ms"`},
+		{"latency seconds", ReadableLatency(1234567890 * time.Nanosecond), `"1.235s"`},
 	}
 
 	for _, tt := range tests {